@@ -0,0 +1,128 @@
+// Package attestation issues signed statements of the CA certificates in a
+// trust store, so a release pipeline can pin the exact set that was live when
+// it deployed and verify it later.
+package attestation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/collector"
+)
+
+// PayloadType identifies the payload of an Attestation as a JSON Statement.
+const PayloadType = "application/vnd.elb-trust-store-exporter.statement+json"
+
+// Statement is what an Attestation attests to: the bundle and certificates
+// of a trust store as found by a scrape.
+type Statement struct {
+	TrustStoreARN  string                          `json:"trust_store_arn"`
+	TrustStoreName string                          `json:"trust_store_name"`
+	BundleSHA256   string                          `json:"bundle_sha256"`
+	Certificates   []collector.CertificateSnapshot `json:"certificates"`
+	SnapshotTime   time.Time                       `json:"snapshot_time"`
+	IssuedAt       time.Time                       `json:"issued_at"`
+}
+
+// Attestation is a signed payload, usually a Statement. The signature is over
+// the exact bytes of Payload, which is base64 encoded in JSON, so it can be
+// verified without re-encoding what the payload holds.
+type Attestation struct {
+	PayloadType string    `json:"payload_type"`
+	Payload     []byte    `json:"payload"`
+	Signature   Signature `json:"signature"`
+}
+
+// Sign returns an Attestation of payload, which has the given type, signed
+// with signer.
+func Sign(ctx context.Context, signer Signer, payloadType string, payload []byte) (Attestation, error) {
+	signature, err := signer.Sign(ctx, payload)
+	if err != nil {
+		return Attestation{}, fmt.Errorf("failed to sign attestation: %w", err)
+	}
+	return Attestation{PayloadType: payloadType, Payload: payload, Signature: signature}, nil
+}
+
+// Statement decodes the Statement in the payload. It does not verify the
+// signature.
+func (a *Attestation) Statement() (Statement, error) {
+	var s Statement
+	if a.PayloadType != PayloadType {
+		return s, fmt.Errorf("unexpected payload type %q", a.PayloadType)
+	}
+	err := json.Unmarshal(a.Payload, &s)
+	return s, err
+}
+
+// Source provides the trust stores found by the latest scrape, as returned by
+// collector.Collector.Result.
+type Source interface {
+	Result() (snapshot collector.Snapshot, generation uint64, success bool)
+}
+
+// Handler serves signed attestations of the trust stores in a Source.
+type Handler struct {
+	source Source
+	signer Signer
+}
+
+// NewHandler returns a Handler signing attestations of the trust stores in
+// source with signer.
+func NewHandler(source Source, signer Signer) *Handler {
+	return &Handler{source: source, signer: signer}
+}
+
+// Attest returns a signed attestation of the trust store with the given ARN in
+// the latest scrape, or false if the trust store was not found by it.
+func (h *Handler) Attest(ctx context.Context, arn string, now time.Time) (Attestation, bool, error) {
+	snapshot, generation, _ := h.source.Result()
+	if generation == 0 {
+		return Attestation{}, false, nil
+	}
+	i := slices.IndexFunc(snapshot.TrustStores, func(ts collector.TrustStoreSnapshot) bool {
+		return ts.ARN == arn
+	})
+	if i < 0 {
+		return Attestation{}, false, nil
+	}
+
+	ts := snapshot.TrustStores[i]
+	payload, err := json.Marshal(Statement{
+		TrustStoreARN:  ts.ARN,
+		TrustStoreName: ts.Name,
+		BundleSHA256:   ts.BundleSHA256,
+		Certificates:   ts.Certificates,
+		SnapshotTime:   snapshot.Time,
+		IssuedAt:       now.UTC(),
+	})
+	if err != nil {
+		return Attestation{}, false, err
+	}
+	a, err := Sign(ctx, h.signer, PayloadType, payload)
+	return a, err == nil, err
+}
+
+// ServeHTTP serves an attestation of the trust store whose URL-encoded ARN is
+// the {arn} path value.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a, ok, err := h.Attest(r.Context(), r.PathValue("arn"), time.Now())
+	if err != nil {
+		log.Printf("Error attesting trust store %s: %v", r.PathValue("arn"), err)
+		http.Error(w, "failed to sign attestation", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "trust store not found by the latest scrape", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(a); err != nil {
+		log.Printf("failed to write attestation: %v", err)
+	}
+}
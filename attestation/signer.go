@@ -0,0 +1,117 @@
+package attestation
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// HMACSHA256 is the algorithm of signatures made by an HMAC signer.
+const HMACSHA256 = "HMAC_SHA_256"
+
+// Signature is a signature of an attestation's payload.
+type Signature struct {
+	// Algorithm is HMAC_SHA_256 or the KMS signing algorithm.
+	Algorithm string `json:"algorithm"`
+	// KeyID identifies the key: the ARN of a KMS key, or the first 8 bytes of
+	// the SHA-256 checksum of an HMAC key, hex encoded.
+	KeyID string `json:"key_id"`
+	Value []byte `json:"value"`
+}
+
+// Signer signs attestation payloads.
+type Signer interface {
+	Sign(ctx context.Context, payload []byte) (Signature, error)
+}
+
+type hmacSigner struct {
+	key   []byte
+	keyID string
+}
+
+// NewHMACSigner returns a Signer making HMAC-SHA256 signatures with key.
+func NewHMACSigner(key []byte) (Signer, error) {
+	if len(key) < sha256.Size {
+		return nil, fmt.Errorf("HMAC key must be at least %d bytes", sha256.Size)
+	}
+	sum := sha256.Sum256(key)
+	return &hmacSigner{key: key, keyID: hex.EncodeToString(sum[:8])}, nil
+}
+
+func (s *hmacSigner) Sign(_ context.Context, payload []byte) (Signature, error) {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return Signature{Algorithm: HMACSHA256, KeyID: s.keyID, Value: mac.Sum(nil)}, nil
+}
+
+// VerifyHMAC checks that an attestation was signed with the HMAC key and
+// returns its Statement.
+func VerifyHMAC(a Attestation, key []byte) (Statement, error) {
+	if a.Signature.Algorithm != HMACSHA256 {
+		return Statement{}, fmt.Errorf("attestation is signed with %s, not %s", a.Signature.Algorithm, HMACSHA256)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(a.Payload)
+	if !hmac.Equal(mac.Sum(nil), a.Signature.Value) {
+		return Statement{}, errors.New("attestation signature does not match")
+	}
+	return a.Statement()
+}
+
+// KMSAPI is the subset of the KMS client used to sign attestations.
+type KMSAPI interface {
+	Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error)
+}
+
+type kmsSigner struct {
+	client    KMSAPI
+	keyID     string
+	algorithm types.SigningAlgorithmSpec
+	hash      crypto.Hash
+}
+
+// NewKMSSigner returns a Signer signing with an asymmetric KMS key using one
+// of its RSASSA or ECDSA signing algorithms. The payload is hashed locally and
+// its digest signed, so payloads are not limited to the 4 KB KMS accepts, and
+// the signature verifies against the payload itself with the public key.
+func NewKMSSigner(client KMSAPI, keyID string, algorithm string) (Signer, error) {
+	if !strings.HasPrefix(algorithm, "RSASSA_") && !strings.HasPrefix(algorithm, "ECDSA_") {
+		return nil, fmt.Errorf("unsupported KMS signing algorithm %q", algorithm)
+	}
+	s := &kmsSigner{client: client, keyID: keyID, algorithm: types.SigningAlgorithmSpec(algorithm)}
+	switch {
+	case strings.HasSuffix(algorithm, "_SHA_256"):
+		s.hash = crypto.SHA256
+	case strings.HasSuffix(algorithm, "_SHA_384"):
+		s.hash = crypto.SHA384
+	case strings.HasSuffix(algorithm, "_SHA_512"):
+		s.hash = crypto.SHA512
+	default:
+		return nil, fmt.Errorf("unsupported KMS signing algorithm %q", algorithm)
+	}
+	return s, nil
+}
+
+func (s *kmsSigner) Sign(ctx context.Context, payload []byte) (Signature, error) {
+	h := s.hash.New()
+	h.Write(payload)
+	out, err := s.client.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String(s.keyID),
+		Message:          h.Sum(nil),
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: s.algorithm,
+	})
+	if err != nil {
+		return Signature{}, err
+	}
+	return Signature{Algorithm: string(out.SigningAlgorithm), KeyID: aws.ToString(out.KeyId), Value: out.Signature}, nil
+}
@@ -0,0 +1,166 @@
+// Package authz authorizes requests to the exporter's JSON and admin APIs with
+// bearer tokens. Each token has read or admin scope and may be restricted to
+// the trust stores whose ARNs start with given prefixes, so teams sharing an
+// exporter only see and manage their own trust stores.
+package authz
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Scope is the access a token grants.
+type Scope string
+
+const (
+	// ScopeRead allows reading the JSON APIs.
+	ScopeRead Scope = "read"
+	// ScopeAdmin allows the admin APIs as well as reading.
+	ScopeAdmin Scope = "admin"
+)
+
+// TokenConfig configures a token. Only the SHA-256 checksum of the token is
+// configured, so the file does not hold the secret itself.
+type TokenConfig struct {
+	Name               string   `yaml:"name"`
+	TokenSHA256        string   `yaml:"token_sha256"`
+	Scope              Scope    `yaml:"scope"`
+	TrustStorePrefixes []string `yaml:"trust_store_prefixes"`
+}
+
+// Config is the token configuration read from a YAML file.
+type Config struct {
+	Tokens []TokenConfig `yaml:"tokens"`
+}
+
+// LoadConfig reads a token configuration file, rejecting unknown settings.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Principal is the holder of a token.
+type Principal struct {
+	name     string
+	scope    Scope
+	prefixes []string
+}
+
+// Name returns the name of the principal's token.
+func (p *Principal) Name() string {
+	return p.name
+}
+
+// Allows reports whether the principal may access the trust store with the
+// given ARN.
+func (p *Principal) Allows(arn string) bool {
+	if len(p.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range p.prefixes {
+		if strings.HasPrefix(arn, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorizer checks the bearer tokens of API requests. A nil Authorizer
+// allows every request.
+type Authorizer struct {
+	tokens map[[sha256.Size]byte]*Principal
+}
+
+// New returns an Authorizer for the configured tokens.
+func New(cfg *Config) (*Authorizer, error) {
+	a := &Authorizer{tokens: make(map[[sha256.Size]byte]*Principal, len(cfg.Tokens))}
+	names := make(map[string]bool, len(cfg.Tokens))
+	for i, tc := range cfg.Tokens {
+		if tc.Name == "" {
+			return nil, fmt.Errorf("token %d has no name", i+1)
+		}
+		if names[tc.Name] {
+			return nil, fmt.Errorf("token %q is defined twice", tc.Name)
+		}
+		names[tc.Name] = true
+		if tc.Scope != ScopeRead && tc.Scope != ScopeAdmin {
+			return nil, fmt.Errorf("token %q has invalid scope %q, expected %s or %s", tc.Name, tc.Scope, ScopeRead, ScopeAdmin)
+		}
+		sum, err := hex.DecodeString(tc.TokenSHA256)
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("token %q has an invalid token_sha256, expected a hex encoded SHA-256 checksum", tc.Name)
+		}
+		key := [sha256.Size]byte(sum)
+		if _, ok := a.tokens[key]; ok {
+			return nil, fmt.Errorf("token %q has the same token as another", tc.Name)
+		}
+		a.tokens[key] = &Principal{name: tc.Name, scope: tc.Scope, prefixes: tc.TrustStorePrefixes}
+	}
+	return a, nil
+}
+
+type contextKey struct{}
+
+// FromContext returns the principal of an authorized request, or nil if
+// requests are not authorized.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
+
+// Allowed reports whether the request with the given context may access the
+// trust store with the given ARN. Every trust store is allowed if requests are
+// not authorized.
+func Allowed(ctx context.Context, arn string) bool {
+	p := FromContext(ctx)
+	return p == nil || p.Allows(arn)
+}
+
+// Require returns a handler that serves requests with next if they carry a
+// token with at least the given scope. A request for a single trust store,
+// given by the {arn} path value, must be allowed by the token's prefixes, and
+// any other admin request needs a token without prefixes as it affects every
+// trust store. Handlers for several trust stores should filter them with
+// Allowed.
+func (a *Authorizer) Require(scope Scope, next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		p := a.tokens[sha256.Sum256([]byte(token))]
+		if !ok || p == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "a valid bearer token is required", http.StatusUnauthorized)
+			return
+		}
+		if scope == ScopeAdmin && p.scope != ScopeAdmin {
+			http.Error(w, "the token does not have admin scope", http.StatusForbidden)
+			return
+		}
+		if arn := r.PathValue("arn"); arn != "" {
+			if !p.Allows(arn) {
+				http.Error(w, "the token does not allow access to this trust store", http.StatusForbidden)
+				return
+			}
+		} else if scope == ScopeAdmin && len(p.prefixes) > 0 {
+			http.Error(w, "the token is restricted to some trust stores", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, p)))
+	})
+}
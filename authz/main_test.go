@@ -0,0 +1,135 @@
+package authz_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/panubo/elb-trust-store-exporter/authz"
+)
+
+const (
+	teamPrefix = "arn:aws:elasticloadbalancing:us-east-1:123456789012:truststore/team-a-"
+	teamARN    = teamPrefix + "ca/0123456789abcdef"
+	otherARN   = "arn:aws:elasticloadbalancing:us-east-1:123456789012:truststore/team-b-ca/fedcba9876543210"
+)
+
+func tokenSHA256(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newServer returns a server with read and admin routes like the exporter's,
+// whose handlers respond with the principal's name and the trust stores it is
+// allowed.
+func newServer(t *testing.T, a *authz.Authorizer) *httptest.Server {
+	t.Helper()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := "anonymous"
+		if p := authz.FromContext(r.Context()); p != nil {
+			name = p.Name()
+		}
+		fmt.Fprintf(w, "%s %t %t", name, authz.Allowed(r.Context(), teamARN), authz.Allowed(r.Context(), otherARN))
+	})
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/truststores", a.Require(authz.ScopeRead, handler))
+	mux.Handle("GET /api/v1/truststores/{arn}/attestation", a.Require(authz.ScopeRead, handler))
+	mux.Handle("/-/reload", a.Require(authz.ScopeAdmin, handler))
+	mux.Handle("/debug/pprof/", a.Require(authz.ScopeAdmin, handler))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRequire(t *testing.T) {
+	a, err := authz.New(&authz.Config{Tokens: []authz.TokenConfig{
+		{Name: "reader", TokenSHA256: tokenSHA256("read-token"), Scope: authz.ScopeRead},
+		{Name: "admin", TokenSHA256: tokenSHA256("admin-token"), Scope: authz.ScopeAdmin},
+		{Name: "team-reader", TokenSHA256: tokenSHA256("team-read-token"), Scope: authz.ScopeRead, TrustStorePrefixes: []string{teamPrefix}},
+		{Name: "team-admin", TokenSHA256: tokenSHA256("team-admin-token"), Scope: authz.ScopeAdmin, TrustStorePrefixes: []string{teamPrefix}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newServer(t, a)
+
+	attestation := func(arn string) string {
+		return "/api/v1/truststores/" + url.PathEscape(arn) + "/attestation"
+	}
+	for _, tc := range []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		status        int
+		body          string
+	}{
+		{"no header", "GET", "/api/v1/truststores", "", http.StatusUnauthorized, ""},
+		{"unknown token", "GET", "/api/v1/truststores", "Bearer other-token", http.StatusUnauthorized, ""},
+		{"empty token", "GET", "/api/v1/truststores", "Bearer ", http.StatusUnauthorized, ""},
+		{"no scheme", "GET", "/api/v1/truststores", "read-token", http.StatusUnauthorized, ""},
+		{"basic scheme", "GET", "/api/v1/truststores", "Basic read-token", http.StatusUnauthorized, ""},
+		{"no space", "GET", "/api/v1/truststores", "Bearerread-token", http.StatusUnauthorized, ""},
+		{"read token", "GET", "/api/v1/truststores", "Bearer read-token", http.StatusOK, "reader true true"},
+		{"admin token on read route", "GET", "/api/v1/truststores", "Bearer admin-token", http.StatusOK, "admin true true"},
+		{"read token on reload", "POST", "/-/reload", "Bearer read-token", http.StatusForbidden, ""},
+		{"read token on pprof", "GET", "/debug/pprof/heap", "Bearer read-token", http.StatusForbidden, ""},
+		{"admin token on reload", "POST", "/-/reload", "Bearer admin-token", http.StatusOK, "admin true true"},
+		{"admin token on pprof", "GET", "/debug/pprof/", "Bearer admin-token", http.StatusOK, "admin true true"},
+		{"prefixed token lists its trust stores", "GET", "/api/v1/truststores", "Bearer team-read-token", http.StatusOK, "team-reader true false"},
+		{"prefixed token on its trust store", "GET", attestation(teamARN), "Bearer team-read-token", http.StatusOK, "team-reader true false"},
+		{"prefixed token on another trust store", "GET", attestation(otherARN), "Bearer team-read-token", http.StatusForbidden, ""},
+		{"prefixed admin token on reload", "POST", "/-/reload", "Bearer team-admin-token", http.StatusForbidden, ""},
+		{"prefixed admin token on pprof", "GET", "/debug/pprof/", "Bearer team-admin-token", http.StatusForbidden, ""},
+		{"prefixed admin token on pprof profile", "GET", "/debug/pprof/heap", "Bearer team-admin-token", http.StatusForbidden, ""},
+		{"prefixed admin token on its trust store", "GET", attestation(teamARN), "Bearer team-admin-token", http.StatusOK, "team-admin true false"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, server.URL+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.status {
+				t.Fatalf("got status %d, want %d: %s", resp.StatusCode, tc.status, body)
+			}
+			if tc.status == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("got WWW-Authenticate %q, want Bearer", resp.Header.Get("WWW-Authenticate"))
+			}
+			if tc.body != "" && strings.TrimSpace(string(body)) != tc.body {
+				t.Errorf("got body %q, want %q", body, tc.body)
+			}
+		})
+	}
+}
+
+// TestRequireNil checks a nil Authorizer allows every request.
+func TestRequireNil(t *testing.T) {
+	server := newServer(t, nil)
+	resp, err := http.Post(server.URL+"/-/reload", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "anonymous true true" {
+		t.Errorf("got %d %q, want 200 %q", resp.StatusCode, body, "anonymous true true")
+	}
+}
@@ -0,0 +1,169 @@
+// Package cloudwatch publishes trust store and certificate expiry metrics to
+// Amazon CloudWatch after every scrape, so expiry can be alarmed on with
+// native CloudWatch alarms where there is no Prometheus.
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/panubo/elb-trust-store-exporter/collector"
+	"github.com/panubo/elb-trust-store-exporter/events"
+)
+
+// maxMetricData is the number of metric data points sent per PutMetricData
+// request.
+const maxMetricData = 1000
+
+// publishTimeout bounds the time taken to publish the metrics of a scrape.
+const publishTimeout = time.Minute
+
+// day is the unit of the expiry metrics, which are published in days as
+// CloudWatch has no unit for it.
+const day = 24 * time.Hour
+
+// Source provides the trust stores found by the latest scrape, as returned by
+// collector.Collector.Result.
+type Source interface {
+	Result() (snapshot collector.Snapshot, generation uint64, success bool)
+}
+
+// API is the subset of the CloudWatch API used to publish metrics.
+type API interface {
+	PutMetricData(
+		ctx context.Context,
+		params *cloudwatch.PutMetricDataInput,
+		optFns ...func(*cloudwatch.Options),
+	) (*cloudwatch.PutMetricDataOutput, error)
+}
+
+// Publisher publishes the metrics of each scrape result of a Source to a
+// CloudWatch namespace.
+type Publisher struct {
+	client       API
+	namespace    string
+	source       Source
+	certificates bool
+
+	// published is the time of the last scrape result published.
+	published time.Time
+}
+
+// NewPublisher returns a Publisher that publishes the trust store metrics of
+// source to namespace, and also the expiry of every certificate if
+// certificates is set.
+func NewPublisher(client API, namespace string, source Source, certificates bool) *Publisher {
+	return &Publisher{client: client, namespace: namespace, source: source, certificates: certificates}
+}
+
+// NewClient returns a CloudWatch client for the AWS configuration.
+func NewClient(cfg aws.Config) API {
+	return cloudwatch.NewFromConfig(cfg)
+}
+
+// Run publishes the scrape result announced by each scrape_completed event
+// from the broker, until the broker is closed.
+func (p *Publisher) Run(broker *events.Broker) {
+	ch, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+
+	for e := range ch {
+		if e.Type != events.ScrapeCompleted {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		if err := p.Publish(ctx); err != nil {
+			log.Printf("Error publishing metrics to CloudWatch: %v", err)
+		}
+		cancel()
+	}
+}
+
+// Publish publishes the metrics of the latest scrape result, unless it has
+// already been published.
+func (p *Publisher) Publish(ctx context.Context) error {
+	snapshot, generation, _ := p.source.Result()
+	if generation == 0 || snapshot.Time.Equal(p.published) {
+		return nil
+	}
+
+	data := metricData(snapshot, p.certificates)
+	for start := 0; start < len(data); start += maxMetricData {
+		end := min(start+maxMetricData, len(data))
+		_, err := p.client.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(p.namespace),
+			MetricData: data[start:end],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to put metric data: %w", err)
+		}
+	}
+	p.published = snapshot.Time
+	return nil
+}
+
+// metricData returns the metrics of a scrape result, timestamped with the time
+// of the scrape:
+//
+//   - Certificates: the number of certificates in each trust store.
+//   - ExpiredCertificates: the number of expired certificates in each trust
+//     store.
+//   - DaysToEarliestExpiry: the days until the first certificate in each
+//     trust store expires, omitted for an empty trust store.
+//   - CertificateDaysToExpiry: the days until each certificate expires, if
+//     certificates is set.
+//
+// Trust store metrics have TrustStoreName and TrustStoreArn dimensions, and
+// certificate metrics also have SerialNumber and FingerprintSHA256.
+func metricData(s collector.Snapshot, certificates bool) []types.MetricDatum {
+	var data []types.MetricDatum
+	datum := func(name string, value float64, unit types.StandardUnit, dimensions []types.Dimension) {
+		data = append(data, types.MetricDatum{
+			MetricName: aws.String(name),
+			Value:      aws.Float64(value),
+			Unit:       unit,
+			Timestamp:  aws.Time(s.Time),
+			Dimensions: dimensions,
+		})
+	}
+
+	for _, ts := range s.TrustStores {
+		dimensions := []types.Dimension{
+			{Name: aws.String("TrustStoreName"), Value: aws.String(ts.Name)},
+			{Name: aws.String("TrustStoreArn"), Value: aws.String(ts.ARN)},
+		}
+		var expired int
+		var earliest time.Time
+		for _, cert := range ts.Certificates {
+			if !cert.NotAfter.After(s.Time) {
+				expired++
+			}
+			if earliest.IsZero() || cert.NotAfter.Before(earliest) {
+				earliest = cert.NotAfter
+			}
+			if certificates {
+				datum("CertificateDaysToExpiry", days(cert.NotAfter.Sub(s.Time)), types.StandardUnitNone, append(
+					dimensions[:len(dimensions):len(dimensions)],
+					types.Dimension{Name: aws.String("SerialNumber"), Value: aws.String(cert.SerialNumber)},
+					types.Dimension{Name: aws.String("FingerprintSHA256"), Value: aws.String(cert.FingerprintSHA256)},
+				))
+			}
+		}
+		datum("Certificates", float64(len(ts.Certificates)), types.StandardUnitCount, dimensions)
+		datum("ExpiredCertificates", float64(expired), types.StandardUnitCount, dimensions)
+		if !earliest.IsZero() {
+			datum("DaysToEarliestExpiry", days(earliest.Sub(s.Time)), types.StandardUnitNone, dimensions)
+		}
+	}
+	return data
+}
+
+// days returns a duration in days.
+func days(d time.Duration) float64 {
+	return float64(d) / float64(day)
+}
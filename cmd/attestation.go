@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/panubo/elb-trust-store-exporter/attestation"
+	"github.com/panubo/elb-trust-store-exporter/collector"
+	"go.yaml.in/yaml/v2"
+)
+
+// newAttestationSigner returns the signer configured by the attestation flags,
+// or nil if attestations are not enabled.
+func newAttestationSigner(ctx context.Context, opts collector.Options) (attestation.Signer, error) {
+	switch {
+	case CLI.AttestationHMACKeyFile != "" && CLI.AttestationKMSKeyID != "":
+		return nil, errors.New("only one of --attestation.hmac-key-file and --attestation.kms-key-id can be set")
+	case CLI.AttestationHMACKeyFile != "":
+		key, err := os.ReadFile(CLI.AttestationHMACKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return attestation.NewHMACSigner([]byte(strings.TrimSpace(string(key))))
+	case CLI.AttestationKMSKeyID != "":
+		awsCfg, err := collector.LoadAWSConfig(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		return attestation.NewKMSSigner(kms.NewFromConfig(awsCfg), CLI.AttestationKMSKeyID, CLI.AttestationKMSAlgorithm)
+	}
+	return nil, nil
+}
+
+// webAuth is how the web configuration file requires clients to
+// authenticate.
+type webAuth struct {
+	basicAuth          bool
+	clientCertificates bool
+}
+
+// readWebAuth reads how the web configuration file at path requires clients
+// to authenticate.
+func readWebAuth(path string) (webAuth, error) {
+	if path == "" {
+		return webAuth{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return webAuth{}, err
+	}
+	var cfg struct {
+		TLSServerConfig struct {
+			ClientAuthType string `yaml:"client_auth_type"`
+		} `yaml:"tls_server_config"`
+		BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return webAuth{}, err
+	}
+	return webAuth{
+		basicAuth:          len(cfg.BasicAuthUsers) > 0,
+		clientCertificates: cfg.TLSServerConfig.ClientAuthType == "RequireAndVerifyClientCert",
+	}, nil
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// capabilitiesAPIVersion is the version of the JSON APIs under /api/v1.
+const capabilitiesAPIVersion = "v1"
+
+// capability is whether an optional subsystem is enabled, and the version of
+// its behavior, which is increased when it changes incompatibly.
+type capability struct {
+	Enabled bool `json:"enabled"`
+	Version int  `json:"version"`
+}
+
+// capabilities is the response of the capabilities API.
+type capabilities struct {
+	Version      string                `json:"version"`
+	APIVersion   string                `json:"api_version"`
+	Capabilities map[string]capability `json:"capabilities"`
+}
+
+// capabilitiesHandler serves the exporter's version and the subsystems it has
+// enabled, so automation managing a fleet of exporters can adapt to each.
+func capabilitiesHandler(enabled map[string]bool) http.HandlerFunc {
+	resp := capabilities{
+		Version:      Version,
+		APIVersion:   capabilitiesAPIVersion,
+		Capabilities: make(map[string]capability, len(enabled)),
+	}
+	for name, on := range enabled {
+		resp.Capabilities[name] = capability{Enabled: on, Version: 1}
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		log.Fatalf("failed to encode capabilities: %v", err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(data); err != nil {
+			log.Printf("failed to write capabilities: %v", err)
+		}
+	}
+}
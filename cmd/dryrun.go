@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"log"
+	"sort"
+
+	"github.com/panubo/elb-trust-store-exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dryRun performs a single scrape, logs a summary of what would be exported
+// and returns the process exit code.
+func dryRun(opts collector.Options, options ...collector.Option) int {
+	c := collector.NewPassive(opts, options...)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	families, err := reg.Gather()
+	if err != nil {
+		log.Printf("Error gathering metrics: %v", err)
+		return 1
+	}
+
+	series := make(map[string]int, len(families))
+	total := 0
+	for _, mf := range families {
+		series[mf.GetName()] = len(mf.GetMetric())
+		total += len(mf.GetMetric())
+	}
+
+	names := make([]string, 0, len(series))
+	for name := range series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Printf("  %-60s %d series", name, series[name])
+	}
+
+	// Certificates are counted from the scrape result, as certificate_info
+	// may be disabled or dropped by the series limit.
+	snapshot, _, success := c.Result()
+	certificates := 0
+	for _, ts := range snapshot.TrustStores {
+		certificates += len(ts.Certificates)
+	}
+	log.Printf(
+		"Dry run: %d trust stores monitored, %d certificates parsed, %d series in total",
+		len(snapshot.TrustStores),
+		certificates,
+		total,
+	)
+
+	if !success {
+		log.Print("Dry run: scrape was not successful")
+		return 1
+	}
+	return 0
+}
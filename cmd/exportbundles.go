@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/collector"
+)
+
+// exportBundlesTimeout is how long downloading every bundle may take.
+const exportBundlesTimeout = 10 * time.Minute
+
+// exportBundlesCmd is the export-bundles command.
+type exportBundlesCmd struct {
+	Directory string `kong:"arg,help='Directory to write the bundles to, created if it does not exist.'"`
+}
+
+// exportBundles downloads the CA certificates bundle and revocation lists of
+// every monitored trust store to dir and returns the process exit code. Each
+// trust store's bundle is written to <name>.pem, and each of its revocation
+// lists to <name>.revocation-<id>.crl, as uploaded.
+func exportBundles(dir string, opts collector.Options, options ...collector.Option) int {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("Error creating %s: %v", dir, err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportBundlesTimeout)
+	defer cancel()
+	exported := 0
+	failures, err := collector.NewPassive(opts, options...).Bundles(ctx, func(b collector.Bundle) error {
+		path := filepath.Join(dir, b.Name+".pem")
+		if err := os.WriteFile(path, b.PEM, 0o644); err != nil {
+			return err
+		}
+		for _, rl := range b.RevocationLists {
+			path := filepath.Join(dir, fmt.Sprintf("%s.revocation-%d.crl", b.Name, rl.ID))
+			if err := os.WriteFile(path, rl.Data, 0o644); err != nil {
+				return err
+			}
+		}
+		log.Printf("Exported %s with %d revocation lists", b.ARN, len(b.RevocationLists))
+		exported++
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error exporting bundles: %v", err)
+		return 1
+	}
+	for _, f := range failures {
+		log.Printf("Error exporting %s: %s", f.ARN, f.Error)
+	}
+	log.Printf("Exported %d trust stores to %s", exported, dir)
+	if len(failures) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/authz"
+)
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<html>
+<head>
+<title>AWS ELB Trust Store Exporter</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.failed { color: #b00; }
+</style>
+</head>
+<body>
+<h1>AWS ELB Trust Store Exporter</h1>
+<p>{{if .MetricsPath}}<a href="{{.MetricsPath}}">Metrics</a> · {{end}}<a href="/api/v1/truststores">Trust stores (JSON)</a> · <a href="/healthz">Health</a></p>
+<p>Version {{.Version}}</p>
+{{if eq .Generation 0 -}}
+<p>No scrape has completed yet.</p>
+{{- else -}}
+<p>Last scrape: {{.Time.UTC.Format "2006-01-02 15:04:05 MST"}} ({{.Age}} ago),
+{{if .Success}}successful{{else}}<span class="failed">failed</span>{{end}}.</p>
+<table>
+<tr><th>Trust store</th><th>ARN</th><th>Status</th><th>Certificates</th><th>Next expiry</th></tr>
+{{range .TrustStores -}}
+<tr>
+<td>{{.Name}}</td>
+<td>{{.ARN}}</td>
+{{if .Error}}<td class="failed" title="{{.Error}}">failed</td><td></td><td></td>
+{{- else}}<td>ok</td><td>{{.Certificates}}</td><td>{{if not .NextExpiry.IsZero}}{{.NextExpiry.UTC.Format "2006-01-02"}}{{end}}</td>{{end}}
+</tr>
+{{end -}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+// landingTrustStore is a row of the landing page's trust store table.
+type landingTrustStore struct {
+	Name         string
+	ARN          string
+	Error        string
+	Certificates int
+	NextExpiry   time.Time
+}
+
+// landingPage is the data rendered by landingTemplate.
+type landingPage struct {
+	MetricsPath string
+	Version     string
+	Generation  uint64
+	Success     bool
+	Time        time.Time
+	Age         time.Duration
+	TrustStores []landingTrustStore
+}
+
+// landingHandler serves an HTML page summarizing the latest scrape of the
+// reloader's collector, as a quick health check for operators, listing the
+// trust stores the request is authorized for. metricsPath is empty if metrics
+// are not served.
+func landingHandler(r *reloader, metricsPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		snapshot, generation, success := r.Result()
+		page := landingPage{
+			MetricsPath: metricsPath,
+			Version:     Version,
+			Generation:  generation,
+			Success:     success,
+			Time:        snapshot.Time,
+			Age:         time.Since(snapshot.Time).Round(time.Second),
+		}
+		for _, ts := range snapshot.TrustStores {
+			if !authz.Allowed(req.Context(), ts.ARN) {
+				continue
+			}
+			row := landingTrustStore{Name: ts.Name, ARN: ts.ARN, Certificates: len(ts.Certificates)}
+			for _, cert := range ts.Certificates {
+				if row.NextExpiry.IsZero() || cert.NotAfter.Before(row.NextExpiry) {
+					row.NextExpiry = cert.NotAfter
+				}
+			}
+			page.TrustStores = append(page.TrustStores, row)
+		}
+		for _, ts := range snapshot.FailedTrustStores {
+			if !authz.Allowed(req.Context(), ts.ARN) {
+				continue
+			}
+			page.TrustStores = append(page.TrustStores, landingTrustStore{Name: ts.Name, ARN: ts.ARN, Error: ts.Error})
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := landingTemplate.Execute(w, page); err != nil {
+			log.Printf("failed to write response: %v", err)
+		}
+	}
+}
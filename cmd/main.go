@@ -4,16 +4,48 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/http/pprof"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kong"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/panubo/elb-trust-store-exporter/attestation"
+	"github.com/panubo/elb-trust-store-exporter/authz"
+	"github.com/panubo/elb-trust-store-exporter/cloudwatch"
 	"github.com/panubo/elb-trust-store-exporter/collector"
+	"github.com/panubo/elb-trust-store-exporter/configfile"
+	"github.com/panubo/elb-trust-store-exporter/events"
+	"github.com/panubo/elb-trust-store-exporter/fanout"
+	"github.com/panubo/elb-trust-store-exporter/history"
+	"github.com/panubo/elb-trust-store-exporter/internal/fakeaws"
+	"github.com/panubo/elb-trust-store-exporter/inventory"
+	"github.com/panubo/elb-trust-store-exporter/kube"
+	"github.com/panubo/elb-trust-store-exporter/leader"
+	"github.com/panubo/elb-trust-store-exporter/notify"
+	"github.com/panubo/elb-trust-store-exporter/operator"
+	"github.com/panubo/elb-trust-store-exporter/remotewrite"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	promconfig "github.com/prometheus/common/config"
+	"github.com/prometheus/exporter-toolkit/web"
 )
 
+// shutdownTimeout is how long in-flight requests are given to complete when
+// the exporter is stopped.
+const shutdownTimeout = 30 * time.Second
+
+// lookbackDelta is the default Prometheus lookback delta, after which a
+// timestamped sample is no longer returned by queries.
+const lookbackDelta = 5 * time.Minute
+
 var (
 	Version string
 	Commit  string
@@ -22,16 +54,99 @@ var (
 )
 
 var CLI struct {
-	ListenAddress  string           `kong:"name='web.listen-address',default=':9180',help='Address to listen on for web interface and telemetry.'"`
-	MetricsPath    string           `kong:"name='web.metrics-path',default='/metrics',help='Path under which to expose metrics.'"`
-	Region         string           `kong:"name='region',optional,help='AWS region to query. If not specified, the region will be auto-discovered.'"`
-	QueryInterval  string           `kong:"name='query-interval',default='60m',help='Interval at which to query the AWS API.'"`
-	TrustStoreARNs []string         `kong:"name='trust-store-arns',optional,help='A comma-separated list of ELB trust store ARNs to monitor.'"`
-	Version        kong.VersionFlag `kong:"name='version',short='v',help='Print version information and exit.'"`
+	ListenAddress              string           `kong:"name='web.listen-address',default=':9180',help='Address to listen on for web interface and telemetry.'"`
+	MetricsPath                string           `kong:"name='web.metrics-path',default='/metrics',help='Path under which to expose metrics.'"`
+	EnablePprof                bool             `kong:"name='web.enable-pprof',help='Expose Go profiling endpoints under /debug/pprof/, requiring an admin token if --api.tokens-file is set.'"`
+	WebConfigFile              string           `kong:"name='web.config.file',optional,help='Path to a configuration file that can enable TLS or authentication. See https://github.com/prometheus/exporter-toolkit/blob/master/docs/web-configuration.md'"`
+	ConfigFile                 string           `kong:"name='config.file',optional,help='Path, s3://bucket/key or appconfig://application/environment/profile location of a YAML configuration file.'"`
+	ConfigRefreshInterval      string           `kong:"name='config.refresh-interval',default='5m',help='Interval at which to check the configuration file for changes.'"`
+	Region                     string           `kong:"name='region',optional,help='AWS region to query. If not specified, the region will be auto-discovered.'"`
+	AWSProfile                 string           `kong:"name='aws-profile',optional,env='AWS_PROFILE',help='Named profile from the shared AWS configuration files to load credentials and settings from.'"`
+	QueryInterval              string           `kong:"name='query-interval',default='60m',help='Interval at which to query the AWS API.'"`
+	DiscoveryInterval          string           `kong:"name='discovery-interval',default='0s',help='Interval at which to discover new trust stores, if shorter than the query interval. Zero discovers trust stores on every query.'"`
+	QueryJitter                string           `kong:"name='query-jitter',default='0s',help='Maximum random delay added to every query interval, to spread the queries of exporters started together.'"`
+	CacheTTL                   string           `kong:"name='cache-ttl',default='0s',help='Maximum age of cached data to serve. Zero serves cached data until the next query.'"`
+	MetricTimestamps           bool             `kong:"name='metrics.timestamps',help='Expose trust store and certificate metrics with the time of the query that produced them, so Prometheus treats them as stale once queries stop.'"`
+	RuntimeMetrics             bool             `kong:"name='metrics.runtime',help='Expose the go_* and process_* metrics of the exporter itself, such as memory and garbage collection statistics.'"`
+	OTLPEndpoint               string           `kong:"name='otlp.endpoint',optional,help='Host and port of an OpenTelemetry collector to push metrics to over OTLP/gRPC.'"`
+	OTLPInsecure               bool             `kong:"name='otlp.insecure',help='Connect to the OTLP endpoint without TLS.'"`
+	OTLPInterval               string           `kong:"name='otlp.interval',default='60s',help='Interval at which to push metrics over OTLP.'"`
+	OTLPOnly                   bool             `kong:"name='otlp.only',help='Only push metrics over OTLP, without serving them on the metrics path.'"`
+	RemoteWriteURL             string           `kong:"name='remote-write.url',optional,help='URL of a Prometheus remote write endpoint to push metrics to.'"`
+	RemoteWriteConfigFile      string           `kong:"name='remote-write.config-file',optional,help='Path to a YAML file configuring authentication and TLS for the remote write endpoint, such as basic_auth, authorization, oauth2 and tls_config.'"`
+	RemoteWriteInterval        string           `kong:"name='remote-write.interval',default='60s',help='Interval at which to push metrics with remote write.'"`
+	RemoteWriteLabels          []string         `kong:"name='remote-write.label',optional,help='Label to add to every series pushed with remote write, as name=value. Can be repeated.'"`
+	PushgatewayURL             string           `kong:"name='pushgateway.url',optional,help='URL of a Pushgateway to push the metrics of a single query to, exiting once they are pushed. Useful for scheduled tasks.'"`
+	PushgatewayJob             string           `kong:"name='pushgateway.job',default='elb-trust-store-exporter',help='Job name to push metrics to the Pushgateway under.'"`
+	TextfileDirectory          string           `kong:"name='textfile.directory',optional,help='Directory to write the metrics to after every query, in a .prom file for the node_exporter textfile collector.'"`
+	CloudWatchNamespace        string           `kong:"name='cloudwatch-namespace',optional,help='CloudWatch namespace to publish trust store expiry metrics to with PutMetricData after every scrape.'"`
+	CloudWatchCertificates     bool             `kong:"name='cloudwatch-certificate-metrics',help='Also publish the expiry of every certificate to CloudWatch, with a metric per certificate.'"`
+	ScrapeOnCollect            bool             `kong:"name='scrape-on-collect',help='Query the AWS API when metrics are collected instead of every query interval. Queries are limited to one per cache TTL.'"`
+	DryRun                     bool             `kong:"name='dry-run',help='Query the AWS API once, log a summary of the trust stores, certificates and series that would be exported, and exit.'"`
+	Once                       bool             `kong:"name='once',help='Query the AWS API once, write the metrics to stdout in the Prometheus text format, and exit with a non-zero status if the query failed.'"`
+	Demo                       bool             `kong:"name='demo',help='Serve synthetic trust stores from a built-in fake AWS API instead of querying AWS. Useful for dashboard development.'"`
+	DemoTrustStores            int              `kong:"name='demo.trust-stores',default='3',help='Number of synthetic trust stores to serve in demo mode.'"`
+	DemoCertificates           int              `kong:"name='demo.certificates',default='2',help='Number of synthetic CA certificates in each demo trust store.'"`
+	ExpiryTimeSource           string           `kong:"name='expiry-time-source',enum='scrape,collect',default='scrape',help='Evaluate time-derived certificate metrics at AWS query time (scrape) or at Prometheus collect time (collect).'"`
+	ExpiryWarningThreshold     string           `kong:"name='expiry-warning-threshold',default='720h',help='Time before expiry at which a certificate has warning severity.'"`
+	ExpiryCriticalThreshold    string           `kong:"name='expiry-critical-threshold',default='168h',help='Time before expiry at which a certificate has critical severity.'"`
+	ExpiringThresholds         []string         `kong:"name='expiring-thresholds',default='7d,30d,90d',help='A comma-separated list of times before expiry, in days (30d) or as durations (12h), for which to count the certificates expiring within them in each trust store.'"`
+	AWSMaxAttempts             int              `kong:"name='aws-max-attempts',default='3',help='Maximum number of attempts for each AWS API call, including retries.'"`
+	AWSRetryMode               string           `kong:"name='aws-retry-mode',enum='standard,adaptive',default='standard',help='AWS SDK retry mode (standard or adaptive).'"`
+	AWSUseFIPS                 bool             `kong:"name='aws-use-fips',help='Use the FIPS endpoints of the AWS APIs, as required in GovCloud under a FIPS mandate.'"`
+	AWSUseDualStack            bool             `kong:"name='aws-use-dualstack',help='Use the dual-stack endpoints of the AWS APIs, and of S3 to download CA bundles and revocation lists, for IPv6-only networks.'"`
+	AWSEndpointURL             string           `kong:"name='aws-endpoint-url',optional,help='Endpoint URL to use for all AWS APIs instead of the default, for example http://localhost:4566 for LocalStack.'"`
+	AWSIdentityCheckInterval   string           `kong:"name='aws-identity-check-interval',default='1h',help='Interval at which to check the identity and expiry of the AWS credentials with STS GetCallerIdentity, starting on startup. Zero disables the check.'"`
+	TargetsFile                string           `kong:"name='targets.file',optional,help='Path to a YAML file listing the accounts and regions to monitor, each with its own collector, and the budgets of AWS API requests across them.'"`
+	Operator                   bool             `kong:"name='operator',help='Monitor the trust stores declared by TrustStoreMonitor resources in the Kubernetes cluster the exporter runs in, each with its own collector.'"`
+	OperatorNamespace          string           `kong:"name='operator.namespace',optional,help='Namespace to watch TrustStoreMonitor resources in. Defaults to every namespace.'"`
+	TrustStoreARNs             []string         `kong:"name='trust-store-arns',optional,help='A comma-separated list of ELB trust store ARNs to monitor.'"`
+	TrustStoreARNsSSMParameter string           `kong:"name='trust-store-arns-ssm-parameter',optional,help='Name of an SSM StringList parameter holding trust store ARNs to monitor, read on every query.'"`
+	TrustStoreTags             []string         `kong:"name='trust-store-tags',optional,help='A comma-separated list of AWS tag keys to add as tag_<key> labels to elb_trust_store_info.'"`
+	CertificateInfoLabels      []string         `kong:"name='certificate-info.labels',optional,help='A comma-separated list of the labels to export on elb_trust_store_certificate_info, in addition to trust_store_arn. Defaults to all labels.'"`
+	CertificateInfoDisabled    bool             `kong:"name='certificate-info.disabled',help='Do not export elb_trust_store_certificate_info.'"`
+	CollectListeners           bool             `kong:"name='collect-listeners',help='Collect metrics about the load balancer listeners that use each trust store.'"`
+	CollectAssociations        bool             `kong:"name='collect-associations',help='Count the listeners and load balancers each trust store is associated with, to find unused trust stores.'"`
+	DuplicatesAcrossStores     bool             `kong:"name='duplicates-across-trust-stores',help='Count the certificates in each trust store that are also in another monitored trust store.'"`
+	CollectTargetHealth        bool             `kong:"name='collect-target-health',help='Collect the number of healthy targets behind the load balancers that use each trust store.'"`
+	NotFoundTTL                string           `kong:"name='not-found-ttl',default='6h',help='How long to skip a configured trust store ARN that does not exist before querying it again.'"`
+	IncludeNameRegex           string           `kong:"name='include-name-regex',optional,help='Only monitor trust stores with a name matching this regular expression.'"`
+	ExcludeNameRegex           string           `kong:"name='exclude-name-regex',optional,help='Do not monitor trust stores with a name matching this regular expression.'"`
+	MaxConcurrency             int              `kong:"name='max-concurrency',default='4',help='Maximum number of trust stores to collect in parallel.'"`
+	ShardCount                 int              `kong:"name='shard.count',aliases='shard-count',default='1',help='Number of exporter replicas to shard the monitored trust stores across by consistent hashing of their ARNs.'"`
+	ShardIndex                 int              `kong:"name='shard.index',aliases='shard-index',default='0',help='Index of this replica, from 0 to shard.count - 1.'"`
+	LeaderElectionLock         string           `kong:"name='leader-election.lock',optional,help='Lock to elect the replica that queries the AWS API with, kubernetes://[namespace/]lease or dynamodb://table/lock. Standby replicas serve their last query.'"`
+	LeaderElectionIdentity     string           `kong:"name='leader-election.identity',optional,help='Identity of this replica in leader elections. Defaults to the hostname.'"`
+	LeaderElectionTTL          string           `kong:"name='leader-election.lease-duration',default='15s',help='How long the leader holds the lock without renewing it before a standby replica takes over.'"`
+	ShardVirtualNodes          int              `kong:"name='shard.virtual-nodes',default='128',help='Number of points each replica has on the consistent hash ring. Every replica must use the same value.'"`
+	WarmupDuration             string           `kong:"name='warmup.duration',default='0s',help='Period after startup over which to onboard the monitored trust stores progressively, to avoid API throttling on a cold start. Zero collects every trust store from the first query.'"`
+	WarmupSteps                int              `kong:"name='warmup.steps',default='10',help='Number of equal steps in which trust stores are onboarded during warm-up, querying the AWS API at every step.'"`
+	MaxSeries                  int              `kong:"name='max-series',default='0',help='Maximum number of trust store and certificate series. When exceeded only trust store level metrics are exported. Zero means no limit.'"`
+	RemovedRetentionCycles     int              `kong:"name='removed-retention-cycles',default='3',help='Number of scrapes to report a trust store as removed after it is no longer discovered.'"`
+	RemovedCertRetentionCycles int              `kong:"name='removed-certificate-retention-cycles',default='3',help='Number of scrapes to report a certificate with removed=\"true\" after it disappears from its trust store bundle.'"`
+	AnomalyReplacedPercent     int              `kong:"name='anomaly.replaced-percent',default='50',help='Report a bundle change replacing more than this percentage of the certificates in a trust store as an anomaly. Zero disables the check.'"`
+	StaleMaxAge                string           `kong:"name='stale.max-age',default='0s',help='How long after the last successful query its metrics are served in place of those of failed queries. Zero drops them on the first failure.'"`
+	LastGoodFile               string           `kong:"name='last-good.file',optional,help='Path of a file to save the metrics of every successful query to, served after a restart until a query succeeds.'"`
+	HistoryFile                string           `kong:"name='history.file',optional,help='Path of a file to persist trust store snapshots to, enabling the expiry histogram API.'"`
+	HistoryRetention           string           `kong:"name='history.retention',default='9600h',help='How long to keep trust store snapshots for.'"`
+	AttestationHMACKeyFile     string           `kong:"name='attestation.hmac-key-file',optional,help='Path to a file holding a secret key of at least 32 bytes, enabling trust store attestations signed with HMAC-SHA256.'"`
+	AttestationKMSKeyID        string           `kong:"name='attestation.kms-key-id',optional,help='ID, ARN or alias of an asymmetric KMS signing key, enabling trust store attestations signed with KMS.'"`
+	AttestationKMSAlgorithm    string           `kong:"name='attestation.kms-signing-algorithm',enum='ECDSA_SHA_256,ECDSA_SHA_384,ECDSA_SHA_512,RSASSA_PSS_SHA_256,RSASSA_PSS_SHA_384,RSASSA_PSS_SHA_512,RSASSA_PKCS1_V1_5_SHA_256,RSASSA_PKCS1_V1_5_SHA_384,RSASSA_PKCS1_V1_5_SHA_512',default='ECDSA_SHA_256',help='KMS signing algorithm for attestations, which must be supported by the key.'"`
+	ExportSign                 bool             `kong:"name='export.sign',help='Sign inventory exports with the attestation key, so saved exports are tamper-evident.'"`
+	APITokensFile              string           `kong:"name='api.tokens-file',optional,help='Path to a YAML file of bearer tokens authorizing access to the JSON and admin APIs.'"`
+	NotifyConfigFile           string           `kong:"name='notify.config-file',optional,help='Path to a YAML file configuring notifiers and the events routed to them.'"`
+	EvaluateRules              bool             `kong:"name='rules.builtin',help='Evaluate the built-in alerting rules after every scrape, publishing rule_firing and rule_resolved events for notifications without Prometheus.'"`
+	UpdateCheck                bool             `kong:"name='update-check',help='Periodically check for a newer release of the exporter and report it in elb_trust_store_exporter_update_available. Honours HTTPS_PROXY.'"`
+	UpdateCheckURL             string           `kong:"name='update-check.url',default='${update_check_url}',help='Release endpoint to check for a newer release, returning a JSON object with a tag_name.'"`
+	UpdateCheckInterval        string           `kong:"name='update-check.interval',default='24h',help='Interval at which to check for a newer release.'"`
+	Serve                      struct{}         `kong:"cmd,default='1',help='Query the AWS API and serve the metrics. The default command.'"`
+	ExportBundles              exportBundlesCmd `kong:"cmd,name='export-bundles',help='Download the CA certificates bundle and revocation lists of every monitored trust store to a directory, and exit.'"`
+	Version                    kong.VersionFlag `kong:"name='version',short='v',help='Print version information and exit.'"`
 }
 
 func Run(args []string) {
-	kong.Parse(&CLI,
+	started := time.Now()
+	kctx := kong.Parse(&CLI,
 		kong.Name("elb-trust-store-exporter"),
 		kong.Description("A Prometheus exporter for AWS Elastic Load Balancer (ELB) trust stores."),
 		kong.UsageOnError(),
@@ -46,6 +161,7 @@ func Run(args []string) {
 				Date,
 				BuiltBy,
 			),
+			"update_check_url": defaultUpdateCheckURL,
 		},
 	)
 
@@ -63,43 +179,544 @@ func Run(args []string) {
 	})
 	versionMetric.Set(1)
 	reg.MustRegister(versionMetric)
+	if CLI.RuntimeMetrics {
+		reg.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
 
 	interval, err := time.ParseDuration(CLI.QueryInterval)
 	if err != nil {
 		log.Fatalf("failed to parse query interval: %v", err)
 	}
-	c := collector.New(CLI.Region, CLI.TrustStoreARNs, interval)
-	reg.MustRegister(c)
+	discoveryInterval, err := time.ParseDuration(CLI.DiscoveryInterval)
+	if err != nil {
+		log.Fatalf("failed to parse discovery interval: %v", err)
+	}
+	jitter, err := time.ParseDuration(CLI.QueryJitter)
+	if err != nil {
+		log.Fatalf("failed to parse query jitter: %v", err)
+	}
+	if CLI.MetricTimestamps {
+		queryEvery := interval
+		if discoveryInterval > 0 {
+			queryEvery = min(queryEvery, discoveryInterval)
+		}
+		if queryEvery+jitter >= lookbackDelta {
+			log.Fatalf(
+				"--metrics.timestamps requires queries more often than every %s, as Prometheus stops returning timestamped metrics after that, but the query interval and jitter are %s",
+				lookbackDelta,
+				queryEvery+jitter,
+			)
+		}
+	}
+	cacheTTL, err := time.ParseDuration(CLI.CacheTTL)
+	if err != nil {
+		log.Fatalf("failed to parse cache TTL: %v", err)
+	}
+	notFoundTTL, err := time.ParseDuration(CLI.NotFoundTTL)
+	if err != nil {
+		log.Fatalf("failed to parse not found TTL: %v", err)
+	}
+	warningThreshold, err := time.ParseDuration(CLI.ExpiryWarningThreshold)
+	if err != nil {
+		log.Fatalf("failed to parse expiry warning threshold: %v", err)
+	}
+	criticalThreshold, err := time.ParseDuration(CLI.ExpiryCriticalThreshold)
+	if err != nil {
+		log.Fatalf("failed to parse expiry critical threshold: %v", err)
+	}
+	if criticalThreshold > warningThreshold {
+		log.Fatalf(
+			"expiry critical threshold %s is greater than the expiry warning threshold %s",
+			criticalThreshold,
+			warningThreshold,
+		)
+	}
+	var expiringThresholds []collector.ExpiringThreshold
+	for _, s := range CLI.ExpiringThresholds {
+		threshold, err := collector.ParseExpiringThreshold(s)
+		if err != nil {
+			log.Fatalf("failed to parse expiring thresholds: %v", err)
+		}
+		expiringThresholds = append(expiringThresholds, threshold)
+	}
+	if err := collector.CheckExpiringThresholds(expiringThresholds); err != nil {
+		log.Fatalf("invalid expiring thresholds: %v", err)
+	}
+	if CLI.ShardCount < 1 || CLI.ShardIndex < 0 || CLI.ShardIndex >= CLI.ShardCount {
+		log.Fatalf("shard index %d is not between 0 and shard count %d - 1", CLI.ShardIndex, CLI.ShardCount)
+	}
+	warmupDuration, err := time.ParseDuration(CLI.WarmupDuration)
+	if err != nil {
+		log.Fatalf("failed to parse warm-up duration: %v", err)
+	}
+	staleMaxAge, err := time.ParseDuration(CLI.StaleMaxAge)
+	if err != nil {
+		log.Fatalf("failed to parse stale max age: %v", err)
+	}
+	identityCheckInterval, err := time.ParseDuration(CLI.AWSIdentityCheckInterval)
+	if err != nil {
+		log.Fatalf("failed to parse AWS identity check interval: %v", err)
+	}
+	broker := events.NewBroker()
+	opts := collector.Options{
+		Region:                            CLI.Region,
+		AWSProfile:                        CLI.AWSProfile,
+		TrustStoreARNs:                    CLI.TrustStoreARNs,
+		TrustStoreARNsSSMParameter:        CLI.TrustStoreARNsSSMParameter,
+		TrustStoreTags:                    CLI.TrustStoreTags,
+		CollectListeners:                  CLI.CollectListeners,
+		CollectAssociations:               CLI.CollectAssociations,
+		CollectTargetHealth:               CLI.CollectTargetHealth,
+		CrossStoreDuplicates:              CLI.DuplicatesAcrossStores,
+		DisableCertificateInfo:            CLI.CertificateInfoDisabled,
+		NotFoundTTL:                       notFoundTTL,
+		QueryInterval:                     interval,
+		QueryJitter:                       jitter,
+		DiscoveryInterval:                 discoveryInterval,
+		CacheTTL:                          cacheTTL,
+		MetricTimestamps:                  CLI.MetricTimestamps,
+		ExpiryTimeSource:                  CLI.ExpiryTimeSource,
+		ExpiryWarningThreshold:            warningThreshold,
+		ExpiryCriticalThreshold:           criticalThreshold,
+		EvaluateRules:                     CLI.EvaluateRules,
+		ExpiringThresholds:                expiringThresholds,
+		AWSMaxAttempts:                    CLI.AWSMaxAttempts,
+		AWSRetryMode:                      aws.RetryMode(CLI.AWSRetryMode),
+		AWSUseFIPS:                        CLI.AWSUseFIPS,
+		AWSUseDualStack:                   CLI.AWSUseDualStack,
+		AWSEndpointURL:                    CLI.AWSEndpointURL,
+		IdentityCheckInterval:             identityCheckInterval,
+		MaxConcurrency:                    CLI.MaxConcurrency,
+		ShardCount:                        CLI.ShardCount,
+		ShardIndex:                        CLI.ShardIndex,
+		ShardVirtualNodes:                 CLI.ShardVirtualNodes,
+		WarmupDuration:                    warmupDuration,
+		WarmupSteps:                       CLI.WarmupSteps,
+		WarmupStart:                       started,
+		MaxSeries:                         CLI.MaxSeries,
+		RemovedRetentionCycles:            CLI.RemovedRetentionCycles,
+		RemovedCertificateRetentionCycles: CLI.RemovedCertRetentionCycles,
+		AnomalyReplacedPercent:            CLI.AnomalyReplacedPercent,
+		StaleMaxAge:                       staleMaxAge,
+		LastGoodFile:                      CLI.LastGoodFile,
+		Events:                            broker,
+	}
+	if len(CLI.CertificateInfoLabels) > 0 {
+		if err := collector.CheckCertificateInfoLabels(CLI.CertificateInfoLabels); err != nil {
+			log.Fatalf("invalid certificate info labels: %v", err)
+		}
+		opts.CertificateInfoLabels = CLI.CertificateInfoLabels
+	}
+	if err := collector.CheckTrustStoreTags(CLI.TrustStoreTags); err != nil {
+		log.Fatal(err)
+	}
+	if err := collector.CheckTrustStoreARNs(CLI.TrustStoreARNs); err != nil {
+		log.Fatal(err)
+	}
+	if CLI.IncludeNameRegex != "" {
+		opts.IncludeNameRegex, err = regexp.Compile(CLI.IncludeNameRegex)
+		if err != nil {
+			log.Fatalf("failed to parse include name regex: %v", err)
+		}
+	}
+	if CLI.ExcludeNameRegex != "" {
+		opts.ExcludeNameRegex, err = regexp.Compile(CLI.ExcludeNameRegex)
+		if err != nil {
+			log.Fatalf("failed to parse exclude name regex: %v", err)
+		}
+	}
 
-	http.Handle(CLI.MetricsPath, promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if _, err := w.Write([]byte(`<html>
-			<head><title>AWS ELB Trust Store Exporter</title></head>
-			<body>
-			<h1>AWS ELB Trust Store Exporter</h1>
-			<p><a href="` + CLI.MetricsPath + `">Metrics</a></p>
-			</body>
-			</html>`)); err != nil {
-			log.Printf("failed to write response: %v", err)
+	var collectorOptions []collector.Option
+	if CLI.Demo {
+		demo := fakeaws.NewServer()
+		if err := demo.AddSyntheticTrustStores(fakeaws.SyntheticOptions{
+			TrustStores:               CLI.DemoTrustStores,
+			CertificatesPerTrustStore: CLI.DemoCertificates,
+		}); err != nil {
+			log.Fatalf("failed to create demo trust stores: %v", err)
 		}
-	})
+		log.Printf("Demo mode: serving synthetic trust stores from %s", demo.URL)
+		opts.Region = fakeaws.Region
+		collectorOptions = append(collectorOptions, collector.WithELBClient(demo.ELBClient()))
+	}
 
-	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+	var source configfile.Source
+	if CLI.ConfigFile != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		awsCfg, err := collector.LoadAWSConfig(ctx, opts)
+		cancel()
+		if err != nil {
+			log.Fatalf("failed to load AWS config: %v", err)
+		}
+		source, err = configfile.NewSource(CLI.ConfigFile, awsCfg)
+		if err != nil {
+			log.Fatalf("failed to open configuration file: %v", err)
+		}
+	}
+
+	r := newReloader(opts, CLI.ScrapeOnCollect, source, collectorOptions...)
+	// The single queries below run one collector with opts, not one per
+	// target.
+	if CLI.TargetsFile != "" && (CLI.DryRun || CLI.Once || CLI.PushgatewayURL != "" || kctx.Command() == "export-bundles <directory>") {
+		log.Fatal("--dry-run, --once, --pushgateway.url and export-bundles cannot be used with --targets.file")
+	}
+	if CLI.DryRun {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		opts, _, _, err := r.options(ctx)
+		cancel()
+		if err != nil {
+			log.Fatalf("failed to load configuration: %v", err)
+		}
+		os.Exit(dryRun(opts, collectorOptions...))
+	}
+	if kctx.Command() == "export-bundles <directory>" {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		opts, _, _, err := r.options(ctx)
+		cancel()
+		if err != nil {
+			log.Fatalf("failed to load configuration: %v", err)
+		}
+		os.Exit(exportBundles(CLI.ExportBundles.Directory, opts, collectorOptions...))
+	}
+	if CLI.Once {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		opts, _, _, err := r.options(ctx)
+		cancel()
+		if err != nil {
+			log.Fatalf("failed to load configuration: %v", err)
+		}
+		os.Exit(once(os.Stdout, reg, opts, collectorOptions...))
+	}
+	if CLI.PushgatewayURL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		opts, _, _, err := r.options(ctx)
+		cancel()
+		if err != nil {
+			log.Fatalf("failed to load configuration: %v", err)
+		}
+		os.Exit(pushGateway(CLI.PushgatewayURL, CLI.PushgatewayJob, reg, opts, collectorOptions...))
+	}
+
+	if CLI.CloudWatchNamespace != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		awsCfg, err := collector.LoadAWSConfig(ctx, opts)
+		cancel()
+		if err != nil {
+			log.Fatalf("failed to load AWS config: %v", err)
+		}
+		publisher := cloudwatch.NewPublisher(cloudwatch.NewClient(awsCfg), CLI.CloudWatchNamespace, r, CLI.CloudWatchCertificates)
+		go publisher.Run(broker)
+	}
+
+	notifyDone := make(chan struct{})
+	if CLI.NotifyConfigFile == "" {
+		close(notifyDone)
+	} else {
+		cfg, err := notify.LoadConfig(CLI.NotifyConfigFile)
+		if err != nil {
+			log.Fatalf("failed to load notification configuration: %v", err)
+		}
+		router, err := notify.NewRouter(cfg, func(ctx context.Context) (aws.Config, error) {
+			return collector.LoadAWSConfig(ctx, opts)
+		})
+		if err != nil {
+			log.Fatalf("invalid notification configuration: %v", err)
+		}
+		go func() {
+			router.Run(broker)
+			close(notifyDone)
+		}()
+	}
+
+	var historyStore *history.Store
+	if CLI.HistoryFile != "" {
+		retention, err := time.ParseDuration(CLI.HistoryRetention)
+		if err != nil {
+			log.Fatalf("failed to parse history retention: %v", err)
+		}
+		historyStore, err = history.Open(CLI.HistoryFile, retention)
+		if err != nil {
+			log.Fatalf("failed to open history file: %v", err)
+		}
+		r.collectorOptions = append(r.collectorOptions, collector.WithSnapshotRecorder(historyStore))
+		reg.MustRegister(historyStore)
+	}
+	if CLI.TargetsFile != "" {
+		if historyStore != nil || CLI.LastGoodFile != "" {
+			log.Fatal("--history.file and --last-good.file cannot be used with --targets.file")
+		}
+		cfg, err := fanout.LoadConfig(CLI.TargetsFile)
+		if err != nil {
+			log.Fatalf("failed to load targets: %v", err)
+		}
+		r.targets = cfg.Targets()
+		r.scheduler = fanout.NewScheduler(cfg)
+		reg.MustRegister(r.scheduler)
+		log.Printf("Monitoring %d targets in %d accounts", len(r.targets), len(cfg.Accounts))
+	}
+	var watcher *operator.Watcher
+	if CLI.Operator {
+		if historyStore != nil || CLI.LastGoodFile != "" || CLI.TargetsFile != "" || source != nil {
+			log.Fatal("--history.file, --last-good.file, --targets.file and --config.file cannot be used with --operator")
+		}
+		client, err := kube.InCluster()
+		if err != nil {
+			log.Fatalf("failed to create Kubernetes client: %v", err)
+		}
+		watcher = operator.NewWatcher(client, CLI.OperatorNamespace)
+		r.operator = true
+	}
+	electionCtx, stopElection := context.WithCancel(context.Background())
+	electionDone := make(chan struct{})
+	if CLI.LeaderElectionLock == "" {
+		close(electionDone)
+	} else {
+		ttl, err := time.ParseDuration(CLI.LeaderElectionTTL)
+		if err != nil {
+			log.Fatalf("failed to parse leader election lease duration: %v", err)
+		}
+		identity := CLI.LeaderElectionIdentity
+		if identity == "" {
+			identity, err = os.Hostname()
+			if err != nil {
+				log.Fatalf("failed to get hostname for leader election: %v", err)
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		awsCfg, err := collector.LoadAWSConfig(ctx, opts)
+		cancel()
+		if err != nil {
+			log.Fatalf("failed to load AWS config: %v", err)
+		}
+		lock, err := leader.NewLock(CLI.LeaderElectionLock, awsCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// A replica that becomes the leader queries the AWS API straight away
+		// rather than at its next query interval.
+		elector := leader.NewElector(lock, identity, ttl, func(isLeader bool) {
+			if !isLeader {
+				return
+			}
+			go r.scrape()
+		})
+		ctx, cancel = context.WithTimeout(context.Background(), ttl)
+		elector.Acquire(ctx)
+		cancel()
+		if !elector.IsLeader() {
+			log.Printf("Standing by as %s, %s is held by another replica", identity, lock)
+		}
+		r.collectorOptions = append(r.collectorOptions, collector.WithLeader(elector))
+		reg.MustRegister(elector)
+		go func() {
+			elector.Run(electionCtx)
+			close(electionDone)
+		}()
+	}
+	attestCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	signer, err := newAttestationSigner(attestCtx, opts)
+	cancel()
+	if err != nil {
+		log.Fatalf("failed to configure attestations: %v", err)
+	}
+	auth, err := readWebAuth(CLI.WebConfigFile)
+	if err != nil {
+		log.Fatalf("failed to read web configuration file: %v", err)
+	}
+	var authorizer *authz.Authorizer
+	if CLI.APITokensFile != "" {
+		if auth.basicAuth {
+			log.Fatal("--api.tokens-file cannot be used with basic auth in --web.config.file")
+		}
+		cfg, err := authz.LoadConfig(CLI.APITokensFile)
+		if err != nil {
+			log.Fatalf("failed to load API tokens: %v", err)
+		}
+		authorizer, err = authz.New(cfg)
+		if err != nil {
+			log.Fatalf("invalid API tokens: %v", err)
+		}
+	}
+	if signer != nil && authorizer == nil && !auth.basicAuth && !auth.clientCertificates {
+		log.Fatal("attestations require --api.tokens-file or a --web.config.file that enables basic auth or requires client certificates")
+	}
+	var exportSigner attestation.Signer
+	if CLI.ExportSign {
+		if signer == nil {
+			log.Fatal("--export.sign requires --attestation.hmac-key-file or --attestation.kms-key-id")
+		}
+		exportSigner = signer
+	}
+	updateCtx, stopUpdateCheck := context.WithCancel(context.Background())
+	defer stopUpdateCheck()
+	if CLI.UpdateCheck {
+		updateInterval, err := time.ParseDuration(CLI.UpdateCheckInterval)
+		if err != nil {
+			log.Fatalf("failed to parse update check interval: %v", err)
+		}
+		checker := newUpdateChecker(CLI.UpdateCheckURL, Version)
+		reg.MustRegister(checker)
+		go checker.run(updateCtx, updateInterval)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	err = r.reload(ctx, false)
+	cancel()
+	if err != nil {
+		log.Fatalf("failed to load configuration: %v", err)
+	}
+	reg.MustRegister(r)
+	operatorCtx, stopOperator := context.WithCancel(context.Background())
+	defer stopOperator()
+	if watcher != nil {
+		// Only the latest monitors are reconciled, so a pending update is
+		// replaced rather than holding up the watch.
+		updates := make(chan []operator.TrustStoreMonitor, 1)
+		go r.runReconcile(updates)
+		go watcher.Run(operatorCtx, func(monitors []operator.TrustStoreMonitor) {
+			select {
+			case <-updates:
+			default:
+			}
+			updates <- monitors
+		})
+	}
+	if CLI.TextfileDirectory != "" {
+		if CLI.ScrapeOnCollect || CLI.MetricTimestamps {
+			log.Fatal("--textfile.directory cannot be used with --scrape-on-collect or --metrics.timestamps")
+		}
+		log.Printf("Writing metrics to %s after every query", filepath.Join(CLI.TextfileDirectory, textfileName))
+		go runTextfile(broker, CLI.TextfileDirectory, reg)
+	}
+	if source != nil {
+		refreshInterval, err := time.ParseDuration(CLI.ConfigRefreshInterval)
+		if err != nil {
+			log.Fatalf("failed to parse configuration refresh interval: %v", err)
+		}
+		go r.watch(refreshInterval)
+	}
+	go r.handleSignals()
+
+	stopOTLP := func(context.Context) error { return nil }
+	if CLI.OTLPEndpoint != "" {
+		otlpInterval, err := time.ParseDuration(CLI.OTLPInterval)
+		if err != nil {
+			log.Fatalf("failed to parse OTLP interval: %v", err)
+		}
+		stopOTLP, err = startOTLP(context.Background(), reg, CLI.OTLPEndpoint, CLI.OTLPInsecure, otlpInterval)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Pushing metrics over OTLP to %s every %s", CLI.OTLPEndpoint, otlpInterval)
+	} else if CLI.OTLPOnly {
+		log.Fatal("--otlp.only requires --otlp.endpoint")
+	}
+
+	remoteWriteCtx, stopRemoteWrite := context.WithCancel(context.Background())
+	remoteWriteDone := make(chan struct{})
+	if CLI.RemoteWriteURL == "" {
+		close(remoteWriteDone)
+	} else {
+		remoteWriteInterval, err := time.ParseDuration(CLI.RemoteWriteInterval)
+		if err != nil {
+			log.Fatalf("failed to parse remote write interval: %v", err)
+		}
+		httpConfig := promconfig.DefaultHTTPClientConfig
+		if CLI.RemoteWriteConfigFile != "" {
+			cfg, _, err := promconfig.LoadHTTPConfigFile(CLI.RemoteWriteConfigFile)
+			if err != nil {
+				log.Fatalf("failed to load remote write configuration: %v", err)
+			}
+			httpConfig = *cfg
+		}
+		labels, err := remotewrite.ParseLabels(CLI.RemoteWriteLabels)
+		if err != nil {
+			log.Fatalf("invalid remote write label: %v", err)
+		}
+		client, err := remotewrite.New(CLI.RemoteWriteURL, httpConfig, reg, labels)
+		if err != nil {
+			log.Fatalf("invalid remote write configuration: %v", err)
+		}
+		log.Printf("Pushing metrics with remote write to %s every %s", CLI.RemoteWriteURL, remoteWriteInterval)
+		go func() {
+			client.Run(remoteWriteCtx, remoteWriteInterval)
+			close(remoteWriteDone)
+		}()
+	}
+
+	mux := http.NewServeMux()
+	if !CLI.OTLPOnly {
+		mux.Handle(CLI.MetricsPath, promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	}
+	mux.Handle("/api/v1/events", authorizer.Require(authz.ScopeRead, broker))
+	mux.Handle("/-/reload", authorizer.Require(authz.ScopeAdmin, r))
+	if historyStore != nil {
+		mux.Handle("GET /api/v1/truststores/{arn}/expiry-histogram", authorizer.Require(authz.ScopeRead, historyStore))
+	}
+	mux.Handle("GET /api/v1/truststores", authorizer.Require(authz.ScopeRead, inventory.NewTrustStoresHandler(r)))
+	mux.Handle("GET /api/v1/certificates", authorizer.Require(authz.ScopeRead, inventory.NewCertificatesHandler(r)))
+	mux.Handle("GET /api/v1/inventory/export", authorizer.Require(authz.ScopeRead, inventory.NewExportHandler(r, exportSigner)))
+	if signer != nil {
+		mux.Handle("GET /api/v1/truststores/{arn}/attestation", authorizer.Require(authz.ScopeRead, attestation.NewHandler(r, signer)))
+	}
+	mux.Handle("GET /api/v1/capabilities", authorizer.Require(authz.ScopeRead, capabilitiesHandler(map[string]bool{
+		"revocation_lists":  true,
+		"listeners":         CLI.CollectListeners,
+		"associations":      CLI.CollectAssociations,
+		"target_health":     CLI.CollectTargetHealth,
+		"certificate_info":  !CLI.CertificateInfoDisabled,
+		"event_stream":      true,
+		"notifications":     CLI.NotifyConfigFile != "",
+		"builtin_rules":     CLI.EvaluateRules,
+		"expiry_history":    historyStore != nil,
+		"inventory":         true,
+		"attestations":      signer != nil,
+		"signed_exports":    exportSigner != nil,
+		"api_tokens":        authorizer != nil,
+		"config_file":       source != nil,
+		"config_reload":     true,
+		"sharding":          CLI.ShardCount > 1,
+		"scrape_on_collect": CLI.ScrapeOnCollect,
+		"update_check":      CLI.UpdateCheck,
+		"demo":              CLI.Demo,
+		"pprof":             CLI.EnablePprof,
+		"runtime_metrics":   CLI.RuntimeMetrics,
+		"otlp":              CLI.OTLPEndpoint != "",
+		"cloudwatch":        CLI.CloudWatchNamespace != "",
+		"remote_write":      CLI.RemoteWriteURL != "",
+		"textfile":          CLI.TextfileDirectory != "",
+		"fanout":            CLI.TargetsFile != "",
+		"leader_election":   CLI.LeaderElectionLock != "",
+		"operator":          CLI.Operator,
+	})))
+	if CLI.EnablePprof {
+		mux.Handle("/debug/pprof/", authorizer.Require(authz.ScopeAdmin, http.HandlerFunc(pprof.Index)))
+		mux.Handle("/debug/pprof/cmdline", authorizer.Require(authz.ScopeAdmin, http.HandlerFunc(pprof.Cmdline)))
+		mux.Handle("/debug/pprof/profile", authorizer.Require(authz.ScopeAdmin, http.HandlerFunc(pprof.Profile)))
+		mux.Handle("/debug/pprof/symbol", authorizer.Require(authz.ScopeAdmin, http.HandlerFunc(pprof.Symbol)))
+		mux.Handle("/debug/pprof/trace", authorizer.Require(authz.ScopeAdmin, http.HandlerFunc(pprof.Trace)))
+	}
+	metricsPath := CLI.MetricsPath
+	if CLI.OTLPOnly {
+		metricsPath = ""
+	}
+	mux.Handle("/", authorizer.Require(authz.ScopeRead, landingHandler(r, metricsPath)))
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		if _, err := w.Write([]byte("ok")); err != nil {
 			log.Printf("failed to write healthz response: %v", err)
 		}
 	})
 
-	http.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
 		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 		defer cancel()
 
-		var cfgOpts []func(*config.LoadOptions) error
-		if CLI.Region != "" {
-			cfgOpts = append(cfgOpts, config.WithRegion(CLI.Region))
-		}
-		_, err := config.LoadDefaultConfig(ctx, cfgOpts...)
+		_, err := collector.LoadAWSConfig(ctx, opts)
 		if err != nil {
 			msg := fmt.Sprintf("readiness check failed, unable to load AWS config: %v", err)
 			http.Error(w, msg, http.StatusInternalServerError)
@@ -115,11 +732,50 @@ func Run(args []string) {
 	log.Printf("Starting server on %s", CLI.ListenAddress)
 	server := &http.Server{
 		Addr:         CLI.ListenAddress,
+		Handler:      mux,
 		ReadTimeout:  time.Minute,
 		WriteTimeout: time.Minute,
 		IdleTimeout:  2 * time.Minute,
 	}
-	if err := server.ListenAndServe(); err != nil {
+	systemdSocket := false
+	flags := &web.FlagConfig{
+		WebListenAddresses: &[]string{CLI.ListenAddress},
+		WebSystemdSocket:   &systemdSocket,
+		WebConfigFile:      &CLI.WebConfigFile,
+	}
+	server.RegisterOnShutdown(broker.Close)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- web.ListenAndServe(server, flags, slog.Default())
+	}()
+
+	select {
+	case err := <-serverErr:
 		log.Fatalf("failed to start server: %v", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	log.Print("Shutting down")
+	stopOperator()
+	r.stop()
+	stopElection()
+	<-electionDone
+	stopUpdateCheck()
+	ctx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+	if err := stopOTLP(ctx); err != nil {
+		log.Printf("Error stopping OTLP exporter: %v", err)
 	}
+	stopRemoteWrite()
+	<-remoteWriteDone
+	broker.Close()
+	<-notifyDone
+	log.Print("Shutdown complete")
 }
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"io"
+	"log"
+
+	"github.com/panubo/elb-trust-store-exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// once performs a single scrape, writes its metrics and those of g to w in the
+// Prometheus text format and returns the process exit code.
+func once(w io.Writer, g prometheus.Gatherer, opts collector.Options, options ...collector.Option) int {
+	c := collector.NewPassive(opts, options...)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	families, err := prometheus.Gatherers{g, reg}.Gather()
+	if err != nil {
+		log.Printf("Error gathering metrics: %v", err)
+		return 1
+	}
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			log.Printf("Error writing metrics: %v", err)
+			return 1
+		}
+	}
+
+	if _, _, success := c.Result(); !success {
+		log.Print("Once: scrape was not successful")
+		return 1
+	}
+	return 0
+}
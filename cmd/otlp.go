@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promb "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+)
+
+// startOTLP pushes the metrics gathered from g to an OpenTelemetry collector
+// over OTLP/gRPC every interval. The standard OTEL_EXPORTER_OTLP_* environment
+// variables, such as OTEL_EXPORTER_OTLP_HEADERS, configure the exporter further.
+// The returned function pushes the metrics a final time and stops.
+func startOTLP(
+	ctx context.Context,
+	g prometheus.Gatherer,
+	endpoint string,
+	insecure bool,
+	interval time.Duration,
+) (func(context.Context) error, error) {
+	opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+	exporter, err := otlpmetricgrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("elb-trust-store-exporter"),
+		semconv.ServiceVersion(Version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP resource: %w", err)
+	}
+
+	reader := sdkmetric.NewPeriodicReader(
+		exporter,
+		sdkmetric.WithInterval(interval),
+		sdkmetric.WithProducer(promb.NewMetricProducer(promb.WithGatherer(g))),
+	)
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(res))
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// pushTimeout is how long a push to the Pushgateway may take.
+const pushTimeout = time.Minute
+
+// pushGateway performs a single scrape, pushes its metrics and those of g to
+// the Pushgateway at gatewayURL under job, replacing the job's previous
+// metrics, and returns the process exit code.
+func pushGateway(gatewayURL, job string, g prometheus.Gatherer, opts collector.Options, options ...collector.Option) int {
+	c := collector.NewPassive(opts, options...)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	// The URL may hold basic auth credentials, which are not logged.
+	redacted := gatewayURL
+	if u, err := url.Parse(gatewayURL); err == nil {
+		redacted = u.Redacted()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+	defer cancel()
+	err := push.New(gatewayURL, job).
+		Gatherer(prometheus.Gatherers{g, reg}).
+		PushContext(ctx)
+	if err != nil {
+		log.Printf("Error pushing metrics to %s: %v", redacted, err)
+		return 1
+	}
+
+	snapshot, _, success := c.Result()
+	log.Printf("Pushed metrics of %d trust stores to %s as job %s", len(snapshot.TrustStores), redacted, job)
+	if !success {
+		log.Print("Push: scrape was not successful")
+		return 1
+	}
+	return 0
+}
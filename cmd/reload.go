@@ -0,0 +1,527 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/panubo/elb-trust-store-exporter/collector"
+	"github.com/panubo/elb-trust-store-exporter/configfile"
+	"github.com/panubo/elb-trust-store-exporter/fanout"
+	"github.com/panubo/elb-trust-store-exporter/operator"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// reconcileRetryInterval is the initial delay before reconciling the
+// TrustStoreMonitor resources again after an error, doubling with every
+// further error up to maxReconcileRetryInterval.
+const (
+	reconcileRetryInterval    = 5 * time.Second
+	maxReconcileRetryInterval = 5 * time.Minute
+)
+
+// reloader serves metrics from the current collectors and replaces them with
+// newly built ones whenever the configuration file changes.
+type reloader struct {
+	base             collector.Options
+	scrapeOnCollect  bool
+	source           configfile.Source
+	collectorOptions []collector.Option
+	// targets are the accounts and regions monitored with fan-out, each by
+	// its own collector with requests admitted by scheduler. Without targets
+	// a single collector monitors the account and region of the default AWS
+	// configuration.
+	targets   []fanout.Target
+	scheduler *fanout.Scheduler
+	// operator is set in operator mode, where monitors are the
+	// TrustStoreMonitor resources, each monitored by its own collector.
+	operator bool
+	monitors []operator.TrustStoreMonitor
+
+	mutex   sync.Mutex
+	current atomic.Pointer[collectorSet]
+	opts    collector.Options
+	version string
+	done    chan struct{}
+
+	// generation numbers the results returned by Result, and generations
+	// holds the generation of each collector in the last of them. Both are
+	// guarded by resultMutex.
+	resultMutex sync.Mutex
+	generation  uint64
+	generations map[*collector.Collector]uint64
+
+	configInfo      *prometheus.GaugeVec
+	reloadSuccess   prometheus.Gauge
+	reloadTimestamp prometheus.Gauge
+}
+
+func newReloader(base collector.Options, scrapeOnCollect bool, source configfile.Source, collectorOptions ...collector.Option) *reloader {
+	return &reloader{
+		base:             base,
+		scrapeOnCollect:  scrapeOnCollect,
+		source:           source,
+		collectorOptions: collectorOptions,
+		done:             make(chan struct{}),
+		configInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: collector.Namespace,
+				Subsystem: "exporter",
+				Name:      "config_info",
+				Help:      "A metric with a constant '1' value labeled with the source and version of the loaded configuration file.",
+			},
+			[]string{"source", "version"},
+		),
+		reloadSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: collector.Namespace,
+			Subsystem: "exporter",
+			Name:      "config_last_reload_successful",
+			Help:      "Whether the last configuration reload attempt was successful.",
+		}),
+		reloadTimestamp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: collector.Namespace,
+			Subsystem: "exporter",
+			Name:      "config_last_reload_success_timestamp_seconds",
+			Help:      "The timestamp of the last successful configuration reload.",
+		}),
+	}
+}
+
+// targetCollector is a collector of the current set, with the metrics it
+// exports.
+type targetCollector struct {
+	collector *collector.Collector
+	// key identifies the TrustStoreMonitor and generation the collector was
+	// built for in operator mode.
+	key string
+	// metrics is the collector, with its metrics labeled with the account
+	// and region of its fan-out target if it has one.
+	metrics prometheus.Collector
+}
+
+// collectorSet is the collectors built from a configuration.
+type collectorSet []targetCollector
+
+// Result returns the results of the current collectors, as returned by
+// collector.Collector.Result. With fan-out or operator mode the snapshots of
+// every collector are merged: the time is that of the oldest, and the result
+// is successful if every collector's is. The generation is zero until every
+// collector has completed a scrape, and otherwise increases whenever a
+// collector publishes a result or the collectors are replaced, as rebuilt
+// collectors number their results from 1 again.
+func (r *reloader) Result() (collector.Snapshot, uint64, bool) {
+	set := r.current.Load()
+	if set == nil {
+		return collector.Snapshot{}, 0, false
+	}
+	if len(*set) == 1 {
+		c := (*set)[0].collector
+		snapshot, g, ok := c.Result()
+		if g == 0 {
+			return collector.Snapshot{}, 0, false
+		}
+		return snapshot, r.resultGeneration(map[*collector.Collector]uint64{c: g}), ok
+	}
+
+	var merged collector.Snapshot
+	generations := make(map[*collector.Collector]uint64, len(*set))
+	success := true
+	for _, tc := range *set {
+		snapshot, g, ok := tc.collector.Result()
+		if g == 0 {
+			return collector.Snapshot{}, 0, false
+		}
+		generations[tc.collector] = g
+		success = success && ok
+		if merged.Time.IsZero() || snapshot.Time.Before(merged.Time) {
+			merged.Time = snapshot.Time
+		}
+		merged.TrustStores = append(merged.TrustStores, snapshot.TrustStores...)
+		merged.FailedTrustStores = append(merged.FailedTrustStores, snapshot.FailedTrustStores...)
+	}
+	slices.SortFunc(merged.TrustStores, func(a, b collector.TrustStoreSnapshot) int {
+		return strings.Compare(a.ARN, b.ARN)
+	})
+	slices.SortFunc(merged.FailedTrustStores, func(a, b collector.FailedTrustStore) int {
+		return strings.Compare(a.ARN, b.ARN)
+	})
+	return merged, r.resultGeneration(generations), success
+}
+
+// resultGeneration returns the generation of a result made of the results of
+// collectors with the given generations, a new one unless they are those of
+// the last result.
+func (r *reloader) resultGeneration(generations map[*collector.Collector]uint64) uint64 {
+	r.resultMutex.Lock()
+	defer r.resultMutex.Unlock()
+	if !maps.Equal(generations, r.generations) {
+		r.generation++
+		r.generations = generations
+	}
+	return r.generation
+}
+
+// scrape makes every current collector query the AWS API straight away,
+// keeping the state they track between scrapes.
+func (r *reloader) scrape() {
+	set := r.current.Load()
+	if set == nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, tc := range *set {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tc.collector.Scrape()
+		}()
+	}
+	wg.Wait()
+}
+
+// Describe sends no descriptors, so the reloader is registered as an
+// unchecked collector and the collector it delegates to can be replaced.
+func (r *reloader) Describe(chan<- *prometheus.Desc) {}
+
+func (r *reloader) Collect(ch chan<- prometheus.Metric) {
+	if set := r.current.Load(); set != nil {
+		for _, tc := range *set {
+			tc.metrics.Collect(ch)
+		}
+	}
+	if r.source != nil {
+		r.configInfo.Collect(ch)
+		r.reloadSuccess.Collect(ch)
+		r.reloadTimestamp.Collect(ch)
+	}
+}
+
+// reload reads the configuration file and, if it changed or force is set,
+// builds new collectors from it and swaps them in. Without a configuration
+// file the collectors are built from the command-line options.
+func (r *reloader) reload(ctx context.Context, force bool) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	select {
+	case <-r.done:
+		return errors.New("exporter is shutting down")
+	default:
+	}
+
+	opts, version, changed, err := r.options(ctx)
+	if err != nil {
+		r.reloadSuccess.Set(0)
+		return err
+	}
+	if !changed {
+		if r.current.Load() != nil && !force {
+			return nil
+		}
+		opts, version = r.opts, r.version
+	}
+	set, err := r.build(ctx, opts, nil)
+	if err != nil {
+		r.reloadSuccess.Set(0)
+		return err
+	}
+	r.opts, r.version = opts, version
+	if old := r.current.Swap(&set); old != nil {
+		old.stop(nil)
+	}
+
+	if r.source != nil {
+		r.configInfo.Reset()
+		r.configInfo.WithLabelValues(r.source.String(), version).Set(1)
+		r.reloadSuccess.Set(1)
+		r.reloadTimestamp.SetToCurrentTime()
+	}
+	return nil
+}
+
+// reconcile replaces the monitors of operator mode, building collectors for
+// those that are new or changed and stopping those of the monitors that were
+// changed or deleted. The collectors of the other monitors are kept.
+func (r *reloader) reconcile(ctx context.Context, monitors []operator.TrustStoreMonitor) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	select {
+	case <-r.done:
+		return errors.New("exporter is shutting down")
+	default:
+	}
+
+	set, err := r.buildMonitors(ctx, r.opts, monitors, r.current.Load())
+	if err != nil {
+		return err
+	}
+	r.monitors = monitors
+	if old := r.current.Swap(&set); old != nil {
+		old.stop(set)
+	}
+	log.Printf("Monitoring %d TrustStoreMonitor resources", len(set))
+	return nil
+}
+
+// runReconcile reconciles the collectors with the latest monitors received
+// from updates until the reloader is stopped. After an error it retries with
+// exponential backoff until it succeeds or newer monitors are received.
+func (r *reloader) runReconcile(updates <-chan []operator.TrustStoreMonitor) {
+	var (
+		monitors []operator.TrustStoreMonitor
+		retry    <-chan time.Time
+		backoff  time.Duration
+	)
+	for {
+		select {
+		case monitors = <-updates:
+			backoff = 0
+		case <-retry:
+		case <-r.done:
+			return
+		}
+
+		retry = nil
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		err := r.reconcile(ctx, monitors)
+		cancel()
+		if err != nil {
+			backoff = min(max(2*backoff, reconcileRetryInterval), maxReconcileRetryInterval)
+			log.Printf("Error reconciling TrustStoreMonitor resources, retrying in %s: %v", backoff, err)
+			retry = time.After(backoff)
+		}
+	}
+}
+
+// build returns the collectors for the options: one for each TrustStoreMonitor
+// in operator mode or for each fan-out target, built concurrently as each
+// scrapes on creation, or a single collector. In operator mode the collectors
+// of unchanged monitors in previous are reused.
+func (r *reloader) build(ctx context.Context, opts collector.Options, previous *collectorSet) (collectorSet, error) {
+	if r.operator {
+		return r.buildMonitors(ctx, opts, r.monitors, previous)
+	}
+	if len(r.targets) == 0 {
+		c := r.newCollector(opts, r.collectorOptions)
+		return collectorSet{{collector: c, metrics: c}}, nil
+	}
+	if len(opts.TrustStoreARNs) > 0 || opts.TrustStoreARNsSSMParameter != "" {
+		return nil, errors.New("trust store ARNs cannot be configured with --targets.file, as each target monitors the trust stores of its account and region")
+	}
+
+	base, err := collector.LoadAWSConfig(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	set := make(collectorSet, len(r.targets))
+	var wg sync.WaitGroup
+	for i, t := range r.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			o := opts
+			o.Region = t.Region
+			c := r.newCollector(o, append(
+				slices.Clip(r.collectorOptions),
+				collector.WithAWSConfig(r.scheduler.AWSConfig(base, t)),
+			))
+			set[i] = targetCollector{
+				collector: c,
+				metrics: prometheus.WrapCollectorWith(
+					prometheus.Labels{"aws_account": t.Account, "aws_region": t.Region},
+					c,
+				),
+			}
+		}()
+	}
+	wg.Wait()
+	return set, nil
+}
+
+func (r *reloader) newCollector(opts collector.Options, options []collector.Option) *collector.Collector {
+	if r.scrapeOnCollect {
+		return collector.NewPassive(opts, options...)
+	}
+	return collector.New(opts, options...)
+}
+
+// buildMonitors returns a collector for each TrustStoreMonitor, reusing the
+// collector in previous of each monitor whose spec is unchanged. A monitor
+// with an invalid spec is logged and skipped.
+func (r *reloader) buildMonitors(
+	ctx context.Context,
+	opts collector.Options,
+	monitors []operator.TrustStoreMonitor,
+	previous *collectorSet,
+) (collectorSet, error) {
+	reuse := make(map[string]targetCollector)
+	if previous != nil {
+		for _, tc := range *previous {
+			reuse[tc.key] = tc
+		}
+	}
+
+	var base *aws.Config
+	set := make(collectorSet, 0, len(monitors))
+	var wg sync.WaitGroup
+	for _, m := range monitors {
+		if tc, ok := reuse[m.Key()]; ok {
+			set = append(set, tc)
+			continue
+		}
+		o := opts
+		if err := m.Apply(&o); err != nil {
+			log.Printf("Ignoring TrustStoreMonitor %s: %v", &m, err)
+			continue
+		}
+		if base == nil {
+			cfg, err := collector.LoadAWSConfig(ctx, opts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load AWS config: %w", err)
+			}
+			base = &cfg
+		}
+
+		// set has room for every monitor, so tc stays valid as more are
+		// appended.
+		set = append(set, targetCollector{key: m.Key()})
+		tc := &set[len(set)-1]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := r.newCollector(o, append(
+				slices.Clip(r.collectorOptions),
+				collector.WithAWSConfig(m.AWSConfig(*base, o.Region)),
+			))
+			tc.collector = c
+			tc.metrics = prometheus.WrapCollectorWith(
+				prometheus.Labels{"monitor_namespace": m.Metadata.Namespace, "monitor": m.Metadata.Name},
+				c,
+			)
+		}()
+	}
+	wg.Wait()
+	return set, nil
+}
+
+// stop stops every collector in the set that is not also in keep.
+func (s collectorSet) stop(keep collectorSet) {
+	for _, tc := range s {
+		if !slices.ContainsFunc(keep, func(k targetCollector) bool { return k.collector == tc.collector }) {
+			tc.collector.Stop()
+		}
+	}
+}
+
+// options returns the command-line options overridden by the configuration
+// file, and whether the configuration file changed since it was last read.
+func (r *reloader) options(ctx context.Context) (opts collector.Options, version string, changed bool, err error) {
+	opts = r.base
+	if r.source == nil {
+		return opts, "", true, nil
+	}
+
+	data, version, err := r.source.Fetch(ctx)
+	if err != nil {
+		return opts, "", false, fmt.Errorf("failed to read configuration from %s: %w", r.source, err)
+	}
+	if data == nil {
+		return opts, version, false, nil
+	}
+
+	cfg, err := configfile.Parse(data)
+	if err != nil {
+		return opts, "", false, fmt.Errorf("failed to parse configuration from %s: %w", r.source, err)
+	}
+	if err := cfg.Apply(&opts); err != nil {
+		return opts, "", false, fmt.Errorf("invalid configuration from %s: %w", r.source, err)
+	}
+	log.Printf("Loaded configuration version %q from %s", version, r.source)
+	return opts, version, true, nil
+}
+
+// watch reloads the configuration file every interval until the reloader is
+// stopped.
+func (r *reloader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if err := r.reload(ctx, false); err != nil {
+				log.Printf("Error reloading configuration: %v", err)
+			}
+			cancel()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// ServeHTTP handles requests to reload the configuration and rebuild the
+// collector.
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "reload requires a POST request", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.reload(req.Context(), true); err != nil {
+		msg := fmt.Sprintf("failed to reload configuration: %v", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		log.Print(msg)
+		return
+	}
+	if _, err := w.Write([]byte("ok")); err != nil {
+		log.Printf("failed to write reload response: %v", err)
+	}
+}
+
+// handleSignals reloads the configuration and rebuilds the collector every
+// time the process receives SIGHUP.
+func (r *reloader) handleSignals() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-hup:
+			log.Print("Received SIGHUP, reloading configuration")
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if err := r.reload(ctx, true); err != nil {
+				log.Printf("Error reloading configuration: %v", err)
+			}
+			cancel()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// stop ends configuration watching and stops the current collectors, waiting
+// for any in-flight scrape to be cancelled.
+func (r *reloader) stop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	close(r.done)
+	if set := r.current.Load(); set != nil {
+		set.stop(nil)
+	}
+}
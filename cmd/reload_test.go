@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/collector"
+	"github.com/panubo/elb-trust-store-exporter/internal/fakeaws"
+)
+
+// TestReloaderResultGeneration replaces the collector of one monitor and
+// checks the merged result gets a new generation, although the replacement
+// numbers its results from 1 again and the oldest snapshot time is unchanged.
+func TestReloaderResultGeneration(t *testing.T) {
+	s := fakeaws.NewServer()
+	t.Cleanup(s.Close)
+	if err := s.AddSyntheticTrustStores(fakeaws.SyntheticOptions{TrustStores: 2, CertificatesPerTrustStore: 1}); err != nil {
+		t.Fatal(err)
+	}
+	newCollector := func(arns ...string) targetCollector {
+		c := collector.New(collector.Options{
+			QueryInterval:  time.Hour,
+			MaxConcurrency: 1,
+			TrustStoreARNs: arns,
+		}, collector.WithELBClient(s.ELBClient()))
+		t.Cleanup(c.Stop)
+		return targetCollector{collector: c, metrics: c}
+	}
+	first := fakeaws.TrustStoreARN("demo-001")
+	second := fakeaws.TrustStoreARN("demo-002")
+
+	r := newReloader(collector.Options{}, false, nil)
+	set := collectorSet{newCollector(first), newCollector(second)}
+	r.current.Store(&set)
+	before, generation, _ := r.Result()
+	if generation == 0 {
+		t.Fatal("got generation 0 after every collector scraped")
+	}
+	if _, again, _ := r.Result(); again != generation {
+		t.Errorf("got generation %d for an unchanged result, want %d", again, generation)
+	}
+	if got := len(before.TrustStores); got != 2 {
+		t.Fatalf("got %d trust stores, want 2", got)
+	}
+
+	// The monitor of the second trust store is changed to monitor both.
+	replaced := collectorSet{set[0], newCollector(first, second)}
+	r.current.Store(&replaced)
+	after, next, _ := r.Result()
+	if got := len(after.TrustStores); got != 3 {
+		t.Fatalf("got %d trust stores after replacing a monitor, want 3", got)
+	}
+	if !after.Time.Equal(before.Time) {
+		t.Fatalf("got snapshot time %s after replacing a monitor, want the oldest %s", after.Time, before.Time)
+	}
+	if next <= generation {
+		t.Errorf("got generation %d after replacing a monitor, want more than %d", next, generation)
+	}
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/panubo/elb-trust-store-exporter/events"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// textfileName is the name of the file written to the textfile directory.
+const textfileName = "elb_trust_store_exporter.prom"
+
+// runTextfile writes the metrics of g to a file in dir for node_exporter's
+// textfile collector, once on start and then after each scrape_completed event
+// from the broker, until the broker is closed. The file is replaced
+// atomically, so the textfile collector never reads a partial file.
+func runTextfile(broker *events.Broker, dir string, g prometheus.Gatherer) {
+	ch, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+
+	path := filepath.Join(dir, textfileName)
+	write := func() {
+		if err := prometheus.WriteToTextfile(path, g); err != nil {
+			log.Printf("Error writing metrics to %s: %v", path, err)
+		}
+	}
+	write()
+	for e := range ch {
+		if e.Type == events.ScrapeCompleted {
+			write()
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultUpdateCheckURL is the release endpoint checked for new versions.
+const defaultUpdateCheckURL = "https://api.github.com/repos/panubo/elb-trust-store-exporter/releases/latest"
+
+// updateChecker periodically fetches the latest release and reports whether it
+// is newer than the running version.
+type updateChecker struct {
+	url     string
+	version string
+	client  *http.Client
+
+	mutex  sync.Mutex
+	latest string
+
+	updateAvailable *prometheus.Desc
+}
+
+func newUpdateChecker(url, version string) *updateChecker {
+	return &updateChecker{
+		url:     url,
+		version: version,
+		// The default transport honours HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+		client: &http.Client{Timeout: 30 * time.Second},
+		updateAvailable: prometheus.NewDesc(
+			prometheus.BuildFQName(collector.Namespace, "exporter", "update_available"),
+			"Whether a newer release of the exporter than the running version is available.",
+			[]string{"latest_version"},
+			nil,
+		),
+	}
+}
+
+func (u *updateChecker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- u.updateAvailable
+}
+
+func (u *updateChecker) Collect(ch chan<- prometheus.Metric) {
+	u.mutex.Lock()
+	latest := u.latest
+	u.mutex.Unlock()
+	if latest == "" {
+		return
+	}
+
+	available := 0.0
+	if newerVersion(latest, u.version) {
+		available = 1
+	}
+	ch <- prometheus.MustNewConstMetric(u.updateAvailable, prometheus.GaugeValue, available, latest)
+}
+
+// run checks for a new release straight away and then every interval until ctx
+// is cancelled.
+func (u *updateChecker) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := u.check(ctx); err != nil {
+			log.Printf("Error checking for updates: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check fetches the latest release from the release endpoint.
+func (u *updateChecker) check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "elb-trust-store-exporter/"+u.version)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, u.url)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return fmt.Errorf("failed to decode release from %s: %w", u.url, err)
+	}
+	if release.TagName == "" {
+		return fmt.Errorf("release from %s has no tag_name", u.url)
+	}
+
+	u.mutex.Lock()
+	u.latest = release.TagName
+	u.mutex.Unlock()
+	return nil
+}
+
+// newerVersion reports whether version a is newer than version b, comparing
+// the dot-separated numeric components of each with any leading "v" and any
+// pre-release or build suffix removed. A running version that cannot be
+// parsed, such as a development build, is never reported as outdated.
+func newerVersion(a, b string) bool {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	if !okA || !okB {
+		return false
+	}
+	for i := range max(len(va), len(vb)) {
+		var x, y int
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
+
+func parseVersion(s string) ([]int, bool) {
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	if s == "" {
+		return nil, false
+	}
+	var parts []int
+	for _, p := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, true
+}
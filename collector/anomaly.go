@@ -0,0 +1,132 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/events"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Types of bundle anomaly, reported in the anomaly label of
+// elb_trust_store_bundle_anomaly.
+const (
+	// anomalyReplaced is a change replacing more than AnomalyReplacedPercent
+	// of the certificates in the bundle.
+	anomalyReplaced = "replaced"
+	// anomalyEmptied is a change removing every certificate from the bundle.
+	anomalyEmptied = "emptied"
+	// anomalyExpiriesShortened is a change moving both the earliest and the
+	// latest certificate expiry of the bundle earlier.
+	anomalyExpiriesShortened = "expiries_shortened"
+)
+
+var anomalyTypes = []string{anomalyReplaced, anomalyEmptied, anomalyExpiriesShortened}
+
+// bundleState is the last collected bundle of a trust store and the
+// anomalies found in the change that produced it.
+type bundleState struct {
+	checksum     [sha256.Size]byte
+	fingerprints map[string]struct{}
+	earliest     time.Time
+	latest       time.Time
+	anomalies    map[string]bool
+}
+
+// newBundleState returns the state of the bundle collected in data.
+func newBundleState(data *trustStoreData) *bundleState {
+	state := &bundleState{
+		checksum:     data.bundleChecksum,
+		fingerprints: make(map[string]struct{}, len(data.certificates)),
+		anomalies:    make(map[string]bool),
+	}
+	for _, cert := range data.certificates {
+		state.fingerprints[fingerprint(cert)] = struct{}{}
+		if state.earliest.IsZero() || cert.NotAfter.Before(state.earliest) {
+			state.earliest = cert.NotAfter
+		}
+		if cert.NotAfter.After(state.latest) {
+			state.latest = cert.NotAfter
+		}
+	}
+	return state
+}
+
+// anomalies returns the anomalies in the change from the previous bundle to
+// the current one.
+func (c *Collector) anomalies(previous, current *bundleState) map[string]bool {
+	found := make(map[string]bool)
+	if len(previous.fingerprints) == 0 {
+		return found
+	}
+	if len(current.fingerprints) == 0 {
+		found[anomalyEmptied] = true
+		return found
+	}
+
+	replaced := 0
+	for fp := range previous.fingerprints {
+		if _, ok := current.fingerprints[fp]; !ok {
+			replaced++
+		}
+	}
+	if c.opts.AnomalyReplacedPercent > 0 && replaced*100 > c.opts.AnomalyReplacedPercent*len(previous.fingerprints) {
+		found[anomalyReplaced] = true
+	}
+	if current.earliest.Before(previous.earliest) && current.latest.Before(previous.latest) {
+		found[anomalyExpiriesShortened] = true
+	}
+	return found
+}
+
+// detectAnomalies compares the bundle of each collected trust store with the
+// one from its previous collection, publishing an event for each anomaly in a
+// change, and adds elb_trust_store_bundle_anomaly to its metrics. An anomaly
+// is reported until the bundle changes again. The first collection of a trust
+// store has nothing to compare with and reports no anomalies.
+func (c *Collector) detectAnomalies(results []*trustStoreData) {
+	for _, data := range results {
+		arn := *data.trustStore.TrustStoreArn
+		state := c.bundleStates[arn]
+		if state == nil || state.checksum != data.bundleChecksum {
+			current := newBundleState(data)
+			if state != nil {
+				current.anomalies = c.anomalies(state, current)
+				for _, anomaly := range anomalyTypes {
+					if !current.anomalies[anomaly] {
+						continue
+					}
+					c.publish(events.Event{
+						Type:          events.BundleAnomaly,
+						Severity:      events.SeverityCritical,
+						TrustStoreARN: arn,
+						Data: map[string]any{
+							"anomaly":               anomaly,
+							"previous_certificates": len(state.fingerprints),
+							"certificates":          len(current.fingerprints),
+						},
+					})
+				}
+			}
+			state = current
+			c.bundleStates[arn] = state
+		}
+
+		for _, anomaly := range anomalyTypes {
+			value := 0.0
+			if state.anomalies[anomaly] {
+				value = 1
+			}
+			data.metrics = append(
+				data.metrics,
+				prometheus.MustNewConstMetric(c.bundleAnomaly, prometheus.GaugeValue, value, arn, anomaly),
+			)
+		}
+	}
+
+	for arn := range c.bundleStates {
+		if _, ok := c.seen[arn]; !ok {
+			delete(c.bundleStates, arn)
+		}
+	}
+}
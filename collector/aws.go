@@ -0,0 +1,157 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// LoadAWSConfig loads the AWS SDK configuration for the given options. If no
+// region is configured, the region of the first trust store ARN is used.
+func LoadAWSConfig(ctx context.Context, opts Options) (aws.Config, error) {
+	var cfgOpts []func(*config.LoadOptions) error
+	if opts.Region != "" {
+		cfgOpts = append(cfgOpts, config.WithRegion(opts.Region))
+	}
+	if opts.AWSProfile != "" {
+		cfgOpts = append(cfgOpts, config.WithSharedConfigProfile(opts.AWSProfile))
+	}
+	if opts.AWSMaxAttempts > 0 {
+		cfgOpts = append(cfgOpts, config.WithRetryMaxAttempts(opts.AWSMaxAttempts))
+	}
+	if opts.AWSRetryMode != "" {
+		cfgOpts = append(cfgOpts, config.WithRetryMode(opts.AWSRetryMode))
+	}
+	if opts.AWSUseFIPS {
+		cfgOpts = append(cfgOpts, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+	if opts.AWSUseDualStack {
+		cfgOpts = append(cfgOpts, config.WithUseDualStackEndpoint(aws.DualStackEndpointStateEnabled))
+	}
+	if opts.AWSEndpointURL != "" {
+		cfgOpts = append(cfgOpts, config.WithBaseEndpoint(opts.AWSEndpointURL))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, cfgOpts...)
+	if err == nil && cfg.Region == "" && len(opts.TrustStoreARNs) > 0 {
+		cfg.Region = arnRegion(opts.TrustStoreARNs[0])
+	}
+	return cfg, err
+}
+
+// loadAWSConfig returns the AWS configuration set by WithAWSConfig, or loads
+// it for the collector's options.
+func (c *Collector) loadAWSConfig(ctx context.Context) (aws.Config, error) {
+	if c.awsConfig != nil {
+		return *c.awsConfig, nil
+	}
+	return LoadAWSConfig(ctx, c.opts)
+}
+
+// elbClient returns the ELBv2 client set with WithELBClient, or else one
+// created from the collector's AWS configuration that records API metrics and
+// sends the requests for each ARN to its region.
+func (c *Collector) elbClient(ctx context.Context) (ELBAPI, error) {
+	if c.elb != nil {
+		return c.elb, nil
+	}
+	cfg, err := c.loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	newClient := func(region string) ELBAPI {
+		return elasticloadbalancingv2.NewFromConfig(cfg, func(o *elasticloadbalancingv2.Options) {
+			if region != "" {
+				o.Region = region
+			}
+			o.APIOptions = append(o.APIOptions, c.apiMetrics.addMiddleware)
+		})
+	}
+	return &regionalClient{
+		defaultClient: newClient(""),
+		region:        cfg.Region,
+		newClient:     newClient,
+		clients:       make(map[string]ELBAPI),
+	}, nil
+}
+
+// ELBAPI is the subset of the ELBv2 client used by the collector.
+type ELBAPI interface {
+	elasticloadbalancingv2.DescribeTrustStoresAPIClient
+	elasticloadbalancingv2.DescribeTrustStoreRevocationsAPIClient
+	elasticloadbalancingv2.DescribeTrustStoreAssociationsAPIClient
+	elasticloadbalancingv2.DescribeListenersAPIClient
+	elasticloadbalancingv2.DescribeTargetGroupsAPIClient
+	DescribeTargetHealth(
+		ctx context.Context,
+		params *elasticloadbalancingv2.DescribeTargetHealthInput,
+		optFns ...func(*elasticloadbalancingv2.Options),
+	) (*elasticloadbalancingv2.DescribeTargetHealthOutput, error)
+	GetTrustStoreCaCertificatesBundle(
+		ctx context.Context,
+		params *elasticloadbalancingv2.GetTrustStoreCaCertificatesBundleInput,
+		optFns ...func(*elasticloadbalancingv2.Options),
+	) (*elasticloadbalancingv2.GetTrustStoreCaCertificatesBundleOutput, error)
+	GetTrustStoreRevocationContent(
+		ctx context.Context,
+		params *elasticloadbalancingv2.GetTrustStoreRevocationContentInput,
+		optFns ...func(*elasticloadbalancingv2.Options),
+	) (*elasticloadbalancingv2.GetTrustStoreRevocationContentOutput, error)
+	DescribeTags(
+		ctx context.Context,
+		params *elasticloadbalancingv2.DescribeTagsInput,
+		optFns ...func(*elasticloadbalancingv2.Options),
+	) (*elasticloadbalancingv2.DescribeTagsOutput, error)
+}
+
+// SSMAPI is the subset of the SSM client used to read trust store ARNs.
+type SSMAPI interface {
+	GetParameter(
+		ctx context.Context,
+		params *ssm.GetParameterInput,
+		optFns ...func(*ssm.Options),
+	) (*ssm.GetParameterOutput, error)
+}
+
+// HTTPClient downloads the presigned CA bundle and revocation list locations.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Option customises a Collector beyond its Options.
+type Option func(*Collector)
+
+// WithAWSConfig sets the AWS configuration the collector creates its clients
+// from, instead of loading it for its options.
+func WithAWSConfig(cfg aws.Config) Option {
+	return func(c *Collector) {
+		c.awsConfig = &cfg
+	}
+}
+
+// WithELBClient sets the ELBv2 client used instead of one created from the
+// default AWS configuration.
+func WithELBClient(client ELBAPI) Option {
+	return func(c *Collector) {
+		c.elb = client
+	}
+}
+
+// WithSSMClient sets the SSM client used to read the trust store ARNs
+// parameter instead of one created from the default AWS configuration.
+func WithSSMClient(client SSMAPI) Option {
+	return func(c *Collector) {
+		c.ssm = client
+	}
+}
+
+// WithHTTPClient sets the client used to download CA bundles and revocation
+// lists.
+func WithHTTPClient(client HTTPClient) Option {
+	return func(c *Collector) {
+		c.httpClient = client
+	}
+}
@@ -0,0 +1,157 @@
+package collector
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// cachedBundle is a parsed CA certificates bundle, retained between scrapes so
+// an unchanged bundle is not parsed again.
+type cachedBundle struct {
+	etag         string
+	checksum     [sha256.Size]byte
+	size         int
+	certificates []*x509.Certificate
+	// invalid is the number of certificates in the bundle that could not be
+	// parsed.
+	invalid int
+}
+
+// loadBundle downloads and parses the CA certificates bundle of a trust store.
+// The previous result for the trust store is reused if S3 reports the object
+// as not modified or its checksum is unchanged, in which case cached is true.
+func (c *Collector) loadBundle(
+	ctx context.Context,
+	arn string,
+	location string,
+) (bundle *cachedBundle, cached bool, err error) {
+	c.bundleMutex.Lock()
+	previous := c.bundles[arn]
+	c.bundleMutex.Unlock()
+
+	etag := ""
+	if previous != nil {
+		etag = previous.etag
+	}
+	pemData, respETag, notModified, err := c.fetchIfNoneMatch(ctx, location, etag)
+	if err != nil {
+		return nil, false, err
+	}
+	if notModified && previous != nil {
+		return previous, true, nil
+	}
+
+	checksum := sha256.Sum256(pemData)
+	if previous != nil && previous.checksum == checksum {
+		bundle = &cachedBundle{
+			etag:         respETag,
+			checksum:     checksum,
+			size:         previous.size,
+			certificates: previous.certificates,
+			invalid:      previous.invalid,
+		}
+		cached = true
+	} else {
+		start := time.Now()
+		certificates, invalid := parseBundle(pemData)
+		c.apiMetrics.recordParse("bundle", start)
+		bundle = &cachedBundle{
+			etag:         respETag,
+			checksum:     checksum,
+			size:         len(pemData),
+			certificates: certificates,
+			invalid:      invalid,
+		}
+	}
+
+	c.bundleMutex.Lock()
+	c.bundles[arn] = bundle
+	c.bundleMutex.Unlock()
+
+	return bundle, cached, nil
+}
+
+// parseBundle returns the certificates in a PEM encoded bundle, skipping any
+// that cannot be parsed, and the number skipped.
+func parseBundle(pemData []byte) ([]*x509.Certificate, int) {
+	var (
+		certificates []*x509.Certificate
+		invalid      int
+	)
+	for len(pemData) > 0 {
+		var block *pem.Block
+		block, pemData = pem.Decode(pemData)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			log.Printf("Error parsing certificate: %v", err)
+			invalid++
+			continue
+		}
+		certificates = append(certificates, cert)
+	}
+	return certificates, invalid
+}
+
+// fetch downloads the object at the given (presigned) location.
+func (c *Collector) fetch(ctx context.Context, location string) ([]byte, error) {
+	data, _, _, err := c.fetchIfNoneMatch(ctx, location, "")
+	return data, err
+}
+
+// fetchIfNoneMatch downloads the object at the given (presigned) location
+// unless its ETag matches etag, in which case notModified is true.
+func (c *Collector) fetchIfNoneMatch(
+	ctx context.Context,
+	location string,
+	etag string,
+) (data []byte, respETag string, notModified bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, http.NoBody)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("failed to close response body: %v", err)
+		}
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		c.apiMetrics.recordDownload(0, time.Since(start))
+		return nil, etag, true, nil
+	default:
+		return nil, "", false, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	data, err = io.ReadAll(resp.Body)
+	c.apiMetrics.recordDownload(len(data), time.Since(start))
+	if err != nil {
+		return nil, "", false, err
+	}
+	return data, resp.Header.Get("ETag"), false, nil
+}
@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+)
+
+// signedBy reports whether cert was issued by parent: parent's subject is
+// cert's issuer and cert's signature verifies with parent's key. crypto/x509
+// refuses to verify SHA-1 and MD5 signatures, so for those the names alone are
+// trusted.
+func signedBy(cert, parent *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, parent.RawSubject) {
+		return false
+	}
+	err := parent.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature)
+	var insecure x509.InsecureAlgorithmError
+	return err == nil || errors.As(err, &insecure)
+}
+
+// chainsComplete reports, for each certificate, whether it chains through
+// certificates in the same trust store to a self-signed root in it. A root is
+// complete on its own, while an intermediate whose issuer is missing is not.
+func chainsComplete(certs []*x509.Certificate) []bool {
+	complete := make(map[*x509.Certificate]bool, len(certs))
+	var resolve func(cert *x509.Certificate, visiting map[*x509.Certificate]bool) bool
+	resolve = func(cert *x509.Certificate, visiting map[*x509.Certificate]bool) bool {
+		if result, ok := complete[cert]; ok {
+			return result
+		}
+		if signedBy(cert, cert) {
+			complete[cert] = true
+			return true
+		}
+		// Cross-signed CAs can form cycles, which do not lead to a root.
+		visiting[cert] = true
+		defer delete(visiting, cert)
+		for _, parent := range certs {
+			if parent != cert && !visiting[parent] && signedBy(cert, parent) && resolve(parent, visiting) {
+				complete[cert] = true
+				return true
+			}
+		}
+		return false
+	}
+
+	results := make([]bool, len(certs))
+	for i, cert := range certs {
+		results[i] = resolve(cert, make(map[*x509.Certificate]bool))
+		complete[certs[i]] = results[i]
+	}
+	return results
+}
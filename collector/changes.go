@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"encoding/hex"
+
+	"github.com/panubo/elb-trust-store-exporter/events"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// trackBundleChanges compares the bundle of each collected trust store with
+// the one from its previous collection, counting and publishing an event for
+// each change, and adds the bundle change metrics to its metrics. It must be
+// called before detectAnomalies, which replaces the previous bundles.
+func (c *Collector) trackBundleChanges(results []*trustStoreData) {
+	for _, data := range results {
+		arn := *data.trustStore.TrustStoreArn
+		checksum := hex.EncodeToString(data.bundleChecksum[:])
+
+		added, removed := 0, 0
+		previous := c.bundleStates[arn]
+		if previous != nil && previous.checksum != data.bundleChecksum {
+			current := make(map[string]struct{}, len(data.certificates))
+			for _, cert := range data.certificates {
+				current[fingerprint(cert)] = struct{}{}
+			}
+			for fp := range current {
+				if _, ok := previous.fingerprints[fp]; !ok {
+					added++
+				}
+			}
+			for fp := range previous.fingerprints {
+				if _, ok := current[fp]; !ok {
+					removed++
+				}
+			}
+			c.bundleChangeCounts[arn]++
+			c.publish(events.Event{
+				Type:          events.BundleChanged,
+				Severity:      events.SeverityInfo,
+				TrustStoreARN: arn,
+				Data: map[string]any{
+					"bundle_sha256":          checksum,
+					"previous_bundle_sha256": hex.EncodeToString(previous.checksum[:]),
+					"added":                  added,
+					"removed":                removed,
+				},
+			})
+		}
+
+		data.metrics = append(
+			data.metrics,
+			prometheus.MustNewConstMetric(c.bundleHashInfo, prometheus.GaugeValue, 1, arn, checksum),
+			prometheus.MustNewConstMetric(
+				c.bundleChanges,
+				prometheus.CounterValue,
+				float64(c.bundleChangeCounts[arn]),
+				arn,
+			),
+			prometheus.MustNewConstMetric(c.bundleCertificatesAdded, prometheus.GaugeValue, float64(added), arn),
+			prometheus.MustNewConstMetric(c.bundleCertificatesRemoved, prometheus.GaugeValue, float64(removed), arn),
+		)
+	}
+
+	for arn := range c.bundleChangeCounts {
+		if _, ok := c.seen[arn]; !ok {
+			delete(c.bundleChangeCounts, arn)
+		}
+	}
+}
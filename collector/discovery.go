@@ -0,0 +1,272 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/smithy-go"
+)
+
+// maxDescribeTrustStoreARNs is the maximum number of ARNs accepted by a single
+// DescribeTrustStores request.
+const maxDescribeTrustStoreARNs = 20
+
+// discoverTrustStores returns the trust stores to collect: every trust store
+// in the region, or the configured ARNs that were not recently found missing.
+// Configured ARNs are described in parallel batches of a single region each,
+// and the number of batches is returned. Configured ARNs that cannot be
+// described are recorded in c.targetErrors, and an error is returned only if
+// every batch failed.
+func (c *Collector) discoverTrustStores(ctx context.Context, svc ELBAPI) ([]types.TrustStore, int, error) {
+	c.targetErrors = make(map[string]string)
+	configured, err := c.configuredTrustStoreARNs(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	// An ARN that is no longer configured, for example after the SSM
+	// parameter changed, is no longer reported as not found.
+	maps.DeleteFunc(c.notFound, func(arn string, _ time.Time) bool {
+		return !slices.Contains(configured, arn)
+	})
+	if len(configured) == 0 && c.opts.TrustStoreARNsSSMParameter == "" {
+		trustStores, err := describeTrustStores(ctx, svc, &elasticloadbalancingv2.DescribeTrustStoresInput{})
+		return trustStores, 0, err
+	}
+
+	now := time.Now()
+	var arns []string
+	for _, arn := range configured {
+		if expiry, ok := c.notFound[arn]; ok && now.Before(expiry) {
+			continue
+		}
+		delete(c.notFound, arn)
+		arns = append(arns, arn)
+	}
+	if len(arns) == 0 {
+		return nil, 0, nil
+	}
+
+	batches := chunkByRegion(arns, maxDescribeTrustStoreARNs)
+	results := make([][]types.TrustStore, len(batches))
+	errs := make([]error, len(batches))
+	sem := make(chan struct{}, max(c.opts.MaxConcurrency, 1))
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for i, batch := range batches {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			notFound := func(arn string) {
+				log.Printf("Trust store %s not found, skipping it for %s", arn, c.opts.NotFoundTTL)
+				mu.Lock()
+				c.notFound[arn] = now.Add(c.opts.NotFoundTTL)
+				mu.Unlock()
+			}
+			failed := func(arn string, err error) {
+				log.Printf("Error describing trust store %s: %v", arn, err)
+				mu.Lock()
+				c.targetErrors[arn] = errorCode(err)
+				mu.Unlock()
+			}
+			results[i], errs[i] = describeTrustStoreBatch(ctx, svc, batch, notFound, failed)
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, len(batches), err
+	}
+
+	// A failed batch has its ARNs recorded in c.targetErrors, so discovery
+	// fails only if every batch failed.
+	var (
+		trustStores []types.TrustStore
+		failures    int
+		lastErr     error
+	)
+	for i := range batches {
+		if errs[i] != nil {
+			failures++
+			lastErr = errs[i]
+			continue
+		}
+		trustStores = append(trustStores, results[i]...)
+	}
+	if failures == len(batches) {
+		return nil, len(batches), lastErr
+	}
+	return trustStores, len(batches), nil
+}
+
+// describeTrustStoreBatch describes a batch of trust store ARNs. If the batch
+// fails, for example because one of the ARNs no longer exists or is invalid,
+// each ARN in the batch is described individually so the others are still
+// collected. notFound is called for missing ARNs and failed for ARNs that
+// could not be described for any other reason. An error is returned only if
+// every ARN in the batch failed.
+func describeTrustStoreBatch(
+	ctx context.Context,
+	svc ELBAPI,
+	arns []string,
+	notFound func(arn string),
+	failed func(arn string, err error),
+) ([]types.TrustStore, error) {
+	trustStores, err := describeTrustStores(
+		ctx,
+		svc,
+		&elasticloadbalancingv2.DescribeTrustStoresInput{TrustStoreArns: arns},
+	)
+	if err == nil || ctx.Err() != nil {
+		return trustStores, err
+	}
+	if !isNotFound(err) {
+		log.Printf("Error describing batch of %d trust stores, describing them individually: %v", len(arns), err)
+	}
+
+	var (
+		failures int
+		lastErr  error
+	)
+	trustStores = nil
+	for _, arn := range arns {
+		found, err := describeTrustStores(
+			ctx,
+			svc,
+			&elasticloadbalancingv2.DescribeTrustStoresInput{TrustStoreArns: []string{arn}},
+		)
+		switch {
+		case isNotFound(err):
+			notFound(arn)
+		case ctx.Err() != nil:
+			return nil, err
+		case err != nil:
+			failed(arn, err)
+			failures++
+			lastErr = err
+		default:
+			trustStores = append(trustStores, found...)
+		}
+	}
+	if failures == len(arns) {
+		return nil, lastErr
+	}
+	return trustStores, nil
+}
+
+// configuredTrustStoreARNs returns the explicitly configured trust store
+// ARNs, including those read from the SSM parameter. If the parameter cannot
+// be read, the ARNs last read from it are used. ARNs read from it that are
+// invalid or in another partition are recorded in c.targetErrors instead.
+func (c *Collector) configuredTrustStoreARNs(ctx context.Context) ([]string, error) {
+	if c.opts.TrustStoreARNsSSMParameter == "" {
+		return c.opts.TrustStoreARNs, nil
+	}
+
+	if c.ssm == nil {
+		cfg, err := c.loadAWSConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.ssm = ssm.NewFromConfig(cfg, func(o *ssm.Options) {
+			o.APIOptions = append(o.APIOptions, c.apiMetrics.addMiddleware)
+		})
+	}
+
+	out, err := c.ssm.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(c.opts.TrustStoreARNsSSMParameter),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		if c.ssmARNs == nil {
+			return nil, err
+		}
+		log.Printf(
+			"Error reading SSM parameter %s, using previous value: %v",
+			c.opts.TrustStoreARNsSSMParameter,
+			err,
+		)
+	} else {
+		c.ssmARNs = []string{}
+		for arn := range strings.SplitSeq(aws.ToString(out.Parameter.Value), ",") {
+			if arn = strings.TrimSpace(arn); arn != "" {
+				c.ssmARNs = append(c.ssmARNs, arn)
+			}
+		}
+	}
+
+	arns := slices.Clone(c.opts.TrustStoreARNs)
+	for _, arn := range c.ssmARNs {
+		check := []string{arn}
+		if len(arns) > 0 {
+			check = []string{arns[0], arn}
+		}
+		if err := CheckTrustStoreARNs(check); err != nil {
+			log.Printf("Ignoring trust store ARN from SSM parameter %s: %v", c.opts.TrustStoreARNsSSMParameter, err)
+			c.targetErrors[arn] = invalidARNErrorCode
+			continue
+		}
+		arns = append(arns, arn)
+	}
+	return arns, nil
+}
+
+// describeTrustStores returns every page of DescribeTrustStores results.
+func describeTrustStores(
+	ctx context.Context,
+	svc ELBAPI,
+	input *elasticloadbalancingv2.DescribeTrustStoresInput,
+) ([]types.TrustStore, error) {
+	var trustStores []types.TrustStore
+	paginator := elasticloadbalancingv2.NewDescribeTrustStoresPaginator(svc, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		trustStores = append(trustStores, page.TrustStores...)
+	}
+	return trustStores, nil
+}
+
+// invalidARNErrorCode is the error code recorded for configured trust store
+// ARNs that are invalid.
+const invalidARNErrorCode = "InvalidARN"
+
+// errorCode returns the AWS error code of err, or "unknown" if it is not an
+// AWS API error.
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return "unknown"
+}
+
+func isNotFound(err error) bool {
+	var notFound *types.TrustStoreNotFoundException
+	return errors.As(err, &notFound)
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// downloadTimeout is the timeout of each download of a CA bundle or
+// revocation list.
+const downloadTimeout = 3 * time.Second
+
+// s3HostPattern matches the IPv4-only virtual-hosted and path-style hostnames
+// of S3, capturing the region if present and the domain of the partition.
+var s3HostPattern = regexp.MustCompile(`^(?:[a-z0-9.-]+\.)?s3(?:[.-]([a-z0-9-]+))?\.(amazonaws\.com(?:\.cn)?)$`)
+
+// dualStackS3Host returns the dual-stack S3 endpoint to connect to in place of
+// an IPv4-only S3 hostname, and whether host is one.
+func dualStackS3Host(host string) (string, bool) {
+	m := s3HostPattern.FindStringSubmatch(strings.ToLower(host))
+	if m == nil {
+		return "", false
+	}
+	region, domain := m[1], m[2]
+	switch {
+	case region == "" || region == "external-1":
+		region = "us-east-1"
+	case strings.HasPrefix(region, "accelerate"):
+		return "", false
+	}
+	return "s3.dualstack." + region + "." + domain, true
+}
+
+// newDownloadClient returns the client that downloads the presigned CA bundle
+// and revocation list locations. With dualStack it connects to the
+// dual-stack S3 endpoint of the region for IPv4-only S3 hostnames, so the
+// downloads work over IPv6. Only the connection is redirected: the request
+// keeps its hostname for TLS and the Host header, which the presigned
+// signature covers.
+func newDownloadClient(dualStack bool) *http.Client {
+	if !dualStack {
+		return &http.Client{Timeout: downloadTimeout}
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, port, err := net.SplitHostPort(addr); err == nil {
+			if dualStackHost, ok := dualStackS3Host(host); ok {
+				addr = net.JoinHostPort(dualStackHost, port)
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return &http.Client{Timeout: downloadTimeout, Transport: transport}
+}
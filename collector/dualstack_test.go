@@ -0,0 +1,31 @@
+package collector
+
+import "testing"
+
+func TestDualStackS3Host(t *testing.T) {
+	for _, tc := range []struct {
+		host string
+		want string
+		ok   bool
+	}{
+		{"bucket.s3.amazonaws.com", "s3.dualstack.us-east-1.amazonaws.com", true},
+		{"bucket.s3.us-west-2.amazonaws.com", "s3.dualstack.us-west-2.amazonaws.com", true},
+		{"bucket.s3-us-west-2.amazonaws.com", "s3.dualstack.us-west-2.amazonaws.com", true},
+		{"s3.eu-central-1.amazonaws.com", "s3.dualstack.eu-central-1.amazonaws.com", true},
+		{"s3-external-1.amazonaws.com", "s3.dualstack.us-east-1.amazonaws.com", true},
+		{"my.dotted.bucket.s3.ap-southeast-2.amazonaws.com", "s3.dualstack.ap-southeast-2.amazonaws.com", true},
+		{"bucket.s3.cn-north-1.amazonaws.com.cn", "s3.dualstack.cn-north-1.amazonaws.com.cn", true},
+		{"Bucket.S3.US-WEST-2.AMAZONAWS.COM", "s3.dualstack.us-west-2.amazonaws.com", true},
+		{"bucket.s3.dualstack.us-west-2.amazonaws.com", "", false},
+		{"bucket.s3-accelerate.amazonaws.com", "", false},
+		{"bucket.s3-accelerate.dualstack.amazonaws.com", "", false},
+		{"elasticloadbalancing.us-east-1.amazonaws.com", "", false},
+		{"example.com", "", false},
+		{"127.0.0.1", "", false},
+	} {
+		got, ok := dualStackS3Host(tc.host)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("dualStackS3Host(%q) = %q, %v, want %q, %v", tc.host, got, ok, tc.want, tc.ok)
+		}
+	}
+}
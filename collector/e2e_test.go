@@ -0,0 +1,106 @@
+package collector_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/collector"
+	"github.com/panubo/elb-trust-store-exporter/internal/fakeaws"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// TestEndToEnd collects synthetic trust stores from the fake AWS API and
+// checks the metrics scraped from the metrics endpoint.
+func TestEndToEnd(t *testing.T) {
+	s := fakeaws.NewServer()
+	t.Cleanup(s.Close)
+	if err := s.AddSyntheticTrustStores(fakeaws.SyntheticOptions{TrustStores: 5, CertificatesPerTrustStore: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := collector.New(collector.Options{
+		QueryInterval:           time.Hour,
+		MaxConcurrency:          2,
+		ExpiryWarningThreshold:  30 * 24 * time.Hour,
+		ExpiryCriticalThreshold: 7 * 24 * time.Hour,
+		CollectListeners:        true,
+		CollectAssociations:     true,
+	}, collector.WithELBClient(s.ELBClient()))
+	t.Cleanup(c.Stop)
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+	server := httptest.NewServer(promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %s", resp.Status)
+	}
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := fakeaws.TrustStoreARN("demo-001")
+	second := fakeaws.TrustStoreARN("demo-002")
+	passthrough := fakeaws.TrustStoreARN("demo-005")
+	for _, tc := range []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{"elb_trust_store_collector_success", nil, 1},
+		{"elb_trust_store_exporter_trust_stores_discovered", nil, 5},
+		{"elb_trust_store_certificates", map[string]string{"trust_store_arn": first}, 2},
+		{"elb_trust_store_status", map[string]string{"trust_store_arn": first, "status": "ACTIVE"}, 1},
+		{"elb_trust_store_status", map[string]string{"trust_store_arn": first, "status": "CREATING"}, 0},
+		{"elb_trust_store_associations", map[string]string{"trust_store_arn": first}, 1},
+		{"elb_trust_store_listener_advertise_ca_names", map[string]string{"trust_store_arn": first}, 1},
+		{"elb_trust_store_listener_advertise_ca_names", map[string]string{"trust_store_arn": second}, 0},
+		{"elb_trust_store_listener_mutual_authentication_mode", map[string]string{"trust_store_arn": first, "mode": "verify"}, 1},
+		{"elb_trust_store_listener_mutual_authentication_mode", map[string]string{"trust_store_arn": passthrough, "mode": "passthrough"}, 1},
+		{"elb_trust_store_listener_passthrough", map[string]string{"trust_store_arn": passthrough}, 1},
+	} {
+		got, ok := value(families[tc.name], tc.labels)
+		if !ok {
+			t.Errorf("%s%v: no series", tc.name, tc.labels)
+		} else if got != tc.want {
+			t.Errorf("%s%v = %v, want %v", tc.name, tc.labels, got, tc.want)
+		}
+	}
+
+	if got := len(families["elb_trust_store_info"].GetMetric()); got != 5 {
+		t.Errorf("got %d elb_trust_store_info series, want 5", got)
+	}
+	if got := len(families["elb_trust_store_certificate_expiry"].GetMetric()); got != 10 {
+		t.Errorf("got %d elb_trust_store_certificate_expiry series, want 10", got)
+	}
+}
+
+// value returns the value of the first series of the family with the labels.
+func value(family *dto.MetricFamily, labels map[string]string) (float64, bool) {
+	for _, m := range family.GetMetric() {
+		matches := 0
+		for _, pair := range m.GetLabel() {
+			if want, ok := labels[pair.GetName()]; ok && want == pair.GetValue() {
+				matches++
+			}
+		}
+		if matches == len(labels) {
+			return m.GetGauge().GetValue(), true
+		}
+	}
+	return 0, false
+}
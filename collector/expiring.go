@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ExpiringThreshold is a time before expiry for which the number of
+// certificates in each trust store expiring within it is exported.
+type ExpiringThreshold struct {
+	// Label is the value of the within label, as the threshold was given.
+	Label    string
+	Duration time.Duration
+}
+
+// ParseExpiringThreshold parses a threshold given as a number of days, such as
+// "30d", or as a Go duration, such as "12h".
+func ParseExpiringThreshold(s string) (ExpiringThreshold, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return ExpiringThreshold{}, fmt.Errorf("invalid expiring threshold %q", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return ExpiringThreshold{}, fmt.Errorf("invalid expiring threshold %q", s)
+		}
+	}
+	if d <= 0 {
+		return ExpiringThreshold{}, fmt.Errorf("expiring threshold %q must be positive", s)
+	}
+	return ExpiringThreshold{Label: s, Duration: d}, nil
+}
+
+// CheckExpiringThresholds returns an error if two thresholds are the same time
+// before expiry, such as 30d and 720h, which would export the same count
+// twice under different labels.
+func CheckExpiringThresholds(thresholds []ExpiringThreshold) error {
+	for i, threshold := range thresholds {
+		for _, other := range thresholds[:i] {
+			if other.Duration == threshold.Duration {
+				return fmt.Errorf("expiring thresholds %q and %q are the same", other.Label, threshold.Label)
+			}
+		}
+	}
+	return nil
+}
+
+// collectExpiring sends the number of certificates in each trust store of a
+// scrape result that expire within each threshold of at, including those
+// already expired. These are trust store level metrics, so they are sent even
+// when per-certificate metrics are dropped.
+func (c *Collector) collectExpiring(ch chan<- prometheus.Metric, r *scrapeResult, at time.Time) {
+	for _, data := range r.trustStores {
+		for _, threshold := range c.opts.ExpiringThresholds {
+			count := 0
+			for _, cert := range data.certificates {
+				if cert.NotAfter.Sub(at) <= threshold.Duration {
+					count++
+				}
+			}
+			ch <- prometheus.MustNewConstMetric(
+				c.certificatesExpiring,
+				prometheus.GaugeValue,
+				float64(count),
+				*data.trustStore.TrustStoreArn,
+				threshold.Label,
+			)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+)
+
+// Bundle is the content of a trust store's CA certificates bundle and
+// revocation lists, as uploaded to AWS.
+type Bundle struct {
+	ARN             string
+	Name            string
+	PEM             []byte
+	RevocationLists []RevocationListContent
+}
+
+// RevocationListContent is a revocation list in a Bundle. Data is PEM or DER
+// encoded, as uploaded.
+type RevocationListContent struct {
+	ID             int64
+	Type           string
+	RevokedEntries int64
+	Data           []byte
+}
+
+// Bundles downloads the CA certificates bundle and revocation lists of every
+// monitored trust store, discovered and filtered as a scrape would, and calls
+// fn with each. The trust stores whose download failed are returned, and
+// Bundles only returns an error if the trust stores could not be discovered or
+// fn fails.
+func (c *Collector) Bundles(ctx context.Context, fn func(Bundle) error) ([]FailedTrustStore, error) {
+	svc, err := c.elbClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS config: %w", err)
+	}
+	trustStores, _, err := c.discoverTrustStores(ctx, svc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe trust stores: %w", err)
+	}
+
+	var failures []FailedTrustStore
+	for _, ts := range trustStores {
+		if !c.matchesName(*ts.Name) || !c.inShard(*ts.TrustStoreArn) {
+			continue
+		}
+		bundle, err := c.downloadBundle(ctx, svc, ts)
+		if err != nil {
+			failures = append(failures, newFailedTrustStore(ts, err))
+			continue
+		}
+		if err := fn(bundle); err != nil {
+			return failures, err
+		}
+	}
+	return failures, nil
+}
+
+// downloadBundle downloads the CA certificates bundle and revocation lists of
+// a trust store.
+func (c *Collector) downloadBundle(ctx context.Context, svc ELBAPI, ts types.TrustStore) (Bundle, error) {
+	location, err := svc.GetTrustStoreCaCertificatesBundle(
+		ctx,
+		&elasticloadbalancingv2.GetTrustStoreCaCertificatesBundleInput{
+			TrustStoreArn: ts.TrustStoreArn,
+		},
+	)
+	if err != nil {
+		return Bundle{}, err
+	}
+	data, err := c.fetch(ctx, *location.Location)
+	if err != nil {
+		return Bundle{}, err
+	}
+	lists, err := c.downloadRevocationLists(ctx, svc, ts)
+	if err != nil {
+		return Bundle{}, err
+	}
+	return Bundle{
+		ARN:             *ts.TrustStoreArn,
+		Name:            aws.ToString(ts.Name),
+		PEM:             data,
+		RevocationLists: lists,
+	}, nil
+}
@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// callerIdentity is the identity of the collector's AWS credentials as last
+// returned by STS GetCallerIdentity.
+type callerIdentity struct {
+	arn     string
+	account string
+	userID  string
+}
+
+// checkIdentity returns the metrics describing the collector's AWS
+// credentials. It calls STS GetCallerIdentity on the first scrape and then
+// every IdentityCheckInterval, and retrieves the credentials on every scrape
+// for their expiry. It returns nil if the check is disabled or the ELBv2
+// client was set with WithELBClient, as its credentials are then unknown.
+func (c *Collector) checkIdentity(ctx context.Context, now time.Time) []prometheus.Metric {
+	if c.opts.IdentityCheckInterval == 0 || c.elb != nil {
+		return nil
+	}
+	cfg, err := c.loadAWSConfig(ctx)
+	if err != nil {
+		// The error is logged when creating the ELBv2 client.
+		return nil
+	}
+
+	if c.identityChecked.IsZero() || now.Sub(c.identityChecked) >= c.opts.IdentityCheckInterval {
+		c.identityChecked = now
+		out, err := sts.NewFromConfig(cfg, func(o *sts.Options) {
+			o.APIOptions = append(o.APIOptions, c.apiMetrics.addMiddleware)
+		}).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			log.Printf("Error checking AWS credentials with GetCallerIdentity: %v", err)
+			c.identityOK = false
+		} else {
+			identity := callerIdentity{
+				arn:     aws.ToString(out.Arn),
+				account: aws.ToString(out.Account),
+				userID:  aws.ToString(out.UserId),
+			}
+			if c.identity == nil || *c.identity != identity {
+				log.Printf("Using AWS credentials of %s in account %s", identity.arn, identity.account)
+			}
+			c.identity = &identity
+			c.identityOK = true
+		}
+	}
+
+	ok := 0.0
+	if c.identityOK {
+		ok = 1
+	}
+	metrics := []prometheus.Metric{
+		prometheus.MustNewConstMetric(c.exporterIdentityCheckSuccess, prometheus.GaugeValue, ok),
+	}
+	if c.identity != nil {
+		metrics = append(
+			metrics,
+			prometheus.MustNewConstMetric(
+				c.exporterIdentity,
+				prometheus.GaugeValue,
+				1,
+				c.identity.arn,
+				c.identity.account,
+				c.identity.userID,
+			),
+		)
+	}
+
+	if cfg.Credentials == nil {
+		return metrics
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		log.Printf("Error retrieving AWS credentials: %v", err)
+	} else if creds.CanExpire {
+		metrics = append(
+			metrics,
+			prometheus.MustNewConstMetric(
+				c.exporterCredentialsExpiry,
+				prometheus.GaugeValue,
+				float64(creds.Expires.Unix()),
+			),
+		)
+	}
+	return metrics
+}
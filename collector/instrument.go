@@ -0,0 +1,180 @@
+package collector
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// apiMetrics counts and times AWS API calls made by the collector's own
+// clients and the S3 downloads of bundles and revocation lists, and times the
+// parsing of what is downloaded.
+type apiMetrics struct {
+	requests        *prometheus.CounterVec
+	throttles       *prometheus.CounterVec
+	durations       *prometheus.HistogramVec
+	s3Requests      prometheus.Counter
+	s3Bytes         prometheus.Counter
+	s3Durations     prometheus.Histogram
+	parseDurations  *prometheus.HistogramVec
+	cycleRequests   atomic.Int64
+	cycleS3Requests atomic.Int64
+	cycleS3Bytes    atomic.Int64
+}
+
+// cycleUsage is the number of requests and bytes downloaded in a scrape.
+type cycleUsage struct {
+	apiRequests int64
+	s3Requests  int64
+	s3Bytes     int64
+}
+
+func newAPIMetrics() *apiMetrics {
+	return &apiMetrics{
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: "exporter",
+				Name:      "aws_api_requests_total",
+				Help:      "The number of AWS API request attempts, including retries.",
+			},
+			[]string{"operation"},
+		),
+		throttles: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: "exporter",
+				Name:      "aws_api_throttles_total",
+				Help:      "The number of AWS API request attempts that were throttled.",
+			},
+			[]string{"operation"},
+		),
+		durations: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: Namespace,
+				Subsystem: "exporter",
+				Name:      "aws_api_request_duration_seconds",
+				Help:      "The duration of AWS API request attempts.",
+				Buckets:   prometheus.DefBuckets,
+			},
+			[]string{"operation"},
+		),
+		s3Requests: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: "exporter",
+				Name:      "s3_requests_total",
+				Help:      "The number of S3 GET requests for CA bundles and revocation lists.",
+			},
+		),
+		s3Bytes: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: "exporter",
+				Name:      "s3_downloaded_bytes_total",
+				Help:      "The number of bytes downloaded from S3 for CA bundles and revocation lists.",
+			},
+		),
+		s3Durations: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace: Namespace,
+				Subsystem: "exporter",
+				Name:      "s3_request_duration_seconds",
+				Help:      "The duration of S3 GET requests for CA bundles and revocation lists, including reading the response.",
+				Buckets:   prometheus.DefBuckets,
+			},
+		),
+		parseDurations: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: Namespace,
+				Subsystem: "exporter",
+				Name:      "parse_duration_seconds",
+				Help:      "The duration of parsing CA bundles and revocation lists, by content.",
+				Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 8),
+			},
+			[]string{"content"},
+		),
+	}
+}
+
+// resetCycle starts counting the usage of a new scrape and returns the usage
+// of the previous one.
+func (m *apiMetrics) resetCycle() cycleUsage {
+	return cycleUsage{
+		apiRequests: m.cycleRequests.Swap(0),
+		s3Requests:  m.cycleS3Requests.Swap(0),
+		s3Bytes:     m.cycleS3Bytes.Swap(0),
+	}
+}
+
+// recordDownload counts an S3 GET request that downloaded n bytes in d.
+func (m *apiMetrics) recordDownload(n int, d time.Duration) {
+	m.s3Requests.Inc()
+	m.s3Bytes.Add(float64(n))
+	m.s3Durations.Observe(d.Seconds())
+	m.cycleS3Requests.Add(1)
+	m.cycleS3Bytes.Add(int64(n))
+}
+
+// recordParse times the parsing of a CA bundle or revocation list, given as
+// content, that started at start.
+func (m *apiMetrics) recordParse(content string, start time.Time) {
+	m.parseDurations.WithLabelValues(content).Observe(time.Since(start).Seconds())
+}
+
+func (m *apiMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.throttles.Describe(ch)
+	m.durations.Describe(ch)
+	m.s3Requests.Describe(ch)
+	m.s3Bytes.Describe(ch)
+	m.s3Durations.Describe(ch)
+	m.parseDurations.Describe(ch)
+}
+
+func (m *apiMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.throttles.Collect(ch)
+	m.durations.Collect(ch)
+	m.s3Requests.Collect(ch)
+	m.s3Bytes.Collect(ch)
+	m.s3Durations.Collect(ch)
+	m.parseDurations.Collect(ch)
+}
+
+// addMiddleware registers the instrumentation on an SDK client's middleware
+// stack. It runs after the retry middleware so every attempt is counted and
+// timed separately.
+func (m *apiMetrics) addMiddleware(stack *middleware.Stack) error {
+	return stack.Finalize.Insert(
+		middleware.FinalizeMiddlewareFunc(
+			"ExporterAPIMetrics",
+			func(
+				ctx context.Context,
+				in middleware.FinalizeInput,
+				next middleware.FinalizeHandler,
+			) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				operation := awsmiddleware.GetOperationName(ctx)
+				m.requests.WithLabelValues(operation).Inc()
+				m.cycleRequests.Add(1)
+
+				start := time.Now()
+				out, metadata, err := next.HandleFinalize(ctx, in)
+				m.durations.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+				if err != nil &&
+					retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary {
+					m.throttles.WithLabelValues(operation).Inc()
+				}
+				return out, metadata, err
+			},
+		),
+		"Retry",
+		middleware.After,
+	)
+}
@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+)
+
+// TrustStoreInterval sets the query interval of the trust stores whose names
+// match NameRegex, in place of QueryInterval.
+type TrustStoreInterval struct {
+	NameRegex *regexp.Regexp
+	Interval  time.Duration
+}
+
+// trustStoreInterval returns the query interval of the trust store with the
+// given name, set by the first matching TrustStoreIntervals entry.
+func (c *Collector) trustStoreInterval(name string) time.Duration {
+	for _, i := range c.opts.TrustStoreIntervals {
+		if i.NameRegex.MatchString(name) {
+			return i.Interval
+		}
+	}
+	return c.opts.QueryInterval
+}
+
+// scrapeInterval returns the interval of background scrapes, the shortest
+// query interval of any trust store or the discovery interval.
+func (c *Collector) scrapeInterval() time.Duration {
+	interval := c.opts.QueryInterval
+	for _, i := range c.opts.TrustStoreIntervals {
+		interval = min(interval, i.Interval)
+	}
+	if c.opts.DiscoveryInterval > 0 {
+		interval = min(interval, c.opts.DiscoveryInterval)
+	}
+	return interval
+}
+
+// collectsWhenDue reports whether scrapes only collect the trust stores whose
+// query interval has passed, rather than every trust store discovered.
+func (c *Collector) collectsWhenDue() bool {
+	return c.opts.DiscoveryInterval > 0 || len(c.opts.TrustStoreIntervals) > 0
+}
+
+// due splits the trust stores into those whose query interval has passed
+// since they were last collected at now, and the earlier data of those that
+// are not due yet. Newly discovered trust stores are always due.
+func (c *Collector) due(trustStores []types.TrustStore, now time.Time) ([]types.TrustStore, []*trustStoreData) {
+	if !c.collectsWhenDue() {
+		return trustStores, nil
+	}
+	var (
+		due    []types.TrustStore
+		cached []*trustStoreData
+	)
+	for _, ts := range trustStores {
+		data := c.collected[*ts.TrustStoreArn]
+		if data != nil && now.Sub(data.collected) < c.trustStoreInterval(*ts.Name) {
+			cached = append(cached, data)
+			continue
+		}
+		due = append(due, ts)
+	}
+	return due, cached
+}
+
+// trackCollected records the data of the collected trust stores, forgetting
+// any others.
+func (c *Collector) trackCollected(results []*trustStoreData) {
+	if !c.collectsWhenDue() {
+		return
+	}
+	c.collected = make(map[string]*trustStoreData, len(results))
+	for _, data := range results {
+		c.collected[*data.trustStore.TrustStoreArn] = data
+	}
+}
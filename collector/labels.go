@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// CertificateInfoLabels are the labels of elb_trust_store_certificate_info
+// other than trust_store_arn, which is always present, in the order they are
+// exported.
+var CertificateInfoLabels = []string{
+	"serial_number",
+	"issuer",
+	"subject",
+	"signature_algo",
+	"key_type",
+	"key_length",
+	"fingerprint_sha256",
+	"authority_key_id",
+	"subject_key_id",
+	"cert_class",
+}
+
+// CheckCertificateInfoLabels returns an error if labels includes a label that
+// elb_trust_store_certificate_info does not have, or does not tell
+// certificates apart: that takes fingerprint_sha256, or serial_number with
+// issuer, as serial numbers are only unique per issuer.
+func CheckCertificateInfoLabels(labels []string) error {
+	for _, label := range labels {
+		if !slices.Contains(CertificateInfoLabels, label) {
+			return fmt.Errorf("unknown certificate info label %q, expected one of %v", label, CertificateInfoLabels)
+		}
+	}
+	if slices.Contains(labels, "fingerprint_sha256") {
+		return nil
+	}
+	if !slices.Contains(labels, "serial_number") || !slices.Contains(labels, "issuer") {
+		return errors.New("certificate info labels must include fingerprint_sha256, or serial_number and issuer")
+	}
+	return nil
+}
+
+// certificateInfoLabelNames returns the label names of the certificate info
+// metric when only the allowed labels are exported. All labels are exported
+// if allowed is empty.
+func certificateInfoLabelNames(allowed []string) []string {
+	names := []string{"trust_store_arn"}
+	for _, label := range CertificateInfoLabels {
+		if len(allowed) == 0 || slices.Contains(allowed, label) {
+			names = append(names, label)
+		}
+	}
+	return names
+}
+
+// certificateInfoLabelValues returns the values of the labels in names for a
+// certificate.
+func certificateInfoLabelValues(
+	names []string,
+	arn string,
+	cert *x509.Certificate,
+	keyType string,
+	keyLength int,
+) []string {
+	values := make([]string, 0, len(names))
+	for _, name := range names {
+		var value string
+		switch name {
+		case "trust_store_arn":
+			value = arn
+		case "serial_number":
+			value = cert.SerialNumber.String()
+		case "issuer":
+			value = cert.Issuer.String()
+		case "subject":
+			value = cert.Subject.String()
+		case "signature_algo":
+			value = cert.SignatureAlgorithm.String()
+		case "key_type":
+			value = keyType
+		case "key_length":
+			value = strconv.Itoa(keyLength)
+		case "fingerprint_sha256":
+			value = fingerprint(cert)
+		case "authority_key_id":
+			value = hex.EncodeToString(cert.AuthorityKeyId)
+		case "subject_key_id":
+			value = hex.EncodeToString(cert.SubjectKeyId)
+		case "cert_class":
+			value = certClass(cert)
+		}
+		values = append(values, value)
+	}
+	return values
+}
@@ -0,0 +1,246 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// lastGoodFile is the content of the last good file: the time of a
+// successful scrape, the trust store metrics it collected other than those
+// derived from the time, and the trust stores it collected, from which the
+// time-derived metrics and the snapshot are computed again once restored.
+// Metrics are in the Prometheus text format.
+type lastGoodFile struct {
+	Time        time.Time            `json:"time"`
+	SummaryOnly bool                 `json:"summary_only,omitempty"`
+	Metrics     string               `json:"metrics"`
+	TrustStores []lastGoodTrustStore `json:"trust_stores"`
+}
+
+// lastGoodTrustStore is a trust store in the last good file, with its DER
+// encoded certificates.
+type lastGoodTrustStore struct {
+	ARN             string                   `json:"arn"`
+	Name            string                   `json:"name"`
+	BundleSHA256    string                   `json:"bundle_sha256"`
+	Certificates    [][]byte                 `json:"certificates"`
+	RevocationLists []lastGoodRevocationList `json:"revocation_lists,omitempty"`
+}
+
+// lastGoodRevocationList is a revocation list in the last good file. Content
+// is the DER encoded list, or empty if it could not be parsed.
+type lastGoodRevocationList struct {
+	ID             int64  `json:"id"`
+	Type           string `json:"type"`
+	RevokedEntries int64  `json:"revoked_entries"`
+	Content        []byte `json:"content,omitempty"`
+}
+
+// resultMetrics collects the trust store metrics of a scrape result that are
+// not derived from the time, as saved to the last good file.
+type resultMetrics struct {
+	r *scrapeResult
+}
+
+// Describe sends no descriptors, so the registry does not check the metrics.
+func (m resultMetrics) Describe(chan<- *prometheus.Desc) {}
+
+func (m resultMetrics) Collect(ch chan<- prometheus.Metric) {
+	for _, metric := range m.r.metrics {
+		ch <- metric
+	}
+}
+
+// saveLastGood writes a successful scrape result to the last good file,
+// replacing it atomically.
+func (c *Collector) saveLastGood(r *scrapeResult) {
+	if err := writeLastGood(c.opts.LastGoodFile, r); err != nil {
+		log.Printf("Error saving last good metrics to %s: %v", c.opts.LastGoodFile, err)
+	}
+}
+
+func writeLastGood(path string, r *scrapeResult) error {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(resultMetrics{r: r})
+	families, err := reg.Gather()
+	if err != nil {
+		return err
+	}
+	var metrics strings.Builder
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(&metrics, mf); err != nil {
+			return err
+		}
+	}
+
+	file := lastGoodFile{
+		Time:        r.time,
+		SummaryOnly: r.summaryOnly,
+		Metrics:     metrics.String(),
+		TrustStores: make([]lastGoodTrustStore, 0, len(r.trustStores)),
+	}
+	for _, data := range r.trustStores {
+		ts := lastGoodTrustStore{
+			ARN:          *data.trustStore.TrustStoreArn,
+			Name:         aws.ToString(data.trustStore.Name),
+			BundleSHA256: hex.EncodeToString(data.bundleChecksum[:]),
+			Certificates: make([][]byte, 0, len(data.certificates)),
+		}
+		for _, cert := range data.certificates {
+			ts.Certificates = append(ts.Certificates, cert.Raw)
+		}
+		for _, rl := range data.revocationLists {
+			saved := lastGoodRevocationList{ID: rl.id, Type: rl.revocationType, RevokedEntries: rl.revokedEntries}
+			if rl.list != nil {
+				saved.Content = rl.list.Raw
+			}
+			ts.RevocationLists = append(ts.RevocationLists, saved)
+		}
+		file.TrustStores = append(file.TrustStores, ts)
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadLastGood reads the last good file as a restored result, whose
+// time-derived metrics are evaluated as for any other result. It returns nil
+// if there is no file yet.
+func loadLastGood(path string) (*scrapeResult, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file lastGoodFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	restored := &scrapeResult{
+		success:     true,
+		restored:    true,
+		summaryOnly: file.SummaryOnly,
+		time:        file.Time,
+	}
+	restored.metrics, err = parseMetrics(file.Metrics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the metrics in %s: %w", path, err)
+	}
+	for _, ts := range file.TrustStores {
+		data := &trustStoreData{
+			trustStore: types.TrustStore{TrustStoreArn: aws.String(ts.ARN), Name: aws.String(ts.Name)},
+			collected:  file.Time,
+		}
+		checksum, err := hex.DecodeString(ts.BundleSHA256)
+		if err != nil || len(checksum) != sha256.Size {
+			return nil, fmt.Errorf("invalid bundle checksum of trust store %s in %s", ts.ARN, path)
+		}
+		copy(data.bundleChecksum[:], checksum)
+		for _, der := range ts.Certificates {
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("invalid certificate of trust store %s in %s: %w", ts.ARN, path, err)
+			}
+			data.certificates = append(data.certificates, cert)
+		}
+		for _, saved := range ts.RevocationLists {
+			rl := revocationList{id: saved.ID, revocationType: saved.Type, revokedEntries: saved.RevokedEntries}
+			if len(saved.Content) > 0 {
+				rl.list, err = x509.ParseRevocationList(saved.Content)
+				if err != nil {
+					return nil, fmt.Errorf("invalid revocation list of trust store %s in %s: %w", ts.ARN, path, err)
+				}
+			}
+			data.revocationLists = append(data.revocationLists, rl)
+		}
+		restored.trustStores = append(restored.trustStores, data)
+	}
+	restored.snapshot = newSnapshot(restored.time, restored.trustStores, nil)
+	return restored, nil
+}
+
+// parseMetrics returns the metrics in the Prometheus text format as constant
+// metrics.
+func parseMetrics(text string) ([]prometheus.Metric, error) {
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(strings.NewReader(text))
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []prometheus.Metric
+	for _, mf := range families {
+		var valueType prometheus.ValueType
+		switch mf.GetType() {
+		case dto.MetricType_GAUGE:
+			valueType = prometheus.GaugeValue
+		case dto.MetricType_COUNTER:
+			valueType = prometheus.CounterValue
+		default:
+			valueType = prometheus.UntypedValue
+		}
+		for _, m := range mf.GetMetric() {
+			names := make([]string, 0, len(m.GetLabel()))
+			values := make([]string, 0, len(m.GetLabel()))
+			for _, label := range m.GetLabel() {
+				names = append(names, label.GetName())
+				values = append(values, label.GetValue())
+			}
+			var value float64
+			switch valueType {
+			case prometheus.GaugeValue:
+				value = m.GetGauge().GetValue()
+			case prometheus.CounterValue:
+				value = m.GetCounter().GetValue()
+			default:
+				value = m.GetUntyped().GetValue()
+			}
+			metric, err := prometheus.NewConstMetric(
+				prometheus.NewDesc(mf.GetName(), mf.GetHelp(), names, nil),
+				valueType,
+				value,
+				values...,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("invalid metric %s: %w", mf.GetName(), err)
+			}
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics, nil
+}
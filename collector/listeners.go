@@ -0,0 +1,315 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// mutualAuthenticationPassthrough is the listener mutual TLS mode that
+// forwards the client certificate chain to targets without verifying it.
+const mutualAuthenticationPassthrough = "passthrough"
+
+// mutualAuthenticationModes are the listener mutual TLS modes.
+var mutualAuthenticationModes = []string{"off", mutualAuthenticationPassthrough, "verify"}
+
+// trustStoreAssociations returns the ARNs of the listeners and load balancers
+// the trust store is associated with.
+func trustStoreAssociations(ctx context.Context, svc ELBAPI, trustStoreARN string) ([]string, error) {
+	var arns []string
+	paginator := elasticloadbalancingv2.NewDescribeTrustStoreAssociationsPaginator(
+		svc,
+		&elasticloadbalancingv2.DescribeTrustStoreAssociationsInput{TrustStoreArn: aws.String(trustStoreARN)},
+	)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, association := range page.TrustStoreAssociations {
+			arns = append(arns, aws.ToString(association.ResourceArn))
+		}
+	}
+	return arns, nil
+}
+
+// associatedListeners returns the listeners that use the trust store, given
+// its associations. The trust store may be associated with listeners directly
+// or with load balancers, in which case the load balancer's listeners that
+// reference the trust store are returned.
+func associatedListeners(
+	ctx context.Context,
+	svc ELBAPI,
+	trustStoreARN string,
+	associations []string,
+) ([]types.Listener, error) {
+	var listenerARNs, loadBalancerARNs []string
+	for _, arn := range associations {
+		if strings.Contains(arn, ":listener/") {
+			listenerARNs = append(listenerARNs, arn)
+		} else {
+			loadBalancerARNs = append(loadBalancerARNs, arn)
+		}
+	}
+
+	var listeners []types.Listener
+	if len(listenerARNs) > 0 {
+		found, err := describeListeners(ctx, svc, &elasticloadbalancingv2.DescribeListenersInput{ListenerArns: listenerARNs})
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, found...)
+	}
+	for _, arn := range loadBalancerARNs {
+		found, err := describeListeners(ctx, svc, &elasticloadbalancingv2.DescribeListenersInput{LoadBalancerArn: aws.String(arn)})
+		if err != nil {
+			return nil, err
+		}
+		for _, listener := range found {
+			if listener.MutualAuthentication != nil &&
+				aws.ToString(listener.MutualAuthentication.TrustStoreArn) == trustStoreARN {
+				listeners = append(listeners, listener)
+			}
+		}
+	}
+	return listeners, nil
+}
+
+// describeListeners returns every page of DescribeListeners results.
+func describeListeners(
+	ctx context.Context,
+	svc ELBAPI,
+	input *elasticloadbalancingv2.DescribeListenersInput,
+) ([]types.Listener, error) {
+	var listeners []types.Listener
+	paginator := elasticloadbalancingv2.NewDescribeListenersPaginator(svc, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, page.Listeners...)
+	}
+	return listeners, nil
+}
+
+// collectListenerMetrics adds the association, listener and target health
+// metrics of the trust store that are enabled to data.
+func (c *Collector) collectListenerMetrics(ctx context.Context, svc ELBAPI, data *trustStoreData) error {
+	arn := *data.trustStore.TrustStoreArn
+	associations, err := trustStoreAssociations(ctx, svc, arn)
+	if err != nil {
+		return err
+	}
+	if c.opts.CollectAssociations {
+		data.metrics = append(
+			data.metrics,
+			prometheus.MustNewConstMetric(c.associations, prometheus.GaugeValue, float64(len(associations)), arn),
+		)
+	}
+	if !c.opts.CollectListeners && !c.opts.CollectTargetHealth {
+		return nil
+	}
+
+	listeners, err := associatedListeners(ctx, svc, arn, associations)
+	if err != nil {
+		return err
+	}
+
+	if c.opts.CollectTargetHealth {
+		healthy, total, err := targetHealth(ctx, svc, listeners)
+		if err != nil {
+			return err
+		}
+		data.metrics = append(
+			data.metrics,
+			prometheus.MustNewConstMetric(c.healthyTargets, prometheus.GaugeValue, float64(healthy), arn),
+		)
+		data.metrics = append(
+			data.metrics,
+			prometheus.MustNewConstMetric(c.targets, prometheus.GaugeValue, float64(total), arn),
+		)
+	}
+	if !c.opts.CollectListeners {
+		return nil
+	}
+
+	former, err := c.formerListeners(ctx, svc, arn, listeners)
+	if err != nil {
+		return err
+	}
+	for _, listener := range slices.Concat(listeners, former) {
+		var mode string
+		ignoreExpiry, advertiseCANames := 0.0, 0.0
+		if auth := listener.MutualAuthentication; auth != nil {
+			mode = aws.ToString(auth.Mode)
+			if aws.ToBool(auth.IgnoreClientCertificateExpiry) {
+				ignoreExpiry = 1
+			}
+			if auth.AdvertiseTrustStoreCaNames == types.AdvertiseTrustStoreCaNamesEnumOn {
+				advertiseCANames = 1
+			}
+		}
+		passthrough := 0.0
+		if mode == mutualAuthenticationPassthrough {
+			passthrough = 1
+		}
+		listenerARN := aws.ToString(listener.ListenerArn)
+		data.metrics = append(
+			data.metrics,
+			prometheus.MustNewConstMetric(
+				c.listenerPassthrough,
+				prometheus.GaugeValue,
+				passthrough,
+				arn,
+				listenerARN,
+			),
+			prometheus.MustNewConstMetric(
+				c.listenerIgnoreExpiry,
+				prometheus.GaugeValue,
+				ignoreExpiry,
+				arn,
+				listenerARN,
+			),
+			prometheus.MustNewConstMetric(
+				c.listenerAdvertiseCANames,
+				prometheus.GaugeValue,
+				advertiseCANames,
+				arn,
+				listenerARN,
+			),
+		)
+		data.metrics = append(data.metrics, c.listenerModeMetrics(arn, listenerARN, mode)...)
+	}
+	return nil
+}
+
+// formerListeners returns the listeners that used the trust store when it was
+// last collected but are no longer associated with it, such as a listener
+// switched to passthrough or off mode, which no longer references the trust
+// store. They are described by ARN until they are deleted or reference another
+// trust store, so a change of mode shows in the listener metrics rather than
+// their series disappearing. current are the listeners associated with the
+// trust store, which are remembered for the next collection.
+func (c *Collector) formerListeners(
+	ctx context.Context,
+	svc ELBAPI,
+	trustStoreARN string,
+	current []types.Listener,
+) ([]types.Listener, error) {
+	var seen []string
+	for _, listener := range current {
+		seen = append(seen, aws.ToString(listener.ListenerArn))
+	}
+	c.listenerMutex.Lock()
+	previous := c.listenersSeen[trustStoreARN]
+	c.listenerMutex.Unlock()
+
+	var former []types.Listener
+	for _, listenerARN := range previous {
+		if slices.Contains(seen, listenerARN) {
+			continue
+		}
+		found, err := describeListeners(
+			ctx,
+			svc,
+			&elasticloadbalancingv2.DescribeListenersInput{ListenerArns: []string{listenerARN}},
+		)
+		var notFound *types.ListenerNotFoundException
+		if errors.As(err, &notFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, listener := range found {
+			if auth := listener.MutualAuthentication; auth != nil && auth.TrustStoreArn != nil &&
+				aws.ToString(auth.TrustStoreArn) != trustStoreARN {
+				continue
+			}
+			former = append(former, listener)
+			seen = append(seen, listenerARN)
+		}
+	}
+
+	c.listenerMutex.Lock()
+	c.listenersSeen[trustStoreARN] = seen
+	c.listenerMutex.Unlock()
+	return former, nil
+}
+
+// listenerModeMetrics returns a series for every mutual TLS mode of a
+// listener, and for mode if it is not known, which is 1 for mode and 0 for
+// the others.
+func (c *Collector) listenerModeMetrics(trustStoreARN, listenerARN, mode string) []prometheus.Metric {
+	modes := mutualAuthenticationModes
+	if mode != "" && !slices.Contains(modes, mode) {
+		modes = append(slices.Clip(modes), mode)
+	}
+	metrics := make([]prometheus.Metric, 0, len(modes))
+	for _, m := range modes {
+		value := 0.0
+		if m == mode {
+			value = 1
+		}
+		metrics = append(
+			metrics,
+			prometheus.MustNewConstMetric(
+				c.listenerMode,
+				prometheus.GaugeValue,
+				value,
+				trustStoreARN,
+				listenerARN,
+				m,
+			),
+		)
+	}
+	return metrics
+}
+
+// targetHealth returns the number of healthy targets and the total number of
+// targets in the target groups of the load balancers the listeners belong to.
+func targetHealth(ctx context.Context, svc ELBAPI, listeners []types.Listener) (healthy int, total int, err error) {
+	loadBalancers := make(map[string]struct{})
+	for _, listener := range listeners {
+		loadBalancers[aws.ToString(listener.LoadBalancerArn)] = struct{}{}
+	}
+
+	targetGroups := make(map[string]struct{})
+	for arn := range loadBalancers {
+		paginator := elasticloadbalancingv2.NewDescribeTargetGroupsPaginator(
+			svc,
+			&elasticloadbalancingv2.DescribeTargetGroupsInput{LoadBalancerArn: aws.String(arn)},
+		)
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return 0, 0, err
+			}
+			for _, tg := range page.TargetGroups {
+				targetGroups[aws.ToString(tg.TargetGroupArn)] = struct{}{}
+			}
+		}
+	}
+
+	for arn := range targetGroups {
+		out, err := svc.DescribeTargetHealth(ctx, &elasticloadbalancingv2.DescribeTargetHealthInput{
+			TargetGroupArn: aws.String(arn),
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, desc := range out.TargetHealthDescriptions {
+			total++
+			if desc.TargetHealth != nil && desc.TargetHealth.State == types.TargetHealthStateEnumHealthy {
+				healthy++
+			}
+		}
+	}
+	return healthy, total, nil
+}
@@ -1,122 +1,798 @@
 package collector
 
 import (
+	"bytes"
 	"context"
+	"crypto/dsa" //nolint:staticcheck // DSA keys are still found in legacy CA bundles.
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
-	"io"
 	"log"
-	"net/http"
+	"regexp"
+	"slices"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
 	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/panubo/elb-trust-store-exporter/events"
+	"github.com/panubo/elb-trust-store-exporter/maintenance"
+	"github.com/panubo/elb-trust-store-exporter/shard"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Namespace is the prefix of the names of the exporter's metrics.
+const Namespace = "elb_trust_store"
+
+// Certificate expiry severities.
 const (
-	namespace = "elb_trust_store"
+	severityOK       = "ok"
+	severityWarning  = "warning"
+	severityCritical = "critical"
 )
 
+// Time sources for evaluating time-derived certificate metrics.
+const (
+	// TimeSourceScrape evaluates metrics at the time of the AWS API scrape.
+	TimeSourceScrape = "scrape"
+	// TimeSourceCollect evaluates metrics when they are collected.
+	TimeSourceCollect = "collect"
+)
+
+// Certificate classes.
+const (
+	certClassRoot         = "root"
+	certClassIntermediate = "intermediate"
+	certClassUnknown      = "unknown"
+)
+
+// Reasons a certificate is weak.
+const (
+	weakMD5Signature  = "md5_signature"
+	weakSHA1Signature = "sha1_signature"
+	weakRSAKeySize    = "rsa_key_size"
+	weakCurve         = "deprecated_curve"
+	weakDSAKey        = "dsa_key"
+)
+
+// minRSAKeySize is the smallest RSA key size in bits that is not weak.
+const minRSAKeySize = 2048
+
+// Reasons a certificate is skipped.
+const (
+	certificateErrorParse          = "parse"
+	certificateErrorUnsupportedKey = "unsupported_key"
+)
+
+// Options configures which trust stores are collected and how often.
+type Options struct {
+	Region         string
+	TrustStoreARNs []string
+	// TrustStoreARNsSSMParameter is the name of an SSM StringList parameter
+	// holding further trust store ARNs to monitor, read on every scrape.
+	TrustStoreARNsSSMParameter string
+	QueryInterval              time.Duration
+	// QueryJitter is the maximum random delay added to every QueryInterval
+	// of background scrapes, so exporters started together spread their
+	// AWS API requests out over time.
+	QueryJitter time.Duration
+	// TrustStoreIntervals sets the query interval of matching trust stores,
+	// in place of QueryInterval. Background scrapes run at the shortest
+	// interval, and only collect the trust stores that are due.
+	TrustStoreIntervals []TrustStoreInterval
+	// DiscoveryInterval is the interval at which trust stores are
+	// discovered, if shorter than their query intervals. Scrapes then run
+	// at this interval and only collect the trust stores that are new or
+	// due, so new trust stores are collected without waiting for the next
+	// QueryInterval. Zero discovers trust stores on every QueryInterval.
+	DiscoveryInterval time.Duration
+	// CacheTTL is the maximum age of cached data that is served. Passive
+	// collectors only query the AWS API once cached data is older than this.
+	// Zero disables caching for passive collectors and serves cached data
+	// until the next scrape otherwise.
+	CacheTTL time.Duration
+	// MetricTimestamps exposes the trust store and certificate metrics with
+	// the time of the scrape that produced them, so Prometheus stops
+	// returning them once scrapes stop rather than serving stale values.
+	MetricTimestamps bool
+	// AWSMaxAttempts is the maximum number of attempts for each AWS API call.
+	// Zero uses the SDK default.
+	AWSMaxAttempts int
+	// AWSRetryMode selects the SDK retry strategy. Empty uses the SDK default.
+	AWSRetryMode aws.RetryMode
+	// AWSProfile selects a named profile from the shared AWS configuration
+	// files. Empty uses the SDK default, which honours AWS_PROFILE.
+	AWSProfile string
+	// AWSUseFIPS uses the FIPS endpoints of every AWS API.
+	AWSUseFIPS bool
+	// AWSUseDualStack uses the dual-stack endpoints of every AWS API, and of
+	// S3 to download CA bundles and revocation lists, for IPv6 networks.
+	AWSUseDualStack bool
+	// AWSEndpointURL overrides the endpoint of every AWS API, for example to
+	// use LocalStack. Empty uses the SDK default.
+	AWSEndpointURL   string
+	IncludeNameRegex *regexp.Regexp
+	ExcludeNameRegex *regexp.Regexp
+	// IdentityCheckInterval is how often to check the identity of the AWS
+	// credentials with STS GetCallerIdentity, starting with the first scrape.
+	// Zero disables the check.
+	IdentityCheckInterval time.Duration
+	// MaxConcurrency is the number of trust stores collected in parallel.
+	MaxConcurrency int
+	// RemovedRetentionCycles is the number of scrapes for which a trust store
+	// that disappeared from discovery is reported as removed.
+	RemovedRetentionCycles int
+	// RemovedCertificateRetentionCycles is the number of scrapes for which a
+	// certificate that disappeared from its trust store's bundle is still
+	// reported by the certificate info metric, labeled removed.
+	RemovedCertificateRetentionCycles int
+	// AnomalyReplacedPercent is the percentage of a trust store's certificates
+	// that must be replaced by a single bundle change for it to be reported as
+	// an anomaly. Zero disables the check.
+	AnomalyReplacedPercent int
+	// NotFoundTTL is how long a configured trust store ARN that does not exist
+	// is skipped before it is queried again.
+	NotFoundTTL time.Duration
+	// ExpiryTimeSource selects when time-derived certificate metrics, such as
+	// age and expiry, are evaluated. It defaults to TimeSourceScrape.
+	ExpiryTimeSource string
+	// ExpiryWarningThreshold and ExpiryCriticalThreshold are the times before
+	// expiry at which a certificate's expiry severity becomes warning and
+	// critical.
+	ExpiryWarningThreshold  time.Duration
+	ExpiryCriticalThreshold time.Duration
+	// EvaluateRules enables the built-in alerting rules, which publish events
+	// as they start and stop firing.
+	EvaluateRules bool
+	// ExpiringThresholds are the times before expiry for which the number of
+	// certificates expiring within them is exported per trust store.
+	ExpiringThresholds []ExpiringThreshold
+	// CollectListeners enables metrics about the listeners that use each
+	// trust store.
+	CollectListeners bool
+	// CollectAssociations enables counting the listeners and load balancers
+	// each trust store is associated with.
+	CollectAssociations bool
+	// CrossStoreDuplicates enables counting the certificates in each
+	// trust store that are also in another monitored trust store.
+	CrossStoreDuplicates bool
+	// CollectTargetHealth enables metrics about the health of the targets
+	// behind the load balancers that use each trust store.
+	CollectTargetHealth bool
+	// CertificateInfoLabels are the labels of CertificateInfoLabels exported
+	// on the certificate info metric. All are exported if it is empty.
+	CertificateInfoLabels []string
+	// DisableCertificateInfo stops the certificate info metric from being
+	// exported, for users who only need trust store level metrics.
+	DisableCertificateInfo bool
+	// TrustStoreTags are the AWS tag keys added as labels to the info metric.
+	// See TagLabelName for how the label names are derived.
+	TrustStoreTags []string
+	// ShardCount is the number of exporter replicas the trust stores are
+	// sharded across by consistent hashing of their ARNs, and ShardIndex the
+	// replica this collector collects for. A ShardCount of 0 or 1 disables
+	// sharding. ShardVirtualNodes is the number of points each replica has on
+	// the hash ring, shard.DefaultVirtualNodes if zero.
+	ShardCount        int
+	ShardIndex        int
+	ShardVirtualNodes int
+	// WarmupDuration is the period over which the monitored trust stores are
+	// onboarded in WarmupSteps equal steps, scraping every step, rather than
+	// all being collected by the first scrape. It starts at WarmupStart, or
+	// when the collector is created if that is zero. Zero disables warm-up.
+	WarmupDuration time.Duration
+	WarmupSteps    int
+	WarmupStart    time.Time
+	// MaxSeries is the maximum number of trust store and certificate series.
+	// When exceeded only trust store level metrics are exported. Zero means no
+	// limit.
+	MaxSeries int
+	// StaleMaxAge is how long after the last successful scrape its trust store
+	// metrics are served in place of those of failed scrapes, after which
+	// the metrics of the failed scrapes are served. Zero serves the metrics of
+	// failed scrapes straight away, unless they were restored from
+	// LastGoodFile.
+	StaleMaxAge time.Duration
+	// LastGoodFile is the path of a file the trust store metrics of each
+	// successful scrape are saved to. They are restored from it when the
+	// collector is created and served in place of the results of failed
+	// scrapes until a scrape succeeds, so a restart during an AWS outage does
+	// not drop every series. Empty disables saving.
+	LastGoodFile string
+	// Events receives scrape and change events. It may be nil.
+	Events *events.Broker
+	// MaintenanceWindows silence the events and expiry metrics of the trust
+	// stores they cover while they are active.
+	MaintenanceWindows []*maintenance.Window
+}
+
 type Collector struct {
-	mutex                         sync.Mutex
-	metrics                       []prometheus.Metric
-	scrapeInterval                time.Duration
-	region                        string
-	trustStoreARNs                []string
-	collectorSuccess              *prometheus.Desc
-	certificateInfo               *prometheus.Desc
-	certificateNotBefore          *prometheus.Desc
-	certificateExpiry             *prometheus.Desc
-	trustStoreInfo                *prometheus.Desc
-	trustStoreCertificates        *prometheus.Desc
-	trustStoreRevokedEntries      *prometheus.Desc
-	exporterLastScrapeTimestamp   *prometheus.Desc
-	exporterScrapeDurationSeconds *prometheus.Desc
-	exporterScrapeInterval        *prometheus.Desc
-}
-
-func New(region string, arns []string, interval time.Duration) *Collector {
+	scrapeMutex       sync.Mutex
+	result            atomic.Pointer[scrapeResult]
+	generation        uint64
+	created           time.Time
+	ring              *shard.Ring
+	opts              Options
+	passive           bool
+	ctx               context.Context
+	cancel            context.CancelFunc
+	awsConfig         *aws.Config
+	elb               ELBAPI
+	ssm               SSMAPI
+	ssmARNs           []string
+	httpClient        HTTPClient
+	apiMetrics        *apiMetrics
+	certificateErrors *prometheus.CounterVec
+	recorder          SnapshotRecorder
+	leader            Leader
+	bundleMutex       sync.Mutex
+	bundles           map[string]*cachedBundle
+	seen              map[string]struct{}
+	removed           map[string]int
+	// collected holds the data of each trust store collected with
+	// TrustStoreIntervals or a DiscoveryInterval, keyed by trust store ARN,
+	// to serve until it is due again.
+	collected map[string]*trustStoreData
+	// certificatesSeen and certificatesRemoved track the certificates of each
+	// trust store, keyed by trust store ARN and certificate fingerprint.
+	certificatesSeen    map[string]map[string][]string
+	certificatesRemoved map[string]map[string]*removedCertificate
+	// bundleStates holds the last collected bundle of each trust store, keyed
+	// by trust store ARN, to detect anomalous bundle changes.
+	bundleStates map[string]*bundleState
+	// bundleChangeCounts is the number of changes to the bundle of each trust
+	// store since it was first collected, keyed by trust store ARN.
+	bundleChangeCounts map[string]int
+	// listenersSeen holds the ARNs of the listeners that used each trust store
+	// when it was last collected, keyed by trust store ARN, so listeners that
+	// stop referencing it are still described.
+	listenerMutex sync.Mutex
+	listenersSeen map[string][]string
+	// lastGood is the result of the last successful scrape, or the metrics
+	// restored from the last good file, whose trust store metrics are served
+	// in place of those of failed scrapes as the stale data policy allows.
+	lastGood            *scrapeResult
+	consecutiveFailures int
+	// notLeader is set while scrapes are skipped because the collector is
+	// not the leader, so only the changes are logged.
+	notLeader bool
+	// identity is the identity of the AWS credentials last returned by STS,
+	// identityOK whether the last check succeeded and identityChecked when
+	// it was made.
+	identity        *callerIdentity
+	identityOK      bool
+	identityChecked time.Time
+	// firing holds the alerts of the built-in rules that are firing, keyed by
+	// alert key.
+	firing                         map[string]alert
+	notFound                       map[string]time.Time
+	targetErrors                   map[string]string
+	collectorSuccess               *prometheus.Desc
+	certificateInfo                *prometheus.Desc
+	certificateInfoLabels          []string
+	certificateNotBefore           *prometheus.Desc
+	certificateExpiry              *prometheus.Desc
+	certificateAge                 *prometheus.Desc
+	certificateExpired             *prometheus.Desc
+	certificateExpirySeverity      *prometheus.Desc
+	certificateHasRevocationList   *prometheus.Desc
+	certificateIsCA                *prometheus.Desc
+	certificatePathLength          *prometheus.Desc
+	certificateConstraintsCritical *prometheus.Desc
+	certificateWeak                *prometheus.Desc
+	certificateChainComplete       *prometheus.Desc
+	trustStoreInfo                 *prometheus.Desc
+	trustStoreCertificates         *prometheus.Desc
+	trustStoreRevokedEntries       *prometheus.Desc
+	trustStoreStatus               *prometheus.Desc
+	certificatesExpiring           *prometheus.Desc
+	duplicateCertificates          *prometheus.Desc
+	crossStoreDuplicates           *prometheus.Desc
+	trustStoreRemoved              *prometheus.Desc
+	bundleBytes                    *prometheus.Desc
+	bundleDownloadDuration         *prometheus.Desc
+	bundleCached                   *prometheus.Desc
+	bundleAnomaly                  *prometheus.Desc
+	bundleHashInfo                 *prometheus.Desc
+	bundleChanges                  *prometheus.Desc
+	bundleCertificatesAdded        *prometheus.Desc
+	bundleCertificatesRemoved      *prometheus.Desc
+	trustStoreNotFound             *prometheus.Desc
+	configuredTargetError          *prometheus.Desc
+	listenerPassthrough            *prometheus.Desc
+	listenerMode                   *prometheus.Desc
+	listenerIgnoreExpiry           *prometheus.Desc
+	listenerAdvertiseCANames       *prometheus.Desc
+	associations                   *prometheus.Desc
+	healthyTargets                 *prometheus.Desc
+	targets                        *prometheus.Desc
+	exporterLastScrapeTimestamp    *prometheus.Desc
+	exporterScrapeDurationSeconds  *prometheus.Desc
+	exporterScrapeInterval         *prometheus.Desc
+	exporterTrustStoresDiscovered  *prometheus.Desc
+	exporterDescribeBatches        *prometheus.Desc
+	exporterCacheTTL               *prometheus.Desc
+	exporterEstimatedSeries        *prometheus.Desc
+	exporterMaxSeriesExceeded      *prometheus.Desc
+	exporterResultRestored         *prometheus.Desc
+	exporterServingStale           *prometheus.Desc
+	exporterConsecutiveFailures    *prometheus.Desc
+	exporterDataAge                *prometheus.Desc
+	exporterScrapeAPIRequests      *prometheus.Desc
+	exporterScrapeS3Requests       *prometheus.Desc
+	exporterScrapeS3Bytes          *prometheus.Desc
+	exporterMaintenanceWindow      *prometheus.Desc
+	exporterGeneration             *prometheus.Desc
+	exporterOnboarded              *prometheus.Desc
+	exporterCachedTrustStores      *prometheus.Desc
+	exporterShardAssigned          *prometheus.Desc
+	exporterOnboardingProgress     *prometheus.Desc
+	exporterIdentity               *prometheus.Desc
+	exporterIdentityCheckSuccess   *prometheus.Desc
+	exporterCredentialsExpiry      *prometheus.Desc
+}
+
+// New returns a Collector that scrapes the AWS API immediately and then in the
+// background every QueryInterval, or the shortest of TrustStoreIntervals and
+// DiscoveryInterval.
+func New(opts Options, options ...Option) *Collector {
+	c := newCollector(opts, options)
+	c.scrape()
+	go c.backgroundScrape(c.scrapeInterval())
+	return c
+}
+
+// NewPassive returns a Collector that performs no background work and instead
+// scrapes the AWS API on every Collect, for embedding in an existing registry.
+func NewPassive(opts Options, options ...Option) *Collector {
+	c := newCollector(opts, options)
+	c.passive = true
+	return c
+}
+
+// Leader reports whether this replica is the leader of a group of replicas
+// monitoring the same trust stores.
+type Leader interface {
+	IsLeader() bool
+}
+
+// WithLeader sets the leader election of the replica. Scrapes are skipped
+// while it is not the leader, and the last result is served instead.
+func WithLeader(leader Leader) Option {
+	return func(c *Collector) {
+		c.leader = leader
+	}
+}
+
+func newCollector(opts Options, options []Option) *Collector {
+	infoLabels := []string{"trust_store_arn", "name", "region"}
+	for _, key := range opts.TrustStoreTags {
+		infoLabels = append(infoLabels, TagLabelName(key))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	c := &Collector{
-		scrapeInterval: interval,
-		region:         region,
-		trustStoreARNs: arns,
+		ctx:                 ctx,
+		cancel:              cancel,
+		opts:                opts,
+		created:             time.Now(),
+		removed:             make(map[string]int),
+		certificatesSeen:    make(map[string]map[string][]string),
+		certificatesRemoved: make(map[string]map[string]*removedCertificate),
+		bundleStates:        make(map[string]*bundleState),
+		bundleChangeCounts:  make(map[string]int),
+		listenersSeen:       make(map[string][]string),
+		notFound:            make(map[string]time.Time),
+		bundles:             make(map[string]*cachedBundle),
+		apiMetrics:          newAPIMetrics(),
+		certificateErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: "certificate",
+				Name:      "errors_total",
+				Help:      "The number of certificates skipped because they could not be parsed or have an unsupported public key.",
+			},
+			[]string{"trust_store_arn", "reason"},
+		),
+		httpClient: newDownloadClient(opts.AWSUseDualStack),
 		collectorSuccess: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "collector_success"),
+			prometheus.BuildFQName(Namespace, "", "collector_success"),
 			"Was the last scrape of the collector successful.",
 			nil,
 			nil,
 		),
+		certificateInfoLabels: certificateInfoLabelNames(opts.CertificateInfoLabels),
 		certificateInfo: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "certificate", "info"),
-			"Information about a certificate in a trust store.",
-			[]string{
-				"trust_store_arn",
-				"serial_number",
-				"issuer",
-				"subject",
-				"signature_algo",
-				"key_length",
-			},
+			prometheus.BuildFQName(Namespace, "certificate", "info"),
+			"Information about a certificate in a trust store. Certificates removed from the bundle are reported with removed=\"true\" for a number of scrapes.",
+			append(certificateInfoLabelNames(opts.CertificateInfoLabels), "removed"),
 			nil,
 		),
 		certificateNotBefore: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "certificate", "not_before"),
+			prometheus.BuildFQName(Namespace, "certificate", "not_before"),
 			"The timestamp of the start of the certificate's validity (in seconds since epoch).",
 			[]string{"trust_store_arn", "serial_number", "subject"},
 			nil,
 		),
 		certificateExpiry: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "certificate", "expiry"),
+			prometheus.BuildFQName(Namespace, "certificate", "expiry"),
 			"The timestamp of the certificate's expiry (in seconds since epoch).",
 			[]string{"trust_store_arn", "serial_number", "subject"},
 			nil,
 		),
+		certificateAge: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "certificate", "age_seconds"),
+			"The time elapsed since the start of the certificate's validity (in seconds).",
+			[]string{"trust_store_arn", "serial_number", "subject"},
+			nil,
+		),
+		certificateExpired: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "certificate", "expired"),
+			"Whether the certificate has expired.",
+			[]string{"trust_store_arn", "serial_number", "subject", "silenced"},
+			nil,
+		),
+		certificateExpirySeverity: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "certificate", "expiry_severity"),
+			"The severity of the certificate's time until expiry against the configured thresholds.",
+			[]string{"trust_store_arn", "serial_number", "subject", "severity", "silenced"},
+			nil,
+		),
+		certificateHasRevocationList: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "certificate", "has_revocation_list"),
+			"Whether a revocation list issued by the certificate is uploaded to the trust store.",
+			[]string{"trust_store_arn", "serial_number", "subject"},
+			nil,
+		),
+		certificateIsCA: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "certificate", "is_ca"),
+			"Whether the certificate has a basicConstraints extension marking it as a CA certificate.",
+			[]string{"trust_store_arn", "serial_number", "subject"},
+			nil,
+		),
+		certificatePathLength: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "certificate", "path_length_constraint"),
+			"The maximum number of intermediate CA certificates that may follow the CA certificate in a chain.",
+			[]string{"trust_store_arn", "serial_number", "subject"},
+			nil,
+		),
+		certificateConstraintsCritical: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "certificate", "basic_constraints_critical"),
+			"Whether the certificate's basicConstraints extension is marked critical.",
+			[]string{"trust_store_arn", "serial_number", "subject"},
+			nil,
+		),
+		certificateWeak: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "certificate", "weak"),
+			"Set for each reason the certificate's signature algorithm or public key is considered weak.",
+			[]string{"trust_store_arn", "serial_number", "subject", "reason"},
+			nil,
+		),
+		certificateChainComplete: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "certificate", "chain_complete"),
+			"Whether the certificate chains through certificates in the same trust store to a self-signed root in it.",
+			[]string{"trust_store_arn", "serial_number", "subject"},
+			nil,
+		),
 		trustStoreInfo: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "info"),
+			prometheus.BuildFQName(Namespace, "", "info"),
 			"Information about the trust store.",
-			[]string{"trust_store_arn", "name", "region"},
+			infoLabels,
 			nil,
 		),
 		trustStoreCertificates: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "certificates"),
+			prometheus.BuildFQName(Namespace, "", "certificates"),
 			"The number of CA certificates in the trust store.",
 			[]string{"trust_store_arn"},
 			nil,
 		),
 		trustStoreRevokedEntries: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "revoked_entries"),
+			prometheus.BuildFQName(Namespace, "", "revoked_entries"),
 			"The number of revoked entries in the trust store.",
 			[]string{"trust_store_arn"},
 			nil,
 		),
+		trustStoreStatus: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "status"),
+			"Whether the trust store is in the status, with a series for every known status.",
+			[]string{"trust_store_arn", "status"},
+			nil,
+		),
+		certificatesExpiring: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "certificates_expiring"),
+			"The number of CA certificates in the trust store that expire within the threshold, including those already expired.",
+			[]string{"trust_store_arn", "within"},
+			nil,
+		),
+		duplicateCertificates: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "duplicate_certificates"),
+			"The number of certificates in the trust store's bundle that are repeats of an earlier certificate with the same fingerprint.",
+			[]string{"trust_store_arn"},
+			nil,
+		),
+		crossStoreDuplicates: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "cross_store_duplicate_certificates"),
+			"The number of certificates in the trust store that are also in another monitored trust store.",
+			[]string{"trust_store_arn"},
+			nil,
+		),
+		bundleBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "bundle", "bytes"),
+			"The size of the downloaded CA certificates bundle.",
+			[]string{"trust_store_arn"},
+			nil,
+		),
+		bundleDownloadDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "bundle", "download_duration_seconds"),
+			"The time spent downloading the CA certificates bundle.",
+			[]string{"trust_store_arn"},
+			nil,
+		),
+		listenerPassthrough: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "listener", "passthrough"),
+			"Whether a listener using the trust store is in passthrough mode, forwarding client certificates to targets without verifying them.",
+			[]string{"trust_store_arn", "listener_arn"},
+			nil,
+		),
+		listenerMode: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "listener", "mutual_authentication_mode"),
+			"Whether a listener using the trust store is in the mutual TLS mode, with a series for every known mode.",
+			[]string{"trust_store_arn", "listener_arn", "mode"},
+			nil,
+		),
+		listenerIgnoreExpiry: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "listener", "ignore_client_certificate_expiry"),
+			"Whether a listener using the trust store accepts expired client certificates.",
+			[]string{"trust_store_arn", "listener_arn"},
+			nil,
+		),
+		listenerAdvertiseCANames: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "listener", "advertise_ca_names"),
+			"Whether a listener using the trust store advertises the subject names of the trust store's CAs to clients.",
+			[]string{"trust_store_arn", "listener_arn"},
+			nil,
+		),
+		associations: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "associations"),
+			"The number of listeners and load balancers the trust store is associated with.",
+			[]string{"trust_store_arn"},
+			nil,
+		),
+		healthyTargets: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "healthy_targets"),
+			"The number of healthy targets behind the load balancers that use the trust store.",
+			[]string{"trust_store_arn"},
+			nil,
+		),
+		targets: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "targets"),
+			"The number of targets behind the load balancers that use the trust store.",
+			[]string{"trust_store_arn"},
+			nil,
+		),
+		bundleCached: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "bundle", "cached"),
+			"Whether the CA certificates bundle was unchanged and served from the cache in the last scrape.",
+			[]string{"trust_store_arn"},
+			nil,
+		),
+		bundleAnomaly: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "bundle", "anomaly"),
+			"Whether the last change to the trust store's CA certificates bundle was suspicious, by type of anomaly.",
+			[]string{"trust_store_arn", "anomaly"},
+			nil,
+		),
+		bundleHashInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "bundle", "hash_info"),
+			"A metric with a constant '1' value labeled with the SHA-256 checksum of the trust store's CA certificates bundle.",
+			[]string{"trust_store_arn", "sha256"},
+			nil,
+		),
+		bundleChanges: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "bundle", "changes_total"),
+			"The number of changes to the trust store's CA certificates bundle seen since the exporter started.",
+			[]string{"trust_store_arn"},
+			nil,
+		),
+		bundleCertificatesAdded: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "bundle", "certificates_added"),
+			"The number of certificates added to the trust store's CA certificates bundle since the previous scrape.",
+			[]string{"trust_store_arn"},
+			nil,
+		),
+		bundleCertificatesRemoved: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "bundle", "certificates_removed"),
+			"The number of certificates removed from the trust store's CA certificates bundle since the previous scrape.",
+			[]string{"trust_store_arn"},
+			nil,
+		),
+		trustStoreRemoved: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "removed"),
+			"Set for a number of scrapes after a previously seen trust store is no longer discovered.",
+			[]string{"trust_store_arn"},
+			nil,
+		),
+		trustStoreNotFound: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "not_found"),
+			"Set for each configured trust store ARN that does not exist.",
+			[]string{"trust_store_arn"},
+			nil,
+		),
+		configuredTargetError: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "configured_target_error"),
+			"Set for each configured trust store ARN that could not be described in the last scrape.",
+			[]string{"trust_store_arn", "error_code"},
+			nil,
+		),
 		exporterLastScrapeTimestamp: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "exporter", "last_scrape_timestamp"),
+			prometheus.BuildFQName(Namespace, "exporter", "last_scrape_timestamp"),
 			"The timestamp of the last successful scrape of the AWS API.",
 			nil,
 			nil,
 		),
 		exporterScrapeDurationSeconds: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "exporter", "scrape_duration_seconds"),
+			prometheus.BuildFQName(Namespace, "exporter", "scrape_duration_seconds"),
 			"The duration of the last scrape of the AWS API.",
 			nil,
 			nil,
 		),
 		exporterScrapeInterval: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "exporter", "scrape_interval"),
+			prometheus.BuildFQName(Namespace, "exporter", "scrape_interval"),
 			"The interval between scraping the AWS API.",
 			nil,
 			nil,
 		),
+		exporterScrapeAPIRequests: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "scrape_aws_api_requests"),
+			"The number of AWS API request attempts made during the last scrape.",
+			nil,
+			nil,
+		),
+		exporterScrapeS3Requests: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "scrape_s3_requests"),
+			"The number of S3 GET requests made during the last scrape.",
+			nil,
+			nil,
+		),
+		exporterScrapeS3Bytes: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "scrape_s3_downloaded_bytes"),
+			"The number of bytes downloaded from S3 during the last scrape.",
+			nil,
+			nil,
+		),
+		exporterEstimatedSeries: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "estimated_series"),
+			"The number of trust store and certificate series produced by the last scrape, before applying the maximum.",
+			nil,
+			nil,
+		),
+		exporterMaxSeriesExceeded: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "max_series_exceeded"),
+			"Whether the last scrape exceeded the maximum number of series and per-certificate metrics are not exported.",
+			nil,
+			nil,
+		),
+		exporterResultRestored: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "result_restored"),
+			"Whether the trust store metrics served were restored from the last good file, as no scrape has succeeded since the exporter started.",
+			nil,
+			nil,
+		),
+		exporterServingStale: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "serving_stale"),
+			"Whether the trust store metrics served are those of an earlier successful scrape, as the last scrape failed.",
+			nil,
+			nil,
+		),
+		exporterConsecutiveFailures: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "consecutive_scrape_failures"),
+			"The number of scrapes that have failed since the last successful scrape.",
+			nil,
+			nil,
+		),
+		exporterDataAge: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "data_age_seconds"),
+			"The time since the scrape that produced the trust store metrics served.",
+			nil,
+			nil,
+		),
+		exporterCacheTTL: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "cache_ttl_seconds"),
+			"The maximum age of cached data served, zero if cached data does not expire.",
+			nil,
+			nil,
+		),
+		exporterTrustStoresDiscovered: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "trust_stores_discovered"),
+			"The number of trust stores returned by the AWS API in the last scrape.",
+			nil,
+			nil,
+		),
+		exporterDescribeBatches: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "describe_batches"),
+			"The number of DescribeTrustStores batches the configured trust store ARNs were split into in the last scrape.",
+			nil,
+			nil,
+		),
+		exporterShardAssigned: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "shard_assigned_trust_stores"),
+			"The number of discovered trust stores assigned to this replica's shard in the last scrape.",
+			[]string{"shard_index", "shard_count"},
+			nil,
+		),
+		exporterOnboarded: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "onboarded_trust_stores"),
+			"The number of monitored trust stores collected by the last scrape, fewer than monitored during warm-up.",
+			nil,
+			nil,
+		),
+		exporterCachedTrustStores: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "cached_trust_stores"),
+			"The number of monitored trust stores served from an earlier scrape by the last scrape, as their query interval had not passed.",
+			nil,
+			nil,
+		),
+		exporterOnboardingProgress: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "onboarding_progress_ratio"),
+			"The fraction of monitored trust stores onboarded by the last scrape, 1 once warm-up is complete.",
+			nil,
+			nil,
+		),
+		exporterGeneration: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "result_generation"),
+			"The number of scrape results published since the collector was built.",
+			nil,
+			nil,
+		),
+		exporterMaintenanceWindow: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "maintenance_window_active"),
+			"Whether the configured maintenance window is active.",
+			[]string{"window"},
+			nil,
+		),
+		exporterIdentity: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "aws_identity_info"),
+			"A metric with a constant '1' value labeled with the ARN, account and user ID of the AWS credentials, as last returned by STS GetCallerIdentity.",
+			[]string{"arn", "account", "user_id"},
+			nil,
+		),
+		exporterIdentityCheckSuccess: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "aws_identity_check_success"),
+			"Whether the last check of the AWS credentials with STS GetCallerIdentity was successful.",
+			nil,
+			nil,
+		),
+		exporterCredentialsExpiry: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "aws_credentials_expiry_timestamp_seconds"),
+			"The time the AWS credentials expire, for temporary credentials such as those of an assumed role.",
+			nil,
+			nil,
+		),
+	}
+	if opts.ShardCount > 1 {
+		c.ring = shard.NewRing(opts.ShardCount, opts.ShardVirtualNodes)
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if opts.LastGoodFile != "" {
+		restored, err := loadLastGood(opts.LastGoodFile)
+		if err != nil {
+			log.Printf("Error restoring last good metrics: %v", err)
+		} else if restored != nil {
+			log.Printf("Restored %d last good metrics from %s", len(restored.metrics), opts.LastGoodFile)
+			c.lastGood = restored
+		}
 	}
-	c.scrape()
-	go c.backgroundScrape(interval)
 	return c
 }
 
@@ -125,141 +801,956 @@ func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.certificateInfo
 	ch <- c.certificateNotBefore
 	ch <- c.certificateExpiry
+	ch <- c.certificateAge
+	ch <- c.certificateExpired
+	ch <- c.certificateExpirySeverity
+	ch <- c.certificateHasRevocationList
+	ch <- c.certificateIsCA
+	ch <- c.certificatePathLength
+	ch <- c.certificateConstraintsCritical
+	ch <- c.certificateWeak
+	ch <- c.certificateChainComplete
 	ch <- c.trustStoreInfo
 	ch <- c.trustStoreCertificates
 	ch <- c.trustStoreRevokedEntries
+	ch <- c.trustStoreStatus
+	ch <- c.certificatesExpiring
+	ch <- c.duplicateCertificates
+	ch <- c.crossStoreDuplicates
+	ch <- c.trustStoreRemoved
+	ch <- c.bundleBytes
+	ch <- c.bundleDownloadDuration
+	ch <- c.bundleCached
+	ch <- c.bundleAnomaly
+	ch <- c.bundleHashInfo
+	ch <- c.bundleChanges
+	ch <- c.bundleCertificatesAdded
+	ch <- c.bundleCertificatesRemoved
+	ch <- c.trustStoreNotFound
+	ch <- c.configuredTargetError
+	ch <- c.listenerPassthrough
+	ch <- c.listenerMode
+	ch <- c.listenerIgnoreExpiry
+	ch <- c.listenerAdvertiseCANames
+	ch <- c.associations
+	ch <- c.healthyTargets
+	ch <- c.targets
 	ch <- c.exporterLastScrapeTimestamp
 	ch <- c.exporterScrapeDurationSeconds
 	ch <- c.exporterScrapeInterval
+	ch <- c.exporterTrustStoresDiscovered
+	ch <- c.exporterDescribeBatches
+	ch <- c.exporterCacheTTL
+	ch <- c.exporterEstimatedSeries
+	ch <- c.exporterMaxSeriesExceeded
+	ch <- c.exporterResultRestored
+	ch <- c.exporterServingStale
+	ch <- c.exporterConsecutiveFailures
+	ch <- c.exporterDataAge
+	ch <- c.exporterScrapeAPIRequests
+	ch <- c.exporterScrapeS3Requests
+	ch <- c.exporterScrapeS3Bytes
+	ch <- c.exporterMaintenanceWindow
+	ch <- c.exporterGeneration
+	ch <- c.exporterOnboarded
+	ch <- c.exporterCachedTrustStores
+	ch <- c.exporterShardAssigned
+	ch <- c.exporterOnboardingProgress
+	ch <- c.exporterIdentity
+	ch <- c.exporterIdentityCheckSuccess
+	ch <- c.exporterCredentialsExpiry
+	c.apiMetrics.Describe(ch)
+	c.certificateErrors.Describe(ch)
 }
 
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	for _, m := range c.metrics {
+	if c.passive {
+		c.scrapeIfStale()
+	}
+
+	now := time.Now()
+	r := c.result.Load()
+	if r == nil {
+		r = &scrapeResult{}
+	}
+	if c.opts.CacheTTL == 0 || c.fresh(r) {
+		data, wait := ch, func() {}
+		if c.opts.MetricTimestamps && !r.time.IsZero() {
+			data, wait = withTimestamp(ch, r.time)
+		}
+		for _, m := range r.metrics {
+			data <- m
+		}
+
+		evaluatedAt := r.time
+		if c.opts.ExpiryTimeSource == TimeSourceCollect {
+			evaluatedAt = now
+		}
+		c.collectTimeDerived(data, r, evaluatedAt, now)
+		c.collectExpiring(data, r, evaluatedAt)
+		wait()
+	}
+	for _, m := range r.exporterMetrics {
 		ch <- m
 	}
+	if !r.time.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.exporterDataAge, prometheus.GaugeValue, now.Sub(r.time).Seconds())
+	}
+	for _, w := range c.opts.MaintenanceWindows {
+		active := 0.0
+		if w.Active(now) {
+			active = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.exporterMaintenanceWindow, prometheus.GaugeValue, active, w.Name())
+	}
+	c.apiMetrics.Collect(ch)
+	c.certificateErrors.Collect(ch)
+}
+
+// withTimestamp returns a channel that forwards metrics to ch with the given
+// timestamp, and a function that closes it and waits for them to be sent.
+func withTimestamp(ch chan<- prometheus.Metric, t time.Time) (chan<- prometheus.Metric, func()) {
+	in := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for m := range in {
+			ch <- prometheus.NewMetricWithTimestamp(t, m)
+		}
+	}()
+	return in, func() {
+		close(in)
+		<-done
+	}
+}
+
+// timeDerivedSeriesPerCertificate is the number of series collectTimeDerived
+// sends for each certificate.
+const timeDerivedSeriesPerCertificate = 5
+
+// collectTimeDerived sends the certificate metrics of a scrape result that
+// depend on the time at which they are evaluated. Expiry metrics are labeled
+// silenced if a maintenance window covering the trust store is active at now.
+func (c *Collector) collectTimeDerived(ch chan<- prometheus.Metric, r *scrapeResult, at, now time.Time) {
+	if r.summaryOnly {
+		return
+	}
+	for _, data := range r.trustStores {
+		silenced := strconv.FormatBool(maintenance.Silenced(c.opts.MaintenanceWindows, *data.trustStore.TrustStoreArn, now))
+		for _, cert := range data.certificates {
+			ch <- prometheus.MustNewConstMetric(
+				c.certificateAge,
+				prometheus.GaugeValue,
+				at.Sub(cert.NotBefore).Seconds(),
+				*data.trustStore.TrustStoreArn,
+				cert.SerialNumber.String(),
+				cert.Subject.String(),
+			)
+
+			expired := 0.0
+			if at.After(cert.NotAfter) {
+				expired = 1
+			}
+			ch <- prometheus.MustNewConstMetric(
+				c.certificateExpired,
+				prometheus.GaugeValue,
+				expired,
+				*data.trustStore.TrustStoreArn,
+				cert.SerialNumber.String(),
+				cert.Subject.String(),
+				silenced,
+			)
+
+			current := c.expirySeverity(cert, at)
+			for _, severity := range []string{severityOK, severityWarning, severityCritical} {
+				value := 0.0
+				if severity == current {
+					value = 1
+				}
+				ch <- prometheus.MustNewConstMetric(
+					c.certificateExpirySeverity,
+					prometheus.GaugeValue,
+					value,
+					*data.trustStore.TrustStoreArn,
+					cert.SerialNumber.String(),
+					cert.Subject.String(),
+					severity,
+					silenced,
+				)
+			}
+		}
+	}
+}
+
+// fingerprint returns the hex encoded SHA-256 fingerprint of the certificate.
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// oidBasicConstraints is the object identifier of the basicConstraints
+// extension.
+var oidBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+
+// basicConstraintsCritical reports whether the certificate has a
+// basicConstraints extension marked critical, which crypto/x509 does not
+// expose directly.
+func basicConstraintsCritical(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidBasicConstraints) {
+			return ext.Critical
+		}
+	}
+	return false
+}
+
+// publicKeyInfo returns the algorithm and size in bits of the certificate's
+// public key.
+func publicKeyInfo(cert *x509.Certificate) (string, int, error) {
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return x509.RSA.String(), pub.N.BitLen(), nil
+	case *ecdsa.PublicKey:
+		return x509.ECDSA.String(), pub.Curve.Params().BitSize, nil
+	case ed25519.PublicKey:
+		return x509.Ed25519.String(), len(pub) * 8, nil
+	case *dsa.PublicKey:
+		return x509.DSA.String(), pub.P.BitLen(), nil
+	default:
+		return "", 0, errors.New("unknown public key type")
+	}
+}
+
+// certClass classifies a certificate as a self-signed root, an intermediate
+// issued by a different CA, or unknown. A certificate whose issuer is its own
+// subject is only a root if its signature verifies with its own key, which
+// crypto/x509 refuses to do for SHA-1 and MD5 signatures.
+func certClass(cert *x509.Certificate) string {
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		if cert.BasicConstraintsValid && cert.IsCA {
+			return certClassIntermediate
+		}
+		return certClassUnknown
+	}
+	if cert.CheckSignatureFrom(cert) == nil {
+		return certClassRoot
+	}
+	return certClassUnknown
+}
+
+// weaknesses returns the reasons the certificate's signature algorithm or
+// public key is considered weak.
+func weaknesses(cert *x509.Certificate) []string {
+	var reasons []string
+	switch cert.SignatureAlgorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA:
+		reasons = append(reasons, weakMD5Signature)
+	case x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		reasons = append(reasons, weakSHA1Signature)
+	}
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSAKeySize {
+			reasons = append(reasons, weakRSAKeySize)
+		}
+	case *ecdsa.PublicKey:
+		// P-224 is the only curve crypto/x509 parses that no longer meets
+		// current guidance. Certificates on other curves are not parsed.
+		if pub.Curve == elliptic.P224() {
+			reasons = append(reasons, weakCurve)
+		}
+	case *dsa.PublicKey:
+		reasons = append(reasons, weakDSAKey)
+	}
+	return reasons
+}
+
+// expirySeverity classifies the time remaining until the certificate expires
+// against the configured thresholds.
+func (c *Collector) expirySeverity(cert *x509.Certificate, at time.Time) string {
+	remaining := cert.NotAfter.Sub(at)
+	switch {
+	case remaining <= c.opts.ExpiryCriticalThreshold:
+		return severityCritical
+	case remaining <= c.opts.ExpiryWarningThreshold:
+		return severityWarning
+	default:
+		return severityOK
+	}
+}
+
+// fresh reports whether a scrape result is younger than CacheTTL.
+func (c *Collector) fresh(r *scrapeResult) bool {
+	return r != nil && !r.time.IsZero() && time.Since(r.time) < c.opts.CacheTTL
+}
+
+// scrapeIfStale scrapes the AWS API unless the cached data is still fresh.
+func (c *Collector) scrapeIfStale() {
+	c.scrapeMutex.Lock()
+	defer c.scrapeMutex.Unlock()
+
+	if !c.fresh(c.result.Load()) {
+		c.runScrape()
+	}
 }
 
 func (c *Collector) backgroundScrape(interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	timer := time.NewTimer(c.nextScrapeInterval(interval, time.Now()))
+	defer timer.Stop()
 
-	for range ticker.C {
-		c.scrape()
+	for {
+		select {
+		case <-timer.C:
+			c.scrape()
+			timer.Reset(c.nextScrapeInterval(interval, time.Now()))
+		case <-c.ctx.Done():
+			return
+		}
 	}
 }
 
+// Stop ends background scraping, cancels any in-flight scrape and waits for it
+// to return. The last completed scrape is still served.
+func (c *Collector) Stop() {
+	c.cancel()
+	c.scrapeMutex.Lock()
+	defer c.scrapeMutex.Unlock()
+}
+
+// Scrape queries the AWS API straight away rather than at the next query
+// interval, and returns once the result is published. It does nothing once
+// the collector is stopped.
+func (c *Collector) Scrape() {
+	if c.ctx.Err() != nil {
+		return
+	}
+	c.scrape()
+}
+
 func (c *Collector) scrape() {
+	c.scrapeMutex.Lock()
+	defer c.scrapeMutex.Unlock()
+	c.runScrape()
+}
+
+// runScrape queries the AWS API and replaces the cached metrics. The caller
+// must hold c.scrapeMutex.
+func (c *Collector) runScrape() {
+	if c.leader != nil && !c.leader.IsLeader() {
+		if !c.notLeader {
+			log.Println("Not the leader, skipping scrapes")
+			c.notLeader = true
+		}
+		return
+	}
+	if c.notLeader {
+		log.Println("Became the leader, resuming scrapes")
+		c.notLeader = false
+	}
 	log.Println("Scraping metrics")
 	now := time.Now()
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	c.publish(events.Event{Type: events.ScrapeStarted, Time: now})
+	ctx, cancel := context.WithTimeout(c.ctx, time.Minute)
 	defer cancel()
+	c.apiMetrics.resetCycle()
 
-	var metrics []prometheus.Metric
+	var (
+		metrics           []prometheus.Metric
+		statusMetrics     []prometheus.Metric
+		trustStoreResults []*trustStoreData
+		failures          []FailedTrustStore
+		series            int
+		summaryOnly       bool
+	)
 	success := true
 
-	var cfgOpts []func(*config.LoadOptions) error
-	if c.region != "" {
-		cfgOpts = append(cfgOpts, config.WithRegion(c.region))
-	}
-	cfg, err := config.LoadDefaultConfig(ctx, cfgOpts...)
+	svc, err := c.elbClient(ctx)
 	if err != nil {
 		log.Printf("Error creating AWS config: %v", err)
 		success = false
-	}
-
-	if success {
-		svc := elasticloadbalancingv2.NewFromConfig(cfg)
-
-		input := &elasticloadbalancingv2.DescribeTrustStoresInput{}
-		if len(c.trustStoreARNs) > 0 {
-			input.TrustStoreArns = c.trustStoreARNs
-		}
+	}
+	identityMetrics := c.checkIdentity(ctx, now)
 
-		result, err := svc.DescribeTrustStores(ctx, input)
+	if success {
+		trustStores, batches, err := c.discoverTrustStores(ctx, svc)
 		if err != nil {
 			log.Printf("Error describing trust stores: %v", err)
 			success = false
 		}
 
 		if success {
-			log.Printf("Found %d trust stores", len(result.TrustStores))
-
-			for _, ts := range result.TrustStores {
-				if err := c.collectTrustStoreMetrics(ctx, svc, ts, &metrics); err != nil {
-					log.Printf(
-						"Error collecting metrics for trust store %s: %v",
-						*ts.TrustStoreArn,
-						err,
-					)
-					success = false
+			log.Printf("Found %d trust stores", len(trustStores))
+			metrics = append(
+				metrics,
+				prometheus.MustNewConstMetric(
+					c.exporterTrustStoresDiscovered,
+					prometheus.GaugeValue,
+					float64(len(trustStores)),
+				),
+			)
+			metrics = append(
+				metrics,
+				prometheus.MustNewConstMetric(
+					c.exporterDescribeBatches,
+					prometheus.GaugeValue,
+					float64(batches),
+				),
+			)
+
+			for arn := range c.notFound {
+				metrics = append(
+					metrics,
+					prometheus.MustNewConstMetric(c.trustStoreNotFound, prometheus.GaugeValue, 1, arn),
+				)
+			}
+			for arn, code := range c.targetErrors {
+				metrics = append(
+					metrics,
+					prometheus.MustNewConstMetric(c.configuredTargetError, prometheus.GaugeValue, 1, arn, code),
+				)
+			}
+
+			var monitored []types.TrustStore
+			for _, ts := range trustStores {
+				if c.matchesName(*ts.Name) && c.inShard(*ts.TrustStoreArn) {
+					monitored = append(monitored, ts)
+				}
+			}
+			// The status comes from this scrape's DescribeTrustStores, so it is
+			// exported whether or not the trust store is collected.
+			for _, ts := range monitored {
+				statusMetrics = append(statusMetrics, c.trustStoreStatusMetrics(*ts.TrustStoreArn, ts.Status)...)
+			}
+			if c.ring != nil {
+				metrics = append(
+					metrics,
+					prometheus.MustNewConstMetric(
+						c.exporterShardAssigned,
+						prometheus.GaugeValue,
+						float64(len(monitored)),
+						strconv.Itoa(c.opts.ShardIndex),
+						strconv.Itoa(c.opts.ShardCount),
+					),
+				)
+			}
+
+			for _, arn := range c.trackRemoved(monitored) {
+				metrics = append(
+					metrics,
+					prometheus.MustNewConstMetric(c.trustStoreRemoved, prometheus.GaugeValue, 1, arn),
+				)
+			}
+
+			onboarded := c.onboard(monitored, now)
+			if len(onboarded) < len(monitored) {
+				log.Printf("Warming up: collecting %d of %d trust stores", len(onboarded), len(monitored))
+			}
+			progress := 1.0
+			if len(monitored) > 0 {
+				progress = float64(len(onboarded)) / float64(len(monitored))
+			}
+			metrics = append(
+				metrics,
+				prometheus.MustNewConstMetric(c.exporterOnboarded, prometheus.GaugeValue, float64(len(onboarded))),
+				prometheus.MustNewConstMetric(c.exporterOnboardingProgress, prometheus.GaugeValue, progress),
+			)
+			monitored = onboarded
+
+			// Trust stores whose query interval has not passed are served
+			// from the data of their last collection.
+			due, cached := c.due(monitored, now)
+			if len(cached) > 0 {
+				log.Printf("Collecting %d trust stores, %d are not due", len(due), len(cached))
+			}
+			metrics = append(
+				metrics,
+				prometheus.MustNewConstMetric(c.exporterCachedTrustStores, prometheus.GaugeValue, float64(len(cached))),
+			)
+
+			tags, err := c.describeTags(ctx, svc, due)
+			if err != nil {
+				log.Printf("Error describing trust store tags: %v", err)
+				success = false
+			}
+
+			trustStoreResults, failures = c.collectTrustStores(ctx, svc, due, tags)
+			for _, data := range trustStoreResults {
+				data.collected = now
+			}
+			c.trackRemovedCertificates(trustStoreResults)
+			c.trackBundleChanges(trustStoreResults)
+			c.detectAnomalies(trustStoreResults)
+			trustStoreResults = append(trustStoreResults, cached...)
+			c.trackCollected(trustStoreResults)
+			for _, data := range trustStoreResults {
+				metrics = append(metrics, data.metrics...)
+			}
+			if c.opts.CrossStoreDuplicates {
+				metrics = append(metrics, c.crossStoreDuplicateMetrics(trustStoreResults)...)
+			}
+
+			series = len(metrics) + len(statusMetrics) + len(trustStoreResults)*len(c.opts.ExpiringThresholds)
+			for _, data := range trustStoreResults {
+				series += len(data.certificateMetrics) +
+					len(data.certificates)*timeDerivedSeriesPerCertificate
+			}
+			summaryOnly = c.opts.MaxSeries > 0 && series > c.opts.MaxSeries
+			if summaryOnly {
+				log.Printf(
+					"WARNING: %d series exceeds the maximum of %d, dropping per-certificate metrics",
+					series,
+					c.opts.MaxSeries,
+				)
+			} else {
+				for _, data := range trustStoreResults {
+					metrics = append(metrics, data.certificateMetrics...)
 				}
 			}
+			if len(failures) > 0 {
+				success = false
+			}
 		}
 	}
 
 	scrapeDuration := time.Since(now)
-
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	if c.ctx.Err() != nil {
+		log.Printf("Scrape cancelled after %s", scrapeDuration)
+		return
+	}
 
 	// Exporter metrics
-	metrics = append(
-		metrics,
+	var exporterMetrics []prometheus.Metric
+	exporterMetrics = append(
+		exporterMetrics,
 		prometheus.MustNewConstMetric(
 			c.exporterLastScrapeTimestamp,
 			prometheus.GaugeValue,
 			float64(now.Unix()),
 		),
 	)
-	metrics = append(
-		metrics,
+	exporterMetrics = append(
+		exporterMetrics,
 		prometheus.MustNewConstMetric(
 			c.exporterScrapeDurationSeconds,
 			prometheus.GaugeValue,
 			scrapeDuration.Seconds(),
 		),
 	)
-	metrics = append(
-		metrics,
+	exporterMetrics = append(
+		exporterMetrics,
 		prometheus.MustNewConstMetric(
 			c.exporterScrapeInterval,
 			prometheus.GaugeValue,
-			c.scrapeInterval.Seconds(),
+			c.scrapeInterval().Seconds(),
+		),
+	)
+	exporterMetrics = append(
+		exporterMetrics,
+		prometheus.MustNewConstMetric(
+			c.exporterEstimatedSeries,
+			prometheus.GaugeValue,
+			float64(series),
 		),
 	)
+	maxSeriesExceeded := 0.0
+	if summaryOnly {
+		maxSeriesExceeded = 1
+	}
+	exporterMetrics = append(
+		exporterMetrics,
+		prometheus.MustNewConstMetric(
+			c.exporterMaxSeriesExceeded,
+			prometheus.GaugeValue,
+			maxSeriesExceeded,
+		),
+	)
+	// The trust store metrics and snapshot of a failed scrape are replaced by
+	// those of the last good result while the stale data policy allows,
+	// keeping the time of the scrape that produced them.
+	snapshot := newSnapshot(now, trustStoreResults, failures)
+	served := &scrapeResult{
+		metrics:     metrics,
+		trustStores: trustStoreResults,
+		snapshot:    snapshot,
+		summaryOnly: summaryOnly,
+		time:        now,
+	}
+	stale, restored := 0.0, 0.0
 	if success {
-		metrics = append(
-			metrics,
+		c.consecutiveFailures = 0
+	} else {
+		c.consecutiveFailures++
+		if c.servesStale(now) {
+			served = c.lastGood
+			stale = 1
+			if served.restored {
+				restored = 1
+			}
+		}
+	}
+	exporterMetrics = append(
+		exporterMetrics,
+		prometheus.MustNewConstMetric(
+			c.exporterResultRestored,
+			prometheus.GaugeValue,
+			restored,
+		),
+		prometheus.MustNewConstMetric(
+			c.exporterServingStale,
+			prometheus.GaugeValue,
+			stale,
+		),
+		prometheus.MustNewConstMetric(
+			c.exporterConsecutiveFailures,
+			prometheus.GaugeValue,
+			float64(c.consecutiveFailures),
+		),
+	)
+	exporterMetrics = append(exporterMetrics, identityMetrics...)
+	exporterMetrics = append(exporterMetrics, statusMetrics...)
+	usage := c.apiMetrics.resetCycle()
+	exporterMetrics = append(
+		exporterMetrics,
+		prometheus.MustNewConstMetric(
+			c.exporterScrapeAPIRequests,
+			prometheus.GaugeValue,
+			float64(usage.apiRequests),
+		),
+	)
+	exporterMetrics = append(
+		exporterMetrics,
+		prometheus.MustNewConstMetric(
+			c.exporterScrapeS3Requests,
+			prometheus.GaugeValue,
+			float64(usage.s3Requests),
+		),
+	)
+	exporterMetrics = append(
+		exporterMetrics,
+		prometheus.MustNewConstMetric(
+			c.exporterScrapeS3Bytes,
+			prometheus.GaugeValue,
+			float64(usage.s3Bytes),
+		),
+	)
+	exporterMetrics = append(
+		exporterMetrics,
+		prometheus.MustNewConstMetric(
+			c.exporterCacheTTL,
+			prometheus.GaugeValue,
+			c.opts.CacheTTL.Seconds(),
+		),
+	)
+	c.generation++
+	exporterMetrics = append(
+		exporterMetrics,
+		prometheus.MustNewConstMetric(
+			c.exporterGeneration,
+			prometheus.GaugeValue,
+			float64(c.generation),
+		),
+	)
+	if success {
+		exporterMetrics = append(
+			exporterMetrics,
 			prometheus.MustNewConstMetric(c.collectorSuccess, prometheus.GaugeValue, 1),
 		)
 	} else {
-		metrics = append(metrics, prometheus.MustNewConstMetric(c.collectorSuccess, prometheus.GaugeValue, 0))
+		exporterMetrics = append(
+			exporterMetrics,
+			prometheus.MustNewConstMetric(c.collectorSuccess, prometheus.GaugeValue, 0),
+		)
+	}
+
+	result := &scrapeResult{
+		generation:      c.generation,
+		success:         success,
+		metrics:         served.metrics,
+		exporterMetrics: exporterMetrics,
+		trustStores:     served.trustStores,
+		snapshot:        served.snapshot,
+		summaryOnly:     served.summaryOnly,
+		time:            served.time,
+	}
+	c.result.Store(result)
+	if success {
+		c.lastGood = result
+		if c.opts.LastGoodFile != "" {
+			c.saveLastGood(result)
+		}
+	}
+
+	// The event is published once the result is stored, so subscribers can
+	// read the result it announces.
+	severity := events.SeverityInfo
+	if !success {
+		severity = events.SeverityWarning
+	}
+	c.publish(events.Event{
+		Type:     events.ScrapeCompleted,
+		Severity: severity,
+		Data: map[string]any{
+			"success":          success,
+			"duration_seconds": scrapeDuration.Seconds(),
+		},
+	})
+
+	if c.opts.EvaluateRules {
+		c.evaluateRules(snapshot, success)
+	}
+
+	// Snapshots taken during warm-up are missing trust stores, so they are not
+	// recorded.
+	if success && c.recorder != nil && !c.warmingUp(now) {
+		c.recorder.Record(snapshot)
+	}
+}
+
+// Result returns a Snapshot of the trust stores in the current scrape result,
+// the result's generation and whether that scrape was successful. Every call
+// returning the same generation returns the same data, so readers such as JSON
+// APIs see a consistent view however many scrapes complete while they read.
+// The generation is zero before the first scrape has completed. The Snapshot is
+// shared between callers and must not be modified.
+func (c *Collector) Result() (snapshot Snapshot, generation uint64, success bool) {
+	r := c.result.Load()
+	if r == nil {
+		return Snapshot{}, 0, false
+	}
+	return r.snapshot, r.generation, r.success
+}
+
+// scrapeResult is the result of a scrape. It is not modified once stored, so
+// Collect streams it without holding a lock and a slow or stalled scraper
+// cannot hold up a scrape from storing the next result.
+type scrapeResult struct {
+	// generation numbers the results published by the collector, from 1.
+	generation      uint64
+	success         bool
+	snapshot        Snapshot
+	metrics         []prometheus.Metric
+	exporterMetrics []prometheus.Metric
+	trustStores     []*trustStoreData
+	// summaryOnly is set when MaxSeries was exceeded and per-certificate
+	// metrics are dropped.
+	summaryOnly bool
+	time        time.Time
+	// restored is set for the metrics restored from the last good file, which
+	// are not the result of a scrape of this collector.
+	restored bool
+}
+
+// servesStale reports whether the stale data policy allows the trust store
+// metrics of the last good result to be served at now in place of those of a
+// failed scrape. Without a StaleMaxAge, only restored metrics are served.
+func (c *Collector) servesStale(now time.Time) bool {
+	if c.lastGood == nil {
+		return false
+	}
+	if c.opts.StaleMaxAge == 0 {
+		return c.lastGood.restored
+	}
+	return now.Sub(c.lastGood.time) <= c.opts.StaleMaxAge
+}
+
+// trustStoreData holds the result of collecting a single trust store.
+type trustStoreData struct {
+	trustStore types.TrustStore
+	// tags are the configured tags of the trust store, keyed by tag key.
+	tags         map[string]string
+	certificates []*x509.Certificate
+	// certificateInfo holds the certificate info label values of each
+	// certificate, other than removed, keyed by fingerprint.
+	certificateInfo map[string][]string
+	// bundleChecksum is the SHA-256 checksum of the PEM bundle.
+	bundleChecksum  [sha256.Size]byte
+	revocationLists []revocationList
+	// metrics are the trust store level metrics and certificateMetrics the
+	// per-certificate metrics that are dropped when MaxSeries is exceeded.
+	metrics            []prometheus.Metric
+	certificateMetrics []prometheus.Metric
+	// collected is the time of the scrape that collected the trust store.
+	collected time.Time
+}
+
+// collectTrustStores collects the metrics of each trust store using up to
+// MaxConcurrency workers. It also returns the trust stores whose collection
+// failed.
+func (c *Collector) collectTrustStores(
+	ctx context.Context,
+	svc ELBAPI,
+	trustStores []types.TrustStore,
+	tags map[string]map[string]string,
+) ([]*trustStoreData, []FailedTrustStore) {
+	concurrency := max(c.opts.MaxConcurrency, 1)
+	sem := make(chan struct{}, concurrency)
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		results  []*trustStoreData
+		failures []FailedTrustStore
+	)
+	for _, ts := range trustStores {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			log.Printf("Error collecting metrics for trust store %s: %v", *ts.TrustStoreArn, ctx.Err())
+			failures = append(failures, newFailedTrustStore(ts, ctx.Err()))
+			continue
+		}
+
+		wg.Add(1)
+		go func(ts types.TrustStore) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			data := &trustStoreData{
+				trustStore:      ts,
+				tags:            tags[*ts.TrustStoreArn],
+				certificateInfo: make(map[string][]string),
+			}
+			err := c.collectTrustStoreMetrics(ctx, svc, data)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf(
+					"Error collecting metrics for trust store %s: %v",
+					*ts.TrustStoreArn,
+					err,
+				)
+				failures = append(failures, newFailedTrustStore(ts, err))
+				return
+			}
+			results = append(results, data)
+		}(ts)
+	}
+	wg.Wait()
+
+	return results, failures
+}
+
+// trackRemoved records the currently discovered trust stores and returns the
+// ARNs of previously seen trust stores that are still within their removal
+// retention period.
+func (c *Collector) trackRemoved(trustStores []types.TrustStore) []string {
+	current := make(map[string]struct{}, len(trustStores))
+	for _, ts := range trustStores {
+		arn := *ts.TrustStoreArn
+		current[arn] = struct{}{}
+		delete(c.removed, arn)
+
+		// Nothing has been seen before the first discovery, so stores found by
+		// it are not reported as added.
+		if _, ok := c.seen[arn]; !ok && c.seen != nil {
+			c.publish(events.Event{
+				Type:          events.TrustStoreAdded,
+				TrustStoreARN: arn,
+				Data:          map[string]any{"name": *ts.Name},
+			})
+		}
+	}
+
+	for arn := range c.seen {
+		if _, ok := current[arn]; !ok {
+			c.removed[arn] = c.opts.RemovedRetentionCycles
+			c.bundleMutex.Lock()
+			delete(c.bundles, arn)
+			c.bundleMutex.Unlock()
+			c.listenerMutex.Lock()
+			delete(c.listenersSeen, arn)
+			c.listenerMutex.Unlock()
+			c.publish(events.Event{
+				Type:          events.TrustStoreRemoved,
+				Severity:      events.SeverityWarning,
+				TrustStoreARN: arn,
+			})
+		}
+	}
+	c.seen = current
+
+	var arns []string
+	for arn, cycles := range c.removed {
+		if cycles <= 0 {
+			delete(c.removed, arn)
+			continue
+		}
+		c.removed[arn] = cycles - 1
+		arns = append(arns, arn)
+	}
+	return arns
+}
+
+// inShard reports whether a trust store is assigned to this collector's shard.
+func (c *Collector) inShard(arn string) bool {
+	return c.ring == nil || c.ring.Owner(arn) == c.opts.ShardIndex
+}
+
+// publish sends an event to the broker, marking it silenced if a maintenance
+// window covering its trust store is active.
+func (c *Collector) publish(e events.Event) {
+	e.Silenced = maintenance.Silenced(c.opts.MaintenanceWindows, e.TrustStoreARN, time.Now())
+	c.opts.Events.Publish(e)
+}
+
+// trustStoreStatusMetrics returns a series for every known trust store
+// status, and for status if it is not known, which is 1 for status and 0 for
+// the others, so a trust store that is not ACTIVE can be alerted on.
+func (c *Collector) trustStoreStatusMetrics(arn string, status types.TrustStoreStatus) []prometheus.Metric {
+	statuses := status.Values()
+	if status != "" && !slices.Contains(statuses, status) {
+		statuses = append(statuses, status)
+	}
+	metrics := make([]prometheus.Metric, 0, len(statuses))
+	for _, s := range statuses {
+		value := 0.0
+		if s == status {
+			value = 1
+		}
+		metrics = append(
+			metrics,
+			prometheus.MustNewConstMetric(c.trustStoreStatus, prometheus.GaugeValue, value, arn, string(s)),
+		)
 	}
+	return metrics
+}
 
-	c.metrics = metrics
+// matchesName reports whether a trust store name passes the include and exclude
+// name filters.
+func (c *Collector) matchesName(name string) bool {
+	if c.opts.IncludeNameRegex != nil && !c.opts.IncludeNameRegex.MatchString(name) {
+		return false
+	}
+	if c.opts.ExcludeNameRegex != nil && c.opts.ExcludeNameRegex.MatchString(name) {
+		return false
+	}
+	return true
 }
 
 func (c *Collector) collectTrustStoreMetrics(
 	ctx context.Context,
-	svc *elasticloadbalancingv2.Client,
-	ts types.TrustStore,
-	metrics *[]prometheus.Metric,
+	svc ELBAPI,
+	data *trustStoreData,
 ) error {
-	*metrics = append(
-		*metrics,
+	ts := data.trustStore
+	infoValues := []string{*ts.TrustStoreArn, *ts.Name, arnRegion(*ts.TrustStoreArn)}
+	for _, key := range c.opts.TrustStoreTags {
+		infoValues = append(infoValues, data.tags[key])
+	}
+	data.metrics = append(
+		data.metrics,
 		prometheus.MustNewConstMetric(
 			c.trustStoreInfo,
 			prometheus.GaugeValue,
 			1,
-			*ts.TrustStoreArn,
-			*ts.Name,
-			c.region,
+			infoValues...,
 		),
 	)
-	*metrics = append(
-		*metrics,
+	data.metrics = append(
+		data.metrics,
 		prometheus.MustNewConstMetric(
 			c.trustStoreCertificates,
 			prometheus.GaugeValue,
@@ -267,8 +1758,8 @@ func (c *Collector) collectTrustStoreMetrics(
 			*ts.TrustStoreArn,
 		),
 	)
-	*metrics = append(
-		*metrics,
+	data.metrics = append(
+		data.metrics,
 		prometheus.MustNewConstMetric(
 			c.trustStoreRevokedEntries,
 			prometheus.GaugeValue,
@@ -287,87 +1778,355 @@ func (c *Collector) collectTrustStoreMetrics(
 		return err
 	}
 
-	httpClient := http.Client{
-		Timeout: 3 * time.Second,
-	}
-	resp, err := httpClient.Get(*bundle.Location)
+	downloadStart := time.Now()
+	parsed, cached, err := c.loadBundle(ctx, *ts.TrustStoreArn, *bundle.Location)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("failed to close response body: %v", err)
-		}
-	}()
+	data.bundleChecksum = parsed.checksum
+	data.metrics = append(
+		data.metrics,
+		prometheus.MustNewConstMetric(
+			c.bundleDownloadDuration,
+			prometheus.GaugeValue,
+			time.Since(downloadStart).Seconds(),
+			*ts.TrustStoreArn,
+		),
+	)
+	data.metrics = append(
+		data.metrics,
+		prometheus.MustNewConstMetric(
+			c.bundleBytes,
+			prometheus.GaugeValue,
+			float64(parsed.size),
+			*ts.TrustStoreArn,
+		),
+	)
+	bundleCached := 0.0
+	if cached {
+		bundleCached = 1
+	}
+	data.metrics = append(
+		data.metrics,
+		prometheus.MustNewConstMetric(
+			c.bundleCached,
+			prometheus.GaugeValue,
+			bundleCached,
+			*ts.TrustStoreArn,
+		),
+	)
 
-	pemData, err := io.ReadAll(resp.Body)
+	data.revocationLists, err = c.revocationLists(ctx, svc, ts)
 	if err != nil {
 		return err
 	}
 
-	for len(pemData) > 0 {
-		var block *pem.Block
-		block, pemData = pem.Decode(pemData)
-		if block == nil {
-			break
+	if c.opts.CollectAssociations || c.opts.CollectListeners || c.opts.CollectTargetHealth {
+		if err := c.collectListenerMetrics(ctx, svc, data); err != nil {
+			return err
 		}
+	}
 
-		if block.Type != "CERTIFICATE" {
+	// Skipped certificates are only counted when the bundle is parsed, not
+	// again on every scrape that reuses it.
+	if parsed.invalid > 0 && !cached {
+		c.certificateErrors.WithLabelValues(*ts.TrustStoreArn, certificateErrorParse).Add(float64(parsed.invalid))
+	}
+	// A certificate repeated in the bundle would produce duplicate series, so
+	// only the first copy is exported.
+	seen := make(map[string]struct{}, len(parsed.certificates))
+	duplicates := 0
+	for _, cert := range parsed.certificates {
+		if _, ok := seen[fingerprint(cert)]; ok {
+			duplicates++
 			continue
 		}
+		seen[fingerprint(cert)] = struct{}{}
 
-		cert, err := x509.ParseCertificate(block.Bytes)
+		keyType, keyLength, err := publicKeyInfo(cert)
 		if err != nil {
-			log.Printf("Error parsing certificate: %v", err)
+			if !cached {
+				log.Printf(
+					"Skipping certificate %s in trust store %s: %v",
+					cert.Subject,
+					*ts.TrustStoreArn,
+					err,
+				)
+				c.certificateErrors.WithLabelValues(*ts.TrustStoreArn, certificateErrorUnsupportedKey).Inc()
+			}
 			continue
 		}
 
-		keyLength := 0
-		switch pub := cert.PublicKey.(type) {
-		case *rsa.PublicKey:
-			keyLength = pub.N.BitLen()
-		case *ecdsa.PublicKey:
-			keyLength = pub.Curve.Params().BitSize
-		default:
-			return errors.New("unknown public key type")
+		if !c.opts.DisableCertificateInfo {
+			values := certificateInfoLabelValues(c.certificateInfoLabels, *ts.TrustStoreArn, cert, keyType, keyLength)
+			data.certificateInfo[fingerprint(cert)] = values
+			data.certificateMetrics = append(
+				data.certificateMetrics,
+				prometheus.MustNewConstMetric(
+					c.certificateInfo,
+					prometheus.GaugeValue,
+					1,
+					append(slices.Clip(values), "false")...,
+				),
+			)
 		}
-
-		*metrics = append(
-			*metrics,
+		data.certificateMetrics = append(
+			data.certificateMetrics,
 			prometheus.MustNewConstMetric(
-				c.certificateInfo,
+				c.certificateNotBefore,
 				prometheus.GaugeValue,
-				1,
+				float64(cert.NotBefore.Unix()),
 				*ts.TrustStoreArn,
 				cert.SerialNumber.String(),
-				cert.Issuer.String(),
 				cert.Subject.String(),
-				cert.SignatureAlgorithm.String(),
-				strconv.Itoa(keyLength),
 			),
 		)
-		*metrics = append(
-			*metrics,
+		data.certificateMetrics = append(
+			data.certificateMetrics,
 			prometheus.MustNewConstMetric(
-				c.certificateNotBefore,
+				c.certificateExpiry,
 				prometheus.GaugeValue,
-				float64(cert.NotBefore.Unix()),
+				float64(cert.NotAfter.Unix()),
 				*ts.TrustStoreArn,
 				cert.SerialNumber.String(),
 				cert.Subject.String(),
 			),
 		)
-		*metrics = append(
-			*metrics,
+		data.certificates = append(data.certificates, cert)
+
+		isCA, critical := 0.0, 0.0
+		if cert.BasicConstraintsValid && cert.IsCA {
+			isCA = 1
+		}
+		if basicConstraintsCritical(cert) {
+			critical = 1
+		}
+		data.certificateMetrics = append(
+			data.certificateMetrics,
 			prometheus.MustNewConstMetric(
-				c.certificateExpiry,
+				c.certificateIsCA,
 				prometheus.GaugeValue,
-				float64(cert.NotAfter.Unix()),
+				isCA,
+				*ts.TrustStoreArn,
+				cert.SerialNumber.String(),
+				cert.Subject.String(),
+			),
+			prometheus.MustNewConstMetric(
+				c.certificateConstraintsCritical,
+				prometheus.GaugeValue,
+				critical,
+				*ts.TrustStoreArn,
+				cert.SerialNumber.String(),
+				cert.Subject.String(),
+			),
+		)
+		// The path length is only reported when the CA certificate is
+		// constrained. MaxPathLen is -1, or 0 without MaxPathLenZero, when it
+		// is not.
+		if isCA == 1 && (cert.MaxPathLen > 0 || cert.MaxPathLenZero) {
+			data.certificateMetrics = append(
+				data.certificateMetrics,
+				prometheus.MustNewConstMetric(
+					c.certificatePathLength,
+					prometheus.GaugeValue,
+					float64(cert.MaxPathLen),
+					*ts.TrustStoreArn,
+					cert.SerialNumber.String(),
+					cert.Subject.String(),
+				),
+			)
+		}
+
+		for _, reason := range weaknesses(cert) {
+			data.certificateMetrics = append(
+				data.certificateMetrics,
+				prometheus.MustNewConstMetric(
+					c.certificateWeak,
+					prometheus.GaugeValue,
+					1,
+					*ts.TrustStoreArn,
+					cert.SerialNumber.String(),
+					cert.Subject.String(),
+					reason,
+				),
+			)
+		}
+
+		hasRevocationList := 0.0
+		for _, rl := range data.revocationLists {
+			if rl.list != nil && bytes.Equal(rl.list.RawIssuer, cert.RawSubject) {
+				hasRevocationList = 1
+				break
+			}
+		}
+		data.certificateMetrics = append(
+			data.certificateMetrics,
+			prometheus.MustNewConstMetric(
+				c.certificateHasRevocationList,
+				prometheus.GaugeValue,
+				hasRevocationList,
 				*ts.TrustStoreArn,
 				cert.SerialNumber.String(),
 				cert.Subject.String(),
 			),
 		)
 	}
+	for i, complete := range chainsComplete(data.certificates) {
+		value := 0.0
+		if complete {
+			value = 1
+		}
+		data.certificateMetrics = append(
+			data.certificateMetrics,
+			prometheus.MustNewConstMetric(
+				c.certificateChainComplete,
+				prometheus.GaugeValue,
+				value,
+				*ts.TrustStoreArn,
+				data.certificates[i].SerialNumber.String(),
+				data.certificates[i].Subject.String(),
+			),
+		)
+	}
+	if duplicates > 0 {
+		log.Printf("Trust store %s has %d duplicate certificates", *ts.TrustStoreArn, duplicates)
+	}
+	data.metrics = append(
+		data.metrics,
+		prometheus.MustNewConstMetric(
+			c.duplicateCertificates,
+			prometheus.GaugeValue,
+			float64(duplicates),
+			*ts.TrustStoreArn,
+		),
+	)
 	return nil
 }
+
+// crossStoreDuplicateMetrics returns, for each trust store, the number of its
+// certificates that are also in another of the trust stores.
+func (c *Collector) crossStoreDuplicateMetrics(trustStores []*trustStoreData) []prometheus.Metric {
+	stores := make(map[string]int)
+	for _, data := range trustStores {
+		for _, cert := range data.certificates {
+			stores[fingerprint(cert)]++
+		}
+	}
+
+	metrics := make([]prometheus.Metric, 0, len(trustStores))
+	for _, data := range trustStores {
+		shared := 0
+		for _, cert := range data.certificates {
+			if stores[fingerprint(cert)] > 1 {
+				shared++
+			}
+		}
+		metrics = append(
+			metrics,
+			prometheus.MustNewConstMetric(
+				c.crossStoreDuplicates,
+				prometheus.GaugeValue,
+				float64(shared),
+				*data.trustStore.TrustStoreArn,
+			),
+		)
+	}
+	return metrics
+}
+
+// revocationList is a revocation list uploaded to a trust store.
+type revocationList struct {
+	id             int64
+	revocationType string
+	revokedEntries int64
+	// list is nil if the revocation list could not be parsed.
+	list *x509.RevocationList
+}
+
+// revocationLists downloads and parses every revocation list in the trust
+// store.
+func (c *Collector) revocationLists(
+	ctx context.Context,
+	svc ELBAPI,
+	ts types.TrustStore,
+) ([]revocationList, error) {
+	contents, err := c.downloadRevocationLists(ctx, svc, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	lists := make([]revocationList, 0, len(contents))
+	for _, content := range contents {
+		data := content.Data
+		// Revocation lists may be uploaded either PEM or DER encoded.
+		if block, _ := pem.Decode(data); block != nil {
+			data = block.Bytes
+		}
+
+		rl := revocationList{
+			id:             content.ID,
+			revocationType: content.Type,
+			revokedEntries: content.RevokedEntries,
+		}
+		start := time.Now()
+		list, err := x509.ParseRevocationList(data)
+		c.apiMetrics.recordParse("revocation_list", start)
+		if err != nil {
+			log.Printf("Error parsing revocation list %d: %v", content.ID, err)
+		} else {
+			rl.list = list
+		}
+		lists = append(lists, rl)
+	}
+
+	return lists, nil
+}
+
+// downloadRevocationLists downloads every revocation list in the trust store,
+// as uploaded.
+func (c *Collector) downloadRevocationLists(
+	ctx context.Context,
+	svc ELBAPI,
+	ts types.TrustStore,
+) ([]RevocationListContent, error) {
+	var contents []RevocationListContent
+
+	paginator := elasticloadbalancingv2.NewDescribeTrustStoreRevocationsPaginator(
+		svc,
+		&elasticloadbalancingv2.DescribeTrustStoreRevocationsInput{
+			TrustStoreArn: ts.TrustStoreArn,
+		},
+	)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rev := range page.TrustStoreRevocations {
+			content, err := svc.GetTrustStoreRevocationContent(
+				ctx,
+				&elasticloadbalancingv2.GetTrustStoreRevocationContentInput{
+					TrustStoreArn: ts.TrustStoreArn,
+					RevocationId:  rev.RevocationId,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			data, err := c.fetch(ctx, *content.Location)
+			if err != nil {
+				return nil, err
+			}
+			contents = append(contents, RevocationListContent{
+				ID:             aws.ToInt64(rev.RevocationId),
+				Type:           string(rev.RevocationType),
+				RevokedEntries: aws.ToInt64(rev.NumberOfRevokedEntries),
+				Data:           data,
+			})
+		}
+	}
+
+	return contents, nil
+}
@@ -0,0 +1,191 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+)
+
+// CheckTrustStoreARNs returns an error if a trust store ARN is invalid, or if
+// the ARNs are in more than one partition, such as aws and aws-us-gov, as a
+// single set of credentials can only access one partition.
+func CheckTrustStoreARNs(arns []string) error {
+	var partition, first string
+	for _, s := range arns {
+		parsed, err := arn.Parse(s)
+		if err != nil {
+			return fmt.Errorf("invalid trust store ARN %q: %w", s, err)
+		}
+		if parsed.Region == "" {
+			return fmt.Errorf("trust store ARN %q has no region", s)
+		}
+		if partition == "" {
+			partition, first = parsed.Partition, s
+		} else if parsed.Partition != partition {
+			return fmt.Errorf(
+				"trust store ARNs %q and %q are in the %s and %s partitions, which need separate credentials, so monitor them with separate exporters",
+				first,
+				s,
+				partition,
+				parsed.Partition,
+			)
+		}
+	}
+	return nil
+}
+
+// arnRegion returns the region of an ARN, or "" if it is not a valid ARN.
+func arnRegion(s string) string {
+	parsed, err := arn.Parse(s)
+	if err != nil {
+		return ""
+	}
+	return parsed.Region
+}
+
+// chunkByRegion splits ARNs into chunks of at most size ARNs of a single
+// region each, as a request can only concern resources of the region it is
+// sent to. Regions are in the order of their first ARN.
+func chunkByRegion(arns []string, size int) [][]string {
+	var (
+		regions  []string
+		byRegion = make(map[string][]string)
+	)
+	for _, s := range arns {
+		region := arnRegion(s)
+		if _, ok := byRegion[region]; !ok {
+			regions = append(regions, region)
+		}
+		byRegion[region] = append(byRegion[region], s)
+	}
+	var chunks [][]string
+	for _, region := range regions {
+		chunks = slices.AppendSeq(chunks, slices.Chunk(byRegion[region], size))
+	}
+	return chunks
+}
+
+// regionalClient is an ELBAPI that sends each request to a client for the
+// region of the ARN it concerns, so trust stores configured by ARN are
+// collected from their own region, whatever the region of the AWS
+// configuration. The SDK resolves the endpoint of each region in its
+// partition. Requests that concern no ARN are sent to the default client.
+type regionalClient struct {
+	defaultClient ELBAPI
+	region        string
+	newClient     func(region string) ELBAPI
+
+	mutex   sync.Mutex
+	clients map[string]ELBAPI
+}
+
+// client returns the client for the region of an ARN, creating it on first
+// use.
+func (r *regionalClient) client(s string) ELBAPI {
+	region := arnRegion(s)
+	if region == "" || region == r.region {
+		return r.defaultClient
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	client, ok := r.clients[region]
+	if !ok {
+		client = r.newClient(region)
+		r.clients[region] = client
+	}
+	return client
+}
+
+// firstARN returns the first of the ARNs, or "" if there are none.
+func firstARN(arns []string) string {
+	if len(arns) == 0 {
+		return ""
+	}
+	return arns[0]
+}
+
+func (r *regionalClient) DescribeTrustStores(
+	ctx context.Context,
+	params *elasticloadbalancingv2.DescribeTrustStoresInput,
+	optFns ...func(*elasticloadbalancingv2.Options),
+) (*elasticloadbalancingv2.DescribeTrustStoresOutput, error) {
+	return r.client(firstARN(params.TrustStoreArns)).DescribeTrustStores(ctx, params, optFns...)
+}
+
+func (r *regionalClient) DescribeTrustStoreRevocations(
+	ctx context.Context,
+	params *elasticloadbalancingv2.DescribeTrustStoreRevocationsInput,
+	optFns ...func(*elasticloadbalancingv2.Options),
+) (*elasticloadbalancingv2.DescribeTrustStoreRevocationsOutput, error) {
+	return r.client(aws.ToString(params.TrustStoreArn)).DescribeTrustStoreRevocations(ctx, params, optFns...)
+}
+
+func (r *regionalClient) DescribeTrustStoreAssociations(
+	ctx context.Context,
+	params *elasticloadbalancingv2.DescribeTrustStoreAssociationsInput,
+	optFns ...func(*elasticloadbalancingv2.Options),
+) (*elasticloadbalancingv2.DescribeTrustStoreAssociationsOutput, error) {
+	return r.client(aws.ToString(params.TrustStoreArn)).DescribeTrustStoreAssociations(ctx, params, optFns...)
+}
+
+func (r *regionalClient) DescribeListeners(
+	ctx context.Context,
+	params *elasticloadbalancingv2.DescribeListenersInput,
+	optFns ...func(*elasticloadbalancingv2.Options),
+) (*elasticloadbalancingv2.DescribeListenersOutput, error) {
+	s := firstARN(params.ListenerArns)
+	if params.LoadBalancerArn != nil {
+		s = aws.ToString(params.LoadBalancerArn)
+	}
+	return r.client(s).DescribeListeners(ctx, params, optFns...)
+}
+
+func (r *regionalClient) DescribeTargetGroups(
+	ctx context.Context,
+	params *elasticloadbalancingv2.DescribeTargetGroupsInput,
+	optFns ...func(*elasticloadbalancingv2.Options),
+) (*elasticloadbalancingv2.DescribeTargetGroupsOutput, error) {
+	s := firstARN(params.TargetGroupArns)
+	if params.LoadBalancerArn != nil {
+		s = aws.ToString(params.LoadBalancerArn)
+	}
+	return r.client(s).DescribeTargetGroups(ctx, params, optFns...)
+}
+
+func (r *regionalClient) DescribeTargetHealth(
+	ctx context.Context,
+	params *elasticloadbalancingv2.DescribeTargetHealthInput,
+	optFns ...func(*elasticloadbalancingv2.Options),
+) (*elasticloadbalancingv2.DescribeTargetHealthOutput, error) {
+	return r.client(aws.ToString(params.TargetGroupArn)).DescribeTargetHealth(ctx, params, optFns...)
+}
+
+func (r *regionalClient) GetTrustStoreCaCertificatesBundle(
+	ctx context.Context,
+	params *elasticloadbalancingv2.GetTrustStoreCaCertificatesBundleInput,
+	optFns ...func(*elasticloadbalancingv2.Options),
+) (*elasticloadbalancingv2.GetTrustStoreCaCertificatesBundleOutput, error) {
+	return r.client(aws.ToString(params.TrustStoreArn)).GetTrustStoreCaCertificatesBundle(ctx, params, optFns...)
+}
+
+func (r *regionalClient) GetTrustStoreRevocationContent(
+	ctx context.Context,
+	params *elasticloadbalancingv2.GetTrustStoreRevocationContentInput,
+	optFns ...func(*elasticloadbalancingv2.Options),
+) (*elasticloadbalancingv2.GetTrustStoreRevocationContentOutput, error) {
+	return r.client(aws.ToString(params.TrustStoreArn)).GetTrustStoreRevocationContent(ctx, params, optFns...)
+}
+
+func (r *regionalClient) DescribeTags(
+	ctx context.Context,
+	params *elasticloadbalancingv2.DescribeTagsInput,
+	optFns ...func(*elasticloadbalancingv2.Options),
+) (*elasticloadbalancingv2.DescribeTagsOutput, error) {
+	return r.client(firstARN(params.ResourceArns)).DescribeTags(ctx, params, optFns...)
+}
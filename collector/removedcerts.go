@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"slices"
+
+	"github.com/panubo/elb-trust-store-exporter/events"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// removedCertificate is a certificate that disappeared from its trust store's
+// bundle and is still reported by the certificate info metric.
+type removedCertificate struct {
+	// values are the certificate info label values, other than removed, from
+	// the last scrape that found the certificate.
+	values []string
+	// cycles is the number of further scrapes that report the certificate.
+	cycles int
+}
+
+// trackRemovedCertificates records the certificates of the collected trust
+// stores and adds a certificate info metric labeled removed="true" to each
+// trust store's certificate metrics for the certificates that disappeared from
+// its bundle within the retention period, so alerts can fire on a removed CA
+// instead of the series silently going away. Trust stores that failed to be
+// collected keep their state until the next successful collection.
+func (c *Collector) trackRemovedCertificates(results []*trustStoreData) {
+	if c.opts.DisableCertificateInfo {
+		return
+	}
+
+	for _, data := range results {
+		arn := *data.trustStore.TrustStoreArn
+		removed := c.certificatesRemoved[arn]
+		if removed == nil {
+			removed = make(map[string]*removedCertificate)
+			c.certificatesRemoved[arn] = removed
+		}
+
+		// Nothing has been seen before the first collection of a trust store,
+		// so no certificate is reported as removed by it.
+		for fp, values := range c.certificatesSeen[arn] {
+			if _, ok := data.certificateInfo[fp]; ok {
+				continue
+			}
+			removed[fp] = &removedCertificate{values: values, cycles: c.opts.RemovedCertificateRetentionCycles}
+			c.publish(events.Event{
+				Type:          events.CertificateRemoved,
+				Severity:      events.SeverityWarning,
+				TrustStoreARN: arn,
+				Data:          map[string]any{"fingerprint_sha256": fp},
+			})
+		}
+		c.certificatesSeen[arn] = data.certificateInfo
+
+		for fp, cert := range removed {
+			if _, ok := data.certificateInfo[fp]; ok || cert.cycles <= 0 {
+				delete(removed, fp)
+				continue
+			}
+			cert.cycles--
+			data.certificateMetrics = append(
+				data.certificateMetrics,
+				prometheus.MustNewConstMetric(
+					c.certificateInfo,
+					prometheus.GaugeValue,
+					1,
+					append(slices.Clip(cert.values), "true")...,
+				),
+			)
+		}
+	}
+
+	// Forget trust stores that are no longer discovered, which are reported
+	// by the trust store removed metric instead.
+	for arn := range c.certificatesSeen {
+		if _, ok := c.seen[arn]; !ok {
+			delete(c.certificatesSeen, arn)
+			delete(c.certificatesRemoved, arn)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/events"
+)
+
+// Names of the built-in rules.
+const (
+	ruleCertificateExpiring    = "certificate_expiring"
+	ruleCertificateExpired     = "certificate_expired"
+	ruleTrustStoreCollectError = "trust_store_collection_failed"
+	ruleScrapeFailed           = "scrape_failed"
+)
+
+// alert is a built-in rule firing for a trust store, or for the exporter if
+// the trust store ARN is empty.
+type alert struct {
+	rule          string
+	trustStoreARN string
+	severity      string
+	summary       string
+}
+
+func (a alert) key() string {
+	return a.rule + "\x00" + a.trustStoreARN
+}
+
+// alerts evaluates the built-in rules against a scrape result and returns the
+// alerts that fire. Certificate rules use the expiry severity thresholds.
+func (c *Collector) alerts(s Snapshot, success bool) []alert {
+	var alerts []alert
+	for _, ts := range s.TrustStores {
+		var expiring, expired int
+		var first time.Time
+		severity := events.SeverityWarning
+		for _, cert := range ts.Certificates {
+			remaining := cert.NotAfter.Sub(s.Time)
+			switch {
+			case remaining <= 0:
+				expired++
+			case remaining <= c.opts.ExpiryWarningThreshold:
+				expiring++
+				if first.IsZero() || cert.NotAfter.Before(first) {
+					first = cert.NotAfter
+				}
+				if remaining <= c.opts.ExpiryCriticalThreshold {
+					severity = events.SeverityCritical
+				}
+			}
+		}
+		if expiring > 0 {
+			alerts = append(alerts, alert{
+				rule:          ruleCertificateExpiring,
+				trustStoreARN: ts.ARN,
+				severity:      severity,
+				summary: fmt.Sprintf(
+					"%d certificates in trust store %s expire soon, the first on %s",
+					expiring, ts.Name, first.UTC().Format(time.RFC3339),
+				),
+			})
+		}
+		if expired > 0 {
+			alerts = append(alerts, alert{
+				rule:          ruleCertificateExpired,
+				trustStoreARN: ts.ARN,
+				severity:      events.SeverityCritical,
+				summary:       fmt.Sprintf("%d certificates in trust store %s have expired", expired, ts.Name),
+			})
+		}
+	}
+	for _, ts := range s.FailedTrustStores {
+		alerts = append(alerts, alert{
+			rule:          ruleTrustStoreCollectError,
+			trustStoreARN: ts.ARN,
+			severity:      events.SeverityWarning,
+			summary:       fmt.Sprintf("Failed to collect trust store %s: %s", ts.Name, ts.Error),
+		})
+	}
+	if !success {
+		alerts = append(alerts, alert{
+			rule:     ruleScrapeFailed,
+			severity: events.SeverityWarning,
+			summary:  "The last scrape of the AWS API failed",
+		})
+	}
+	return alerts
+}
+
+// evaluateRules evaluates the built-in rules against a scrape result and
+// publishes a rule_firing event for each alert that starts firing or changes
+// severity, and a rule_resolved event for each alert that stops. The alerts of
+// a trust store that failed to be collected are kept until it is collected
+// again or is no longer discovered.
+func (c *Collector) evaluateRules(s Snapshot, success bool) {
+	failed := make(map[string]struct{}, len(s.FailedTrustStores))
+	for _, ts := range s.FailedTrustStores {
+		failed[ts.ARN] = struct{}{}
+	}
+
+	current := make(map[string]alert)
+	for _, a := range c.alerts(s, success) {
+		current[a.key()] = a
+		if previous, ok := c.firing[a.key()]; ok && previous.severity == a.severity {
+			continue
+		}
+		c.publish(events.Event{
+			Type:          events.RuleFiring,
+			Severity:      a.severity,
+			TrustStoreARN: a.trustStoreARN,
+			Data:          map[string]any{"rule": a.rule, "summary": a.summary},
+		})
+	}
+
+	for key, a := range c.firing {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		_, discovered := c.seen[a.trustStoreARN]
+		if _, ok := failed[a.trustStoreARN]; ok && discovered && a.rule != ruleTrustStoreCollectError {
+			current[key] = a
+			continue
+		}
+		c.publish(events.Event{
+			Type:          events.RuleResolved,
+			Severity:      events.SeverityInfo,
+			TrustStoreARN: a.trustStoreARN,
+			Data:          map[string]any{"rule": a.rule},
+		})
+	}
+	c.firing = current
+}
@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+)
+
+// Snapshot is the trust stores and certificates found by a successful scrape.
+type Snapshot struct {
+	Time        time.Time            `json:"time"`
+	TrustStores []TrustStoreSnapshot `json:"trust_stores"`
+	// FailedTrustStores are the trust stores that could not be collected by
+	// the scrape, which are not in TrustStores.
+	FailedTrustStores []FailedTrustStore `json:"failed_trust_stores,omitempty"`
+}
+
+// FailedTrustStore is a trust store that could not be collected by a scrape.
+type FailedTrustStore struct {
+	ARN   string `json:"arn"`
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+func newFailedTrustStore(ts types.TrustStore, err error) FailedTrustStore {
+	return FailedTrustStore{ARN: *ts.TrustStoreArn, Name: aws.ToString(ts.Name), Error: err.Error()}
+}
+
+// TrustStoreSnapshot is a trust store in a Snapshot.
+type TrustStoreSnapshot struct {
+	ARN  string `json:"arn"`
+	Name string `json:"name"`
+	// BundleSHA256 is the hex encoded SHA-256 checksum of the trust store's
+	// PEM bundle as downloaded from AWS.
+	BundleSHA256    string                   `json:"bundle_sha256,omitempty"`
+	Certificates    []CertificateSnapshot    `json:"certificates"`
+	RevocationLists []RevocationListSnapshot `json:"revocation_lists,omitempty"`
+}
+
+// CertificateSnapshot is a CA certificate in a TrustStoreSnapshot.
+type CertificateSnapshot struct {
+	SerialNumber      string    `json:"serial_number"`
+	FingerprintSHA256 string    `json:"fingerprint_sha256"`
+	Subject           string    `json:"subject"`
+	Issuer            string    `json:"issuer"`
+	NotBefore         time.Time `json:"not_before"`
+	NotAfter          time.Time `json:"not_after"`
+}
+
+// RevocationListSnapshot is a revocation list in a TrustStoreSnapshot. The
+// issuer and update times are empty if the list could not be parsed.
+type RevocationListSnapshot struct {
+	ID             int64     `json:"id"`
+	Type           string    `json:"type"`
+	Issuer         string    `json:"issuer,omitempty"`
+	RevokedEntries int64     `json:"revoked_entries"`
+	ThisUpdate     time.Time `json:"this_update,omitzero"`
+	NextUpdate     time.Time `json:"next_update,omitzero"`
+}
+
+// SnapshotRecorder receives a Snapshot after every successful scrape. Record
+// is called once the scrape's result is published, but before the next scrape
+// can start, so it should return quickly.
+type SnapshotRecorder interface {
+	Record(Snapshot)
+}
+
+// WithSnapshotRecorder sets a recorder that is given a Snapshot of the trust
+// stores after every successful scrape.
+func WithSnapshotRecorder(recorder SnapshotRecorder) Option {
+	return func(c *Collector) {
+		c.recorder = recorder
+	}
+}
+
+// newSnapshot returns a Snapshot of the collected and failed trust stores, in
+// ARN order.
+func newSnapshot(at time.Time, trustStores []*trustStoreData, failures []FailedTrustStore) Snapshot {
+	s := Snapshot{
+		Time:              at,
+		TrustStores:       make([]TrustStoreSnapshot, 0, len(trustStores)),
+		FailedTrustStores: slices.Clone(failures),
+	}
+	for _, data := range trustStores {
+		ts := TrustStoreSnapshot{
+			ARN:          *data.trustStore.TrustStoreArn,
+			Name:         *data.trustStore.Name,
+			BundleSHA256: hex.EncodeToString(data.bundleChecksum[:]),
+			Certificates: make([]CertificateSnapshot, 0, len(data.certificates)),
+		}
+		for _, cert := range data.certificates {
+			ts.Certificates = append(ts.Certificates, CertificateSnapshot{
+				SerialNumber:      cert.SerialNumber.String(),
+				FingerprintSHA256: fingerprint(cert),
+				Subject:           cert.Subject.String(),
+				Issuer:            cert.Issuer.String(),
+				NotBefore:         cert.NotBefore,
+				NotAfter:          cert.NotAfter,
+			})
+		}
+		for _, rl := range data.revocationLists {
+			rs := RevocationListSnapshot{
+				ID:             rl.id,
+				Type:           rl.revocationType,
+				RevokedEntries: rl.revokedEntries,
+			}
+			if rl.list != nil {
+				rs.Issuer = rl.list.Issuer.String()
+				rs.ThisUpdate = rl.list.ThisUpdate
+				rs.NextUpdate = rl.list.NextUpdate
+			}
+			ts.RevocationLists = append(ts.RevocationLists, rs)
+		}
+		s.TrustStores = append(s.TrustStores, ts)
+	}
+	slices.SortFunc(s.TrustStores, func(a, b TrustStoreSnapshot) int {
+		return strings.Compare(a.ARN, b.ARN)
+	})
+	slices.SortFunc(s.FailedTrustStores, func(a, b FailedTrustStore) int {
+		return strings.Compare(a.ARN, b.ARN)
+	})
+	return s
+}
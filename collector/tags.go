@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+)
+
+// maxDescribeTagsARNs is the maximum number of resources accepted by a single
+// DescribeTags request.
+const maxDescribeTagsARNs = 20
+
+// maxTagValueLength is the maximum length of a tag value used as a label value.
+// Longer values are truncated.
+const maxTagValueLength = 128
+
+// TagLabelName returns the elb_trust_store_info label name for an AWS tag key:
+// the key prefixed with "tag_", lower-cased, and with every character that is
+// not valid in a Prometheus label name replaced with an underscore.
+func TagLabelName(key string) string {
+	var b strings.Builder
+	b.WriteString("tag_")
+	for _, r := range strings.ToLower(key) {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// CheckTrustStoreTags returns an error if two AWS tag keys map to the same
+// label name.
+func CheckTrustStoreTags(keys []string) error {
+	labels := make(map[string]string, len(keys))
+	for _, key := range keys {
+		label := TagLabelName(key)
+		if other, ok := labels[label]; ok {
+			return fmt.Errorf("trust store tags %q and %q both map to label %s", other, key, label)
+		}
+		labels[label] = key
+	}
+	return nil
+}
+
+// tagLabelValue sanitises a tag value for use as a label value.
+func tagLabelValue(value string) string {
+	value = strings.ToValidUTF8(strings.TrimSpace(value), "�")
+	if utf8.RuneCountInString(value) > maxTagValueLength {
+		value = string([]rune(value)[:maxTagValueLength])
+	}
+	return value
+}
+
+// describeTags returns the configured tags of each trust store, keyed by ARN
+// and then by tag key. Tags that are not set are omitted.
+func (c *Collector) describeTags(
+	ctx context.Context,
+	svc ELBAPI,
+	trustStores []types.TrustStore,
+) (map[string]map[string]string, error) {
+	tags := make(map[string]map[string]string, len(trustStores))
+	if len(c.opts.TrustStoreTags) == 0 || len(trustStores) == 0 {
+		return tags, nil
+	}
+
+	arns := make([]string, 0, len(trustStores))
+	for _, ts := range trustStores {
+		arns = append(arns, *ts.TrustStoreArn)
+	}
+	for _, batch := range chunkByRegion(arns, maxDescribeTagsARNs) {
+		out, err := svc.DescribeTags(ctx, &elasticloadbalancingv2.DescribeTagsInput{ResourceArns: batch})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe tags: %w", err)
+		}
+		for _, desc := range out.TagDescriptions {
+			values := make(map[string]string)
+			for _, tag := range desc.Tags {
+				if tag.Key != nil && tag.Value != nil && slices.Contains(c.opts.TrustStoreTags, *tag.Key) {
+					values[*tag.Key] = tagLabelValue(*tag.Value)
+				}
+			}
+			tags[*desc.ResourceArn] = values
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+)
+
+// warmupFraction returns the fraction of the monitored trust stores that are
+// onboarded at now. During the warm-up period the fraction grows by one step
+// every WarmupDuration/WarmupSteps, starting with one step, and it is 1 once
+// the period is over or when there is no warm-up.
+func (c *Collector) warmupFraction(now time.Time) float64 {
+	if c.opts.WarmupDuration <= 0 || c.opts.WarmupSteps <= 1 {
+		return 1
+	}
+	start := c.opts.WarmupStart
+	if start.IsZero() {
+		start = c.created
+	}
+	step := c.opts.WarmupDuration / time.Duration(c.opts.WarmupSteps)
+	completed := int(now.Sub(start) / step)
+	if completed+1 >= c.opts.WarmupSteps {
+		return 1
+	}
+	return float64(completed+1) / float64(c.opts.WarmupSteps)
+}
+
+// warmingUp reports whether trust stores are still being onboarded at now.
+func (c *Collector) warmingUp(now time.Time) bool {
+	return c.warmupFraction(now) < 1
+}
+
+// onboard returns the trust stores to collect at now. During the warm-up
+// period this is a growing share of them, in ARN order so a trust store stays
+// onboarded once it has been collected.
+func (c *Collector) onboard(trustStores []types.TrustStore, now time.Time) []types.TrustStore {
+	fraction := c.warmupFraction(now)
+	if fraction >= 1 {
+		return trustStores
+	}
+
+	sorted := slices.Clone(trustStores)
+	slices.SortFunc(sorted, func(a, b types.TrustStore) int {
+		return strings.Compare(*a.TrustStoreArn, *b.TrustStoreArn)
+	})
+	n := int(math.Ceil(fraction * float64(len(sorted))))
+	return sorted[:n]
+}
+
+// nextScrapeInterval returns the time until the next background scrape, which
+// is a warm-up step while trust stores are still being onboarded, and
+// otherwise the interval plus a random jitter of up to QueryJitter.
+func (c *Collector) nextScrapeInterval(interval time.Duration, now time.Time) time.Duration {
+	if c.warmingUp(now) {
+		return min(c.opts.WarmupDuration/time.Duration(c.opts.WarmupSteps), interval)
+	}
+	if c.opts.QueryJitter > 0 {
+		return interval + rand.N(c.opts.QueryJitter)
+	}
+	return interval
+}
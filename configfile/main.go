@@ -0,0 +1,298 @@
+package configfile
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/appconfigdata"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/panubo/elb-trust-store-exporter/collector"
+	"github.com/panubo/elb-trust-store-exporter/maintenance"
+	"go.yaml.in/yaml/v2"
+)
+
+// Config is the exporter configuration read from a YAML file. Settings that
+// are present override the corresponding command-line flags.
+type Config struct {
+	TrustStoreARNs        []string             `yaml:"trust_store_arns"`
+	IncludeNameRegex      string               `yaml:"include_name_regex"`
+	ExcludeNameRegex      string               `yaml:"exclude_name_regex"`
+	QueryInterval         string               `yaml:"query_interval"`
+	DiscoveryInterval     string               `yaml:"discovery_interval"`
+	TrustStoreIntervals   []TrustStoreInterval `yaml:"trust_store_intervals"`
+	MaintenanceWindows    []maintenance.Config `yaml:"maintenance_windows"`
+	CertificateInfoLabels []string             `yaml:"certificate_info_labels"`
+}
+
+// TrustStoreInterval sets the query interval of the trust stores whose names
+// match NameRegex. The first matching entry applies.
+type TrustStoreInterval struct {
+	NameRegex string `yaml:"name_regex"`
+	Interval  string `yaml:"interval"`
+}
+
+// Parse decodes a YAML configuration, rejecting unknown settings.
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Apply overrides the collector options with the settings present in the
+// configuration.
+func (c *Config) Apply(opts *collector.Options) error {
+	if len(c.TrustStoreARNs) > 0 {
+		if err := collector.CheckTrustStoreARNs(c.TrustStoreARNs); err != nil {
+			return err
+		}
+		opts.TrustStoreARNs = c.TrustStoreARNs
+	}
+	if c.IncludeNameRegex != "" {
+		re, err := regexp.Compile(c.IncludeNameRegex)
+		if err != nil {
+			return fmt.Errorf("failed to parse include name regex: %w", err)
+		}
+		opts.IncludeNameRegex = re
+	}
+	if c.ExcludeNameRegex != "" {
+		re, err := regexp.Compile(c.ExcludeNameRegex)
+		if err != nil {
+			return fmt.Errorf("failed to parse exclude name regex: %w", err)
+		}
+		opts.ExcludeNameRegex = re
+	}
+	if c.QueryInterval != "" {
+		interval, err := time.ParseDuration(c.QueryInterval)
+		if err != nil {
+			return fmt.Errorf("failed to parse query interval: %w", err)
+		}
+		opts.QueryInterval = interval
+	}
+	if c.DiscoveryInterval != "" {
+		interval, err := time.ParseDuration(c.DiscoveryInterval)
+		if err != nil {
+			return fmt.Errorf("failed to parse discovery interval: %w", err)
+		}
+		opts.DiscoveryInterval = interval
+	}
+	for _, ic := range c.TrustStoreIntervals {
+		if ic.NameRegex == "" {
+			return errors.New("trust store interval has no name_regex")
+		}
+		re, err := regexp.Compile(ic.NameRegex)
+		if err != nil {
+			return fmt.Errorf("failed to parse trust store interval name regex: %w", err)
+		}
+		interval, err := time.ParseDuration(ic.Interval)
+		if err != nil {
+			return fmt.Errorf("failed to parse trust store interval for %q: %w", ic.NameRegex, err)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("trust store interval for %q must be positive", ic.NameRegex)
+		}
+		opts.TrustStoreIntervals = append(opts.TrustStoreIntervals, collector.TrustStoreInterval{
+			NameRegex: re,
+			Interval:  interval,
+		})
+	}
+	if len(c.CertificateInfoLabels) > 0 {
+		if err := collector.CheckCertificateInfoLabels(c.CertificateInfoLabels); err != nil {
+			return err
+		}
+		opts.CertificateInfoLabels = c.CertificateInfoLabels
+	}
+	names := make(map[string]bool, len(c.MaintenanceWindows))
+	for _, wc := range c.MaintenanceWindows {
+		w, err := maintenance.New(wc)
+		if err != nil {
+			return err
+		}
+		if names[w.Name()] {
+			return fmt.Errorf("maintenance window %q is defined twice", w.Name())
+		}
+		names[w.Name()] = true
+		opts.MaintenanceWindows = append(opts.MaintenanceWindows, w)
+	}
+	return nil
+}
+
+// Source fetches the raw configuration from where it is stored.
+type Source interface {
+	// Fetch returns the configuration and its version. It returns nil data
+	// if the configuration has not changed since the previous fetch.
+	Fetch(ctx context.Context) (data []byte, version string, err error)
+	// String describes the source.
+	String() string
+}
+
+// NewSource returns the source for a configuration location, one of a local
+// file path, s3://bucket/key or appconfig://application/environment/profile.
+func NewSource(location string, cfg aws.Config) (Source, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme == "" {
+		return &fileSource{path: location}, nil
+	}
+
+	switch u.Scheme {
+	case "file":
+		return &fileSource{path: u.Path}, nil
+	case "s3":
+		key := strings.TrimPrefix(u.Path, "/")
+		if u.Host == "" || key == "" {
+			return nil, fmt.Errorf("invalid S3 configuration location %q", location)
+		}
+		return &s3Source{client: s3.NewFromConfig(cfg), bucket: u.Host, key: key}, nil
+	case "appconfig":
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if u.Host == "" || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid AppConfig configuration location %q", location)
+		}
+		return &appConfigSource{
+			client:      appconfigdata.NewFromConfig(cfg),
+			application: u.Host,
+			environment: parts[0],
+			profile:     parts[1],
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported configuration location scheme %q", u.Scheme)
+	}
+}
+
+// fileSource reads the configuration from a local file.
+type fileSource struct {
+	path     string
+	checksum []byte
+}
+
+func (s *fileSource) Fetch(_ context.Context) ([]byte, string, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sum := sha256.Sum256(data)
+	version := hex.EncodeToString(sum[:])[:12]
+	if bytes.Equal(sum[:], s.checksum) {
+		return nil, version, nil
+	}
+	s.checksum = sum[:]
+	return data, version, nil
+}
+
+func (s *fileSource) String() string {
+	return s.path
+}
+
+// s3Source reads the configuration from an S3 object.
+type s3Source struct {
+	client  *s3.Client
+	bucket  string
+	key     string
+	etag    string
+	version string
+}
+
+func (s *s3Source) Fetch(ctx context.Context) ([]byte, string, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key),
+	}
+	if s.etag != "" {
+		input.IfNoneMatch = aws.String(s.etag)
+	}
+
+	out, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		var respErr *awshttp.ResponseError
+		if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotModified {
+			return nil, s.version, nil
+		}
+		return nil, "", err
+	}
+	defer func() {
+		_ = out.Body.Close()
+	}()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.etag = aws.ToString(out.ETag)
+	s.version = aws.ToString(out.VersionId)
+	if s.version == "" {
+		s.version = strings.Trim(s.etag, `"`)
+	}
+	return data, s.version, nil
+}
+
+func (s *s3Source) String() string {
+	return "s3://" + s.bucket + "/" + s.key
+}
+
+// appConfigSource reads the configuration from an AppConfig configuration
+// profile.
+type appConfigSource struct {
+	client      *appconfigdata.Client
+	application string
+	environment string
+	profile     string
+	token       *string
+	version     string
+}
+
+func (s *appConfigSource) Fetch(ctx context.Context) ([]byte, string, error) {
+	if s.token == nil {
+		session, err := s.client.StartConfigurationSession(
+			ctx,
+			&appconfigdata.StartConfigurationSessionInput{
+				ApplicationIdentifier:          aws.String(s.application),
+				EnvironmentIdentifier:          aws.String(s.environment),
+				ConfigurationProfileIdentifier: aws.String(s.profile),
+			},
+		)
+		if err != nil {
+			return nil, "", err
+		}
+		s.token = session.InitialConfigurationToken
+	}
+
+	out, err := s.client.GetLatestConfiguration(
+		ctx,
+		&appconfigdata.GetLatestConfigurationInput{
+			ConfigurationToken: s.token,
+		},
+	)
+	if err != nil {
+		// Tokens expire after 24 hours, so start a new session next time.
+		s.token = nil
+		return nil, "", err
+	}
+	s.token = out.NextPollConfigurationToken
+
+	// AppConfig returns no content when the configuration is unchanged.
+	if len(out.Configuration) == 0 {
+		return nil, s.version, nil
+	}
+	s.version = aws.ToString(out.VersionLabel)
+	return out.Configuration, s.version, nil
+}
+
+func (s *appConfigSource) String() string {
+	return "appconfig://" + s.application + "/" + s.environment + "/" + s.profile
+}
@@ -0,0 +1,180 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/authz"
+)
+
+// Event types published by the collector.
+const (
+	ScrapeStarted      = "scrape_started"
+	ScrapeCompleted    = "scrape_completed"
+	TrustStoreAdded    = "trust_store_added"
+	TrustStoreRemoved  = "trust_store_removed"
+	CertificateRemoved = "certificate_removed"
+	BundleChanged      = "bundle_changed"
+	BundleAnomaly      = "bundle_anomaly"
+	RuleFiring         = "rule_firing"
+	RuleResolved       = "rule_resolved"
+)
+
+// Event severities, in increasing order.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// severityRank orders the severities.
+var severityRank = map[string]int{
+	SeverityInfo:     0,
+	SeverityWarning:  1,
+	SeverityCritical: 2,
+}
+
+// ValidSeverity reports whether s is one of the event severities.
+func ValidSeverity(s string) bool {
+	_, ok := severityRank[s]
+	return ok
+}
+
+// AtLeast reports whether the event's severity is at least minimum.
+func (e Event) AtLeast(minimum string) bool {
+	return severityRank[e.Severity] >= severityRank[minimum]
+}
+
+// subscriberBuffer is the number of events buffered per subscriber before
+// further events are dropped for that subscriber.
+const subscriberBuffer = 64
+
+// Event is a single scrape or change event. Silenced is set for events raised
+// during a maintenance window, which are not sent to notifiers.
+type Event struct {
+	Type          string         `json:"type"`
+	Time          time.Time      `json:"time"`
+	Severity      string         `json:"severity"`
+	TrustStoreARN string         `json:"trust_store_arn,omitempty"`
+	Silenced      bool           `json:"silenced,omitempty"`
+	Data          map[string]any `json:"data,omitempty"`
+}
+
+// Broker fans published events out to all current subscribers. A nil Broker
+// discards all events.
+type Broker struct {
+	mutex       sync.Mutex
+	subscribers map[chan Event]struct{}
+	closed      bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Publish sends an event to every subscriber without blocking. Subscribers
+// that are not keeping up miss the event.
+func (b *Broker) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Severity == "" {
+		e.Severity = SeverityInfo
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe registers a new subscriber. The returned function must be called
+// to unsubscribe.
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mutex.Lock()
+	if b.closed {
+		close(ch)
+	} else {
+		b.subscribers[ch] = struct{}{}
+	}
+	b.mutex.Unlock()
+
+	return ch, func() {
+		b.mutex.Lock()
+		delete(b.subscribers, ch)
+		b.mutex.Unlock()
+	}
+}
+
+// Close ends every subscription, closing the subscriber channels so event
+// streams return. Later subscriptions receive an already closed channel.
+func (b *Broker) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.closed = true
+	for ch := range b.subscribers {
+		close(ch)
+		delete(b.subscribers, ch)
+	}
+}
+
+// ServeHTTP streams events to the client as server-sent events. Events about
+// trust stores the request is not authorized for are left out.
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// Event streams are long lived, so lift the server's write timeout.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("failed to clear write deadline for event stream: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Printf("failed to flush event stream: %v", err)
+		return
+	}
+
+	ch, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if e.TrustStoreARN != "" && !authz.Allowed(r.Context(), e.TrustStoreARN) {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Printf("failed to marshal event: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
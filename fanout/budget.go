@@ -0,0 +1,61 @@
+package fanout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// budget is a token bucket limiting the rate of an account's requests. A
+// budget with a zero rate admits every request immediately.
+type budget struct {
+	rate  float64
+	burst float64
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newBudget(rate float64, burst int) *budget {
+	b := &budget{rate: rate, burst: float64(max(burst, 1))}
+	b.tokens = b.burst
+	return b
+}
+
+// wait takes a token, waiting until one is available or ctx is done.
+func (b *budget) wait(ctx context.Context) error {
+	if b.rate <= 0 {
+		return nil
+	}
+
+	b.mutex.Lock()
+	now := time.Now()
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	// Tokens may go negative, reserving future tokens for the requests
+	// already waiting.
+	b.tokens--
+	delay := time.Duration(0)
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mutex.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mutex.Lock()
+		b.tokens++
+		b.mutex.Unlock()
+		return ctx.Err()
+	}
+}
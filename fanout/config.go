@@ -0,0 +1,119 @@
+package fanout
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"go.yaml.in/yaml/v2"
+)
+
+var accountIDRegex = regexp.MustCompile(`^[0-9]{12}$`)
+
+// Config is the fan-out configuration read from a YAML file: the accounts to
+// monitor, the regions to monitor in each, and the budgets of AWS API
+// requests.
+type Config struct {
+	// MaxConcurrency caps the AWS API requests in flight across all targets.
+	// Zero means no limit.
+	MaxConcurrency int `yaml:"max_concurrency"`
+	// Regions are the regions monitored in accounts that do not list their
+	// own.
+	Regions []string `yaml:"regions"`
+	// RequestsPerSecond and Burst are the default request budget of each
+	// account.
+	RequestsPerSecond float64         `yaml:"requests_per_second"`
+	Burst             int             `yaml:"burst"`
+	Accounts          []AccountConfig `yaml:"accounts"`
+}
+
+// AccountConfig is an account to monitor. The account's trust stores are
+// queried with the credentials of RoleARN if it is set, and otherwise with the
+// exporter's own credentials.
+type AccountConfig struct {
+	ID                string   `yaml:"id"`
+	RoleARN           string   `yaml:"role_arn"`
+	ExternalID        string   `yaml:"external_id"`
+	Regions           []string `yaml:"regions"`
+	RequestsPerSecond float64  `yaml:"requests_per_second"`
+	Burst             int      `yaml:"burst"`
+}
+
+// Target is an account and region to monitor.
+type Target struct {
+	Account    string
+	Region     string
+	RoleARN    string
+	ExternalID string
+}
+
+// String returns the account and region of the target.
+func (t Target) String() string {
+	return t.Account + "/" + t.Region
+}
+
+// LoadConfig reads a fan-out configuration file, rejecting unknown settings.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration in %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	if c.MaxConcurrency < 0 {
+		return fmt.Errorf("max_concurrency must not be negative")
+	}
+	if len(c.Accounts) == 0 {
+		return fmt.Errorf("no accounts are configured")
+	}
+	seen := make(map[string]bool, len(c.Accounts))
+	for _, a := range c.Accounts {
+		if !accountIDRegex.MatchString(a.ID) {
+			return fmt.Errorf("account id %q is not a 12 digit AWS account ID", a.ID)
+		}
+		if seen[a.ID] {
+			return fmt.Errorf("account %s is configured twice", a.ID)
+		}
+		seen[a.ID] = true
+		if len(a.Regions) == 0 && len(c.Regions) == 0 {
+			return fmt.Errorf("account %s has no regions and there are no default regions", a.ID)
+		}
+		if a.RequestsPerSecond < 0 || a.Burst < 0 {
+			return fmt.Errorf("account %s has a negative request budget", a.ID)
+		}
+	}
+	if c.RequestsPerSecond < 0 || c.Burst < 0 {
+		return fmt.Errorf("the default request budget is negative")
+	}
+	return nil
+}
+
+// Targets returns every account and region to monitor, in configuration
+// order.
+func (c *Config) Targets() []Target {
+	var targets []Target
+	for _, a := range c.Accounts {
+		regions := a.Regions
+		if len(regions) == 0 {
+			regions = c.Regions
+		}
+		for _, region := range regions {
+			targets = append(targets, Target{
+				Account:    a.ID,
+				Region:     region,
+				RoleARN:    a.RoleARN,
+				ExternalID: a.ExternalID,
+			})
+		}
+	}
+	return targets
+}
@@ -0,0 +1,176 @@
+// Package fanout monitors trust stores across many AWS accounts and regions.
+// Every account and region is a target with its own collector, and a shared
+// Scheduler runs the AWS API requests of all targets under a global
+// concurrency limit and a request budget per account.
+package fanout
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/panubo/elb-trust-store-exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// roleSessionName is the session name of the roles assumed in target
+// accounts.
+const roleSessionName = "elb-trust-store-exporter"
+
+// Scheduler admits the AWS API requests of every target. A request first
+// waits for its account's budget and then for one of the global slots.
+type Scheduler struct {
+	// slots holds a token for every request in flight, and is nil if the
+	// number of requests in flight is not limited.
+	slots   chan struct{}
+	budgets map[string]*budget
+
+	inFlight    prometheus.Gauge
+	requests    *prometheus.CounterVec
+	waitSeconds *prometheus.CounterVec
+}
+
+// NewScheduler returns a Scheduler with the concurrency limit and budgets of
+// cfg.
+func NewScheduler(cfg *Config) *Scheduler {
+	s := &Scheduler{
+		budgets: make(map[string]*budget, len(cfg.Accounts)),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: collector.Namespace,
+			Subsystem: "exporter",
+			Name:      "fanout_requests_in_flight",
+			Help:      "The number of AWS API requests in flight across all targets.",
+		}),
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: collector.Namespace,
+				Subsystem: "exporter",
+				Name:      "fanout_requests_total",
+				Help:      "The number of AWS API request attempts by target account, region and result.",
+			},
+			[]string{"aws_account", "aws_region", "result"},
+		),
+		waitSeconds: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: collector.Namespace,
+				Subsystem: "exporter",
+				Name:      "fanout_wait_seconds_total",
+				Help:      "The time AWS API requests spent waiting for their account's request budget and a concurrency slot.",
+			},
+			[]string{"aws_account"},
+		),
+	}
+	if cfg.MaxConcurrency > 0 {
+		s.slots = make(chan struct{}, cfg.MaxConcurrency)
+	}
+	for _, a := range cfg.Accounts {
+		rate, burst := a.RequestsPerSecond, a.Burst
+		if rate == 0 {
+			rate = cfg.RequestsPerSecond
+		}
+		if burst == 0 {
+			burst = cfg.Burst
+		}
+		s.budgets[a.ID] = newBudget(rate, burst)
+	}
+	return s
+}
+
+// AWSConfig returns a copy of base for the target: in the target's region,
+// with the credentials of its role if it has one, and with every API request
+// admitted by the scheduler.
+func (s *Scheduler) AWSConfig(base aws.Config, t Target) aws.Config {
+	cfg := base.Copy()
+	cfg.Region = t.Region
+	if t.RoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(base), t.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = roleSessionName
+			if t.ExternalID != "" {
+				o.ExternalID = aws.String(t.ExternalID)
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	cfg.APIOptions = append(slices.Clip(base.APIOptions), func(stack *middleware.Stack) error {
+		return s.addMiddleware(stack, t)
+	})
+	return cfg
+}
+
+// addMiddleware registers the scheduling of a target's requests on an SDK
+// client's middleware stack. It runs after the retry middleware so every
+// attempt is admitted and counted.
+func (s *Scheduler) addMiddleware(stack *middleware.Stack, t Target) error {
+	return stack.Finalize.Insert(
+		middleware.FinalizeMiddlewareFunc(
+			"FanoutScheduler",
+			func(
+				ctx context.Context,
+				in middleware.FinalizeInput,
+				next middleware.FinalizeHandler,
+			) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				release, err := s.admit(ctx, t.Account)
+				if err != nil {
+					return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+				}
+				defer release()
+
+				out, metadata, err := next.HandleFinalize(ctx, in)
+				result := "success"
+				if err != nil {
+					result = "error"
+				}
+				s.requests.WithLabelValues(t.Account, awsmiddleware.GetRegion(ctx), result).Inc()
+				return out, metadata, err
+			},
+		),
+		"Retry",
+		middleware.After,
+	)
+}
+
+// admit waits for the account's budget and a concurrency slot, and returns a
+// function that releases the slot once the request completes.
+func (s *Scheduler) admit(ctx context.Context, account string) (func(), error) {
+	start := time.Now()
+	defer func() {
+		s.waitSeconds.WithLabelValues(account).Add(time.Since(start).Seconds())
+	}()
+
+	if b := s.budgets[account]; b != nil {
+		if err := b.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	s.inFlight.Inc()
+	return func() {
+		s.inFlight.Dec()
+		if s.slots != nil {
+			<-s.slots
+		}
+	}, nil
+}
+
+func (s *Scheduler) Describe(ch chan<- *prometheus.Desc) {
+	s.inFlight.Describe(ch)
+	s.requests.Describe(ch)
+	s.waitSeconds.Describe(ch)
+}
+
+func (s *Scheduler) Collect(ch chan<- prometheus.Metric) {
+	s.inFlight.Collect(ch)
+	s.requests.Collect(ch)
+	s.waitSeconds.Collect(ch)
+}
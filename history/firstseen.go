@@ -0,0 +1,65 @@
+package history
+
+import (
+	"github.com/panubo/elb-trust-store-exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var firstSeenDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(collector.Namespace, "certificate", "first_seen_timestamp_seconds"),
+	"The timestamp of the earliest history snapshot in which the certificate is in the trust store (in seconds since epoch).",
+	[]string{"trust_store_arn", "serial_number", "subject"},
+	nil,
+)
+
+// firstSeenKey identifies a certificate in a trust store.
+func firstSeenKey(arn string, cert collector.CertificateSnapshot) string {
+	return arn + "\x00" + cert.FingerprintSHA256
+}
+
+// indexFirstSeen records the time of the earliest retained snapshot that
+// includes each certificate of each trust store. The caller must hold s.mutex
+// for writing.
+func (s *Store) indexFirstSeen() {
+	s.firstSeen = make(map[string]float64)
+	for _, snapshot := range s.snapshots {
+		for _, ts := range snapshot.TrustStores {
+			for _, cert := range ts.Certificates {
+				key := firstSeenKey(ts.ARN, cert)
+				if _, ok := s.firstSeen[key]; !ok {
+					s.firstSeen[key] = float64(snapshot.Time.Unix())
+				}
+			}
+		}
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (s *Store) Describe(ch chan<- *prometheus.Desc) {
+	ch <- firstSeenDesc
+}
+
+// Collect implements prometheus.Collector, exporting when each certificate in
+// the latest snapshot first appeared in its trust store. Certificates already
+// present before the retention period are reported at the earliest retained
+// snapshot.
+func (s *Store) Collect(ch chan<- prometheus.Metric) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if len(s.snapshots) == 0 {
+		return
+	}
+	for _, ts := range s.snapshots[len(s.snapshots)-1].TrustStores {
+		for _, cert := range ts.Certificates {
+			ch <- prometheus.MustNewConstMetric(
+				firstSeenDesc,
+				prometheus.GaugeValue,
+				s.firstSeen[firstSeenKey(ts.ARN, cert)],
+				ts.ARN,
+				cert.SerialNumber,
+				cert.Subject,
+			)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Package history persists snapshots of the trust stores found by each scrape
+// so their expiry distribution can be charted over time.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/collector"
+)
+
+// Store keeps the snapshots recorded within the retention period in memory
+// and appends them to a JSON lines file. A snapshot is only recorded when the
+// trust stores differ from the previous one, so an unchanged account adds
+// nothing however often it is scraped.
+type Store struct {
+	path      string
+	retention time.Duration
+
+	mutex     sync.RWMutex
+	snapshots []collector.Snapshot
+	// firstSeen holds the Unix time of the earliest retained snapshot that
+	// includes each certificate, keyed by firstSeenKey.
+	firstSeen map[string]float64
+}
+
+// Open loads the snapshots in the file at path, discarding those older than
+// retention, and rewrites the file without them.
+func Open(path string, retention time.Duration) (*Store, error) {
+	s := &Store{path: path, retention: retention}
+
+	f, err := os.Open(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if f != nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 64<<20)
+		for scanner.Scan() {
+			var snapshot collector.Snapshot
+			if err := json.Unmarshal(scanner.Bytes(), &snapshot); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+			s.snapshots = append(s.snapshots, snapshot)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+
+	s.prune(time.Now())
+	s.indexFirstSeen()
+	if err := s.rewrite(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Record appends the snapshot if its trust stores differ from the last one.
+func (s *Store) Record(snapshot collector.Snapshot) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if n := len(s.snapshots); n > 0 && sameTrustStores(s.snapshots[n-1].TrustStores, snapshot.TrustStores) {
+		return
+	}
+	s.snapshots = append(s.snapshots, snapshot)
+	s.prune(snapshot.Time)
+	s.indexFirstSeen()
+
+	if err := s.append(snapshot); err != nil {
+		log.Printf("Error writing history snapshot: %v", err)
+	}
+}
+
+func sameTrustStores(a, b []collector.TrustStoreSnapshot) bool {
+	return slices.EqualFunc(a, b, func(a, b collector.TrustStoreSnapshot) bool {
+		return a.ARN == b.ARN && a.Name == b.Name &&
+			slices.EqualFunc(a.Certificates, b.Certificates, func(a, b collector.CertificateSnapshot) bool {
+				return a.SerialNumber == b.SerialNumber &&
+					a.FingerprintSHA256 == b.FingerprintSHA256 &&
+					a.Subject == b.Subject &&
+					a.Issuer == b.Issuer &&
+					a.NotBefore.Equal(b.NotBefore) &&
+					a.NotAfter.Equal(b.NotAfter)
+			})
+	})
+}
+
+// At returns the latest snapshot taken at or before t.
+func (s *Store) At(t time.Time) (collector.Snapshot, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	i, found := slices.BinarySearchFunc(s.snapshots, t, func(snapshot collector.Snapshot, t time.Time) int {
+		return snapshot.Time.Compare(t)
+	})
+	if found {
+		return s.snapshots[i], true
+	}
+	if i == 0 {
+		return collector.Snapshot{}, false
+	}
+	return s.snapshots[i-1], true
+}
+
+// prune drops snapshots older than the retention period, keeping the latest
+// one before it so the state at the start of the period is known. The caller
+// must hold s.mutex.
+func (s *Store) prune(now time.Time) {
+	cutoff := now.Add(-s.retention)
+	i := 0
+	for i+1 < len(s.snapshots) && !s.snapshots[i+1].Time.After(cutoff) {
+		i++
+	}
+	s.snapshots = s.snapshots[i:]
+}
+
+// append writes a snapshot to the end of the file.
+func (s *Store) append(snapshot collector.Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rewrite replaces the file with the retained snapshots.
+func (s *Store) rewrite() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, snapshot := range s.snapshots {
+		if err := enc.Encode(snapshot); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// histogramBuckets are the upper bounds, in days until expiry, of the
+// expiry histogram buckets. Certificates expiring after the last bound are
+// counted in a final bucket without one.
+var histogramBuckets = []int{0, 7, 30, 90, 180, 365}
+
+// Bucket is a bucket of an expiry histogram. It counts the certificates
+// expiring after the previous bucket's MaxDays and within MaxDays. The first
+// bucket, with MaxDays 0, counts expired certificates and the last, without
+// MaxDays, those expiring after the largest bound.
+type Bucket struct {
+	MaxDays *int `json:"max_days"`
+	Count   int  `json:"count"`
+}
+
+// Histogram is the expiry distribution of a trust store's certificates at a
+// point in time.
+type Histogram struct {
+	TrustStoreARN string    `json:"trust_store_arn"`
+	At            time.Time `json:"at"`
+	SnapshotTime  time.Time `json:"snapshot_time"`
+	Certificates  int       `json:"certificates"`
+	Buckets       []Bucket  `json:"buckets"`
+}
+
+// Histogram returns the expiry histogram of the trust store as it was at t.
+func (s *Store) Histogram(arn string, t time.Time) (Histogram, bool) {
+	snapshot, ok := s.At(t)
+	if !ok {
+		return Histogram{}, false
+	}
+	i := slices.IndexFunc(snapshot.TrustStores, func(ts collector.TrustStoreSnapshot) bool {
+		return ts.ARN == arn
+	})
+	if i < 0 {
+		return Histogram{}, false
+	}
+
+	h := Histogram{
+		TrustStoreARN: arn,
+		At:            t,
+		SnapshotTime:  snapshot.Time,
+		Certificates:  len(snapshot.TrustStores[i].Certificates),
+		Buckets:       make([]Bucket, len(histogramBuckets)+1),
+	}
+	for b := range histogramBuckets {
+		h.Buckets[b].MaxDays = &histogramBuckets[b]
+	}
+	for _, cert := range snapshot.TrustStores[i].Certificates {
+		days := cert.NotAfter.Sub(t).Hours() / 24
+		b := len(histogramBuckets)
+		for j, bound := range histogramBuckets {
+			if days <= float64(bound) {
+				b = j
+				break
+			}
+		}
+		h.Buckets[b].Count++
+	}
+	return h, true
+}
+
+// ServeHTTP serves the expiry histogram of the trust store whose URL-encoded
+// ARN is the {arn} path value, at the Unix timestamp in the at parameter or
+// now if it is not set.
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	at := time.Now()
+	if v := r.URL.Query().Get("at"); v != "" {
+		t, err := parseTimestamp(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid at parameter: %v", err), http.StatusBadRequest)
+			return
+		}
+		at = t
+	}
+
+	h, ok := s.Histogram(r.PathValue("arn"), at)
+	if !ok {
+		http.Error(w, "no snapshot of the trust store at that time", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h); err != nil {
+		log.Printf("failed to write expiry histogram: %v", err)
+	}
+}
+
+// parseTimestamp parses a Unix timestamp in seconds, which may be fractional,
+// or an RFC 3339 time, as accepted by the Prometheus HTTP API.
+func parseTimestamp(v string) (time.Time, error) {
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+	return time.Parse(time.RFC3339Nano, v)
+}
@@ -0,0 +1,576 @@
+// Package fakeaws provides an in-process fake of the ELBv2 trust store API and
+// the S3 objects used to download CA bundles and revocation lists, so the full
+// scrape pipeline can be run without AWS credentials.
+package fakeaws
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+)
+
+const (
+	xmlns = "http://elasticloadbalancing.amazonaws.com/doc/2015-12-01/"
+	// Region is the region of the fake API.
+	Region = "us-east-1"
+	// AccountID is the account that owns the fake trust stores.
+	AccountID = "123456789012"
+	// defaultPageSize is the page size used when the request does not set one.
+	defaultPageSize = 20
+	// maxTrustStoreARNs is the maximum number of ARNs in a DescribeTrustStores
+	// request.
+	maxTrustStoreARNs = 20
+)
+
+// TrustStore is a trust store served by the fake API.
+type TrustStore struct {
+	Name string
+	ARN  string
+	// Bundle is the PEM encoded CA certificates bundle.
+	Bundle []byte
+	// NumberOfCACertificates is reported by DescribeTrustStores.
+	NumberOfCACertificates int
+	// RevocationLists are the DER encoded CRLs uploaded to the trust store.
+	RevocationLists []RevocationList
+	// Tags are the resource tags of the trust store.
+	Tags map[string]string
+	// Listeners are the listeners that use the trust store for mutual TLS.
+	Listeners []Listener
+}
+
+// Listener is a load balancer listener using a trust store.
+type Listener struct {
+	ARN             string
+	LoadBalancerARN string
+	// Mode is the mutual TLS mode, verify or passthrough.
+	Mode string
+	// AdvertiseCANames advertises the subject names of the trust store's CAs
+	// to clients.
+	AdvertiseCANames bool
+	// HealthyTargets and UnhealthyTargets are the number of targets in the
+	// listener's target group.
+	HealthyTargets   int
+	UnhealthyTargets int
+}
+
+// RevocationList is a CRL uploaded to a trust store.
+type RevocationList struct {
+	Content        []byte
+	RevokedEntries int
+}
+
+// Server is a fake ELBv2 and S3 endpoint.
+type Server struct {
+	*httptest.Server
+
+	mutex       sync.Mutex
+	trustStores []*TrustStore
+}
+
+// NewServer starts a fake server with no trust stores.
+func NewServer() *Server {
+	s := &Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /", s.handleELB)
+	mux.HandleFunc("GET /bundles/{index}", s.handleBundle)
+	mux.HandleFunc("GET /revocations/{index}/{id}", s.handleRevocation)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// AddTrustStore adds a trust store to the fake API.
+func (s *Server) AddTrustStore(ts *TrustStore) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.trustStores = append(s.trustStores, ts)
+}
+
+// RemoveTrustStore removes the trust store with the given ARN.
+func (s *Server) RemoveTrustStore(arn string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.trustStores = slices.DeleteFunc(s.trustStores, func(ts *TrustStore) bool {
+		return ts.ARN == arn
+	})
+}
+
+// ELBClient returns an ELBv2 client that talks to the fake server.
+func (s *Server) ELBClient() *elasticloadbalancingv2.Client {
+	return elasticloadbalancingv2.NewFromConfig(
+		aws.Config{
+			Region:      Region,
+			Credentials: credentials.NewStaticCredentialsProvider("fake", "fake", ""),
+		},
+		func(o *elasticloadbalancingv2.Options) {
+			o.BaseEndpoint = aws.String(s.URL)
+		},
+	)
+}
+
+// LoadBalancerARN returns the ARN of a fake application load balancer with the
+// given name.
+func LoadBalancerARN(name string) string {
+	return fmt.Sprintf("arn:aws:elasticloadbalancing:%s:%s:loadbalancer/app/%s/%s", Region, AccountID, name, resourceID(name))
+}
+
+// ListenerARN returns the ARN of a fake HTTPS listener on the named load
+// balancer.
+func ListenerARN(loadBalancer string, port int) string {
+	return fmt.Sprintf(
+		"arn:aws:elasticloadbalancing:%s:%s:listener/app/%s/%s/%s",
+		Region,
+		AccountID,
+		loadBalancer,
+		resourceID(loadBalancer),
+		resourceID(fmt.Sprintf("%s:%d", loadBalancer, port)),
+	)
+}
+
+// TrustStoreARN returns the ARN of a fake trust store with the given name.
+func TrustStoreARN(name string) string {
+	return fmt.Sprintf("arn:aws:elasticloadbalancing:%s:%s:truststore/%s/%s", Region, AccountID, name, resourceID(name))
+}
+
+// resourceID returns a stable resource ID derived from name.
+func resourceID(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (s *Server) handleELB(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "ValidationError", err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch action := r.Form.Get("Action"); action {
+	case "DescribeTrustStores":
+		s.describeTrustStores(w, r)
+	case "GetTrustStoreCaCertificatesBundle":
+		index, ts := s.find(r.Form.Get("TrustStoreArn"))
+		if ts == nil {
+			writeNotFound(w)
+			return
+		}
+		writeResult(w, action, struct {
+			Location string `xml:"Location"`
+		}{Location: fmt.Sprintf("%s/bundles/%d", s.URL, index)})
+	case "DescribeTrustStoreRevocations":
+		s.describeTrustStoreRevocations(w, r)
+	case "DescribeTags":
+		s.describeTags(w, r)
+	case "DescribeTrustStoreAssociations":
+		s.describeTrustStoreAssociations(w, r)
+	case "DescribeListeners":
+		s.describeListeners(w, r)
+	case "DescribeTargetGroups":
+		s.describeTargetGroups(w, r)
+	case "DescribeTargetHealth":
+		s.describeTargetHealth(w, r)
+	case "GetTrustStoreRevocationContent":
+		index, ts := s.find(r.Form.Get("TrustStoreArn"))
+		if ts == nil {
+			writeNotFound(w)
+			return
+		}
+		id, err := strconv.Atoi(r.Form.Get("RevocationId"))
+		if err != nil || id < 1 || id > len(ts.RevocationLists) {
+			writeError(w, http.StatusBadRequest, "RevocationIdNotFound", "revocation not found")
+			return
+		}
+		writeResult(w, action, struct {
+			Location string `xml:"Location"`
+		}{Location: fmt.Sprintf("%s/revocations/%d/%d", s.URL, index, id)})
+	default:
+		writeError(w, http.StatusBadRequest, "InvalidAction", "unsupported action "+action)
+	}
+}
+
+type trustStoreMember struct {
+	Name                   string `xml:"Name"`
+	TrustStoreArn          string `xml:"TrustStoreArn"`
+	Status                 string `xml:"Status"`
+	NumberOfCaCertificates int    `xml:"NumberOfCaCertificates"`
+	TotalRevokedEntries    int    `xml:"TotalRevokedEntries"`
+}
+
+func (s *Server) describeTrustStores(w http.ResponseWriter, r *http.Request) {
+	arns := members(r, "TrustStoreArns")
+	names := members(r, "Names")
+	if len(arns) > maxTrustStoreARNs {
+		writeError(w, http.StatusBadRequest, "ValidationError", fmt.Sprintf("at most %d trust store ARNs can be described", maxTrustStoreARNs))
+		return
+	}
+
+	var matched []*TrustStore
+	for _, arn := range arns {
+		if !strings.HasPrefix(arn, "arn:") {
+			writeError(w, http.StatusBadRequest, "ValidationError", fmt.Sprintf("%q is not a valid ARN", arn))
+			return
+		}
+	}
+	for _, arn := range arns {
+		_, ts := s.find(arn)
+		if ts == nil {
+			writeNotFound(w)
+			return
+		}
+		matched = append(matched, ts)
+	}
+	if len(arns) == 0 {
+		for _, ts := range s.trustStores {
+			if len(names) == 0 || slices.Contains(names, ts.Name) {
+				matched = append(matched, ts)
+			}
+		}
+	}
+
+	page, next := paginate(r, matched)
+	result := struct {
+		TrustStores []trustStoreMember `xml:"TrustStores>member"`
+		NextMarker  string             `xml:"NextMarker,omitempty"`
+	}{NextMarker: next}
+	for _, ts := range page {
+		revoked := 0
+		for _, rl := range ts.RevocationLists {
+			revoked += rl.RevokedEntries
+		}
+		result.TrustStores = append(result.TrustStores, trustStoreMember{
+			Name:                   ts.Name,
+			TrustStoreArn:          ts.ARN,
+			Status:                 "ACTIVE",
+			NumberOfCaCertificates: ts.NumberOfCACertificates,
+			TotalRevokedEntries:    revoked,
+		})
+	}
+	writeResult(w, "DescribeTrustStores", result)
+}
+
+func (s *Server) describeTrustStoreRevocations(w http.ResponseWriter, r *http.Request) {
+	_, ts := s.find(r.Form.Get("TrustStoreArn"))
+	if ts == nil {
+		writeNotFound(w)
+		return
+	}
+
+	type revocationMember struct {
+		TrustStoreArn          string `xml:"TrustStoreArn"`
+		RevocationId           int    `xml:"RevocationId"`
+		RevocationType         string `xml:"RevocationType"`
+		NumberOfRevokedEntries int    `xml:"NumberOfRevokedEntries"`
+	}
+	result := struct {
+		TrustStoreRevocations []revocationMember `xml:"TrustStoreRevocations>member"`
+	}{}
+	for i, rl := range ts.RevocationLists {
+		result.TrustStoreRevocations = append(result.TrustStoreRevocations, revocationMember{
+			TrustStoreArn:          ts.ARN,
+			RevocationId:           i + 1,
+			RevocationType:         "CRL",
+			NumberOfRevokedEntries: rl.RevokedEntries,
+		})
+	}
+	writeResult(w, "DescribeTrustStoreRevocations", result)
+}
+
+func (s *Server) describeTags(w http.ResponseWriter, r *http.Request) {
+	type tag struct {
+		Key   string `xml:"Key"`
+		Value string `xml:"Value"`
+	}
+	type tagDescription struct {
+		ResourceArn string `xml:"ResourceArn"`
+		Tags        []tag  `xml:"Tags>member"`
+	}
+	result := struct {
+		TagDescriptions []tagDescription `xml:"TagDescriptions>member"`
+	}{}
+	for _, arn := range members(r, "ResourceArns") {
+		_, ts := s.find(arn)
+		if ts == nil {
+			writeNotFound(w)
+			return
+		}
+		desc := tagDescription{ResourceArn: ts.ARN}
+		for _, key := range slices.Sorted(maps.Keys(ts.Tags)) {
+			desc.Tags = append(desc.Tags, tag{Key: key, Value: ts.Tags[key]})
+		}
+		result.TagDescriptions = append(result.TagDescriptions, desc)
+	}
+	writeResult(w, "DescribeTags", result)
+}
+
+func (s *Server) describeTrustStoreAssociations(w http.ResponseWriter, r *http.Request) {
+	_, ts := s.find(r.Form.Get("TrustStoreArn"))
+	if ts == nil {
+		writeNotFound(w)
+		return
+	}
+
+	// Trust stores are associated with the load balancers of their listeners.
+	type association struct {
+		ResourceArn string `xml:"ResourceArn"`
+	}
+	result := struct {
+		TrustStoreAssociations []association `xml:"TrustStoreAssociations>member"`
+	}{}
+	var seen []string
+	for _, l := range ts.Listeners {
+		if !slices.Contains(seen, l.LoadBalancerARN) {
+			seen = append(seen, l.LoadBalancerARN)
+			result.TrustStoreAssociations = append(result.TrustStoreAssociations, association{ResourceArn: l.LoadBalancerARN})
+		}
+	}
+	writeResult(w, "DescribeTrustStoreAssociations", result)
+}
+
+func (s *Server) describeListeners(w http.ResponseWriter, r *http.Request) {
+	type mutualAuthentication struct {
+		Mode                       string `xml:"Mode"`
+		TrustStoreArn              string `xml:"TrustStoreArn"`
+		AdvertiseTrustStoreCaNames string `xml:"AdvertiseTrustStoreCaNames"`
+	}
+	type listener struct {
+		ListenerArn          string               `xml:"ListenerArn"`
+		LoadBalancerArn      string               `xml:"LoadBalancerArn"`
+		Port                 int                  `xml:"Port"`
+		Protocol             string               `xml:"Protocol"`
+		MutualAuthentication mutualAuthentication `xml:"MutualAuthentication"`
+	}
+	result := struct {
+		Listeners []listener `xml:"Listeners>member"`
+	}{}
+
+	arns := members(r, "ListenerArns")
+	loadBalancer := r.Form.Get("LoadBalancerArn")
+	for _, ts := range s.trustStores {
+		for _, l := range ts.Listeners {
+			if slices.Contains(arns, l.ARN) || l.LoadBalancerARN == loadBalancer {
+				advertise := "off"
+				if l.AdvertiseCANames {
+					advertise = "on"
+				}
+				result.Listeners = append(result.Listeners, listener{
+					ListenerArn:     l.ARN,
+					LoadBalancerArn: l.LoadBalancerARN,
+					Port:            443,
+					Protocol:        "HTTPS",
+					MutualAuthentication: mutualAuthentication{
+						Mode:                       l.Mode,
+						TrustStoreArn:              ts.ARN,
+						AdvertiseTrustStoreCaNames: advertise,
+					},
+				})
+			}
+		}
+	}
+	writeResult(w, "DescribeListeners", result)
+}
+
+// describeTargetGroups returns one target group for each listener on the load
+// balancer.
+func (s *Server) describeTargetGroups(w http.ResponseWriter, r *http.Request) {
+	type targetGroup struct {
+		TargetGroupArn   string   `xml:"TargetGroupArn"`
+		LoadBalancerArns []string `xml:"LoadBalancerArns>member"`
+	}
+	result := struct {
+		TargetGroups []targetGroup `xml:"TargetGroups>member"`
+	}{}
+
+	loadBalancer := r.Form.Get("LoadBalancerArn")
+	for _, ts := range s.trustStores {
+		for _, l := range ts.Listeners {
+			if l.LoadBalancerARN == loadBalancer {
+				result.TargetGroups = append(result.TargetGroups, targetGroup{
+					TargetGroupArn:   targetGroupARN(l.ARN),
+					LoadBalancerArns: []string{l.LoadBalancerARN},
+				})
+			}
+		}
+	}
+	writeResult(w, "DescribeTargetGroups", result)
+}
+
+func (s *Server) describeTargetHealth(w http.ResponseWriter, r *http.Request) {
+	type targetHealthDescription struct {
+		Target struct {
+			Id   string `xml:"Id"`
+			Port int    `xml:"Port"`
+		} `xml:"Target"`
+		State string `xml:"TargetHealth>State"`
+	}
+	result := struct {
+		TargetHealthDescriptions []targetHealthDescription `xml:"TargetHealthDescriptions>member"`
+	}{}
+
+	arn := r.Form.Get("TargetGroupArn")
+	for _, ts := range s.trustStores {
+		for _, l := range ts.Listeners {
+			if targetGroupARN(l.ARN) != arn {
+				continue
+			}
+			for i := range l.HealthyTargets + l.UnhealthyTargets {
+				desc := targetHealthDescription{State: "healthy"}
+				desc.Target.Id = fmt.Sprintf("i-%017x", i+1)
+				desc.Target.Port = 8443
+				if i >= l.HealthyTargets {
+					desc.State = "unhealthy"
+				}
+				result.TargetHealthDescriptions = append(result.TargetHealthDescriptions, desc)
+			}
+			writeResult(w, "DescribeTargetHealth", result)
+			return
+		}
+	}
+	writeError(w, http.StatusBadRequest, "TargetGroupNotFound", "One or more target groups not found")
+}
+
+// targetGroupARN returns the ARN of the fake target group behind a listener.
+func targetGroupARN(listenerARN string) string {
+	id := resourceID(listenerARN)
+	return fmt.Sprintf("arn:aws:elasticloadbalancing:%s:%s:targetgroup/demo-%s/%s", Region, AccountID, id[:8], id)
+}
+
+func (s *Server) handleBundle(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	ts := s.byIndex(r.PathValue("index"))
+	s.mutex.Unlock()
+	if ts == nil {
+		http.NotFound(w, r)
+		return
+	}
+	serveObject(w, r, ts.Bundle)
+}
+
+func (s *Server) handleRevocation(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	ts := s.byIndex(r.PathValue("index"))
+	s.mutex.Unlock()
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if ts == nil || err != nil || id < 1 || id > len(ts.RevocationLists) {
+		http.NotFound(w, r)
+		return
+	}
+	serveObject(w, r, ts.RevocationLists[id-1].Content)
+}
+
+// find returns the trust store with the given ARN and its index. The caller
+// must hold s.mutex.
+func (s *Server) find(arn string) (int, *TrustStore) {
+	for i, ts := range s.trustStores {
+		if ts.ARN == arn {
+			return i, ts
+		}
+	}
+	return -1, nil
+}
+
+// byIndex returns the trust store at the index in a download path. The caller
+// must hold s.mutex.
+func (s *Server) byIndex(value string) *TrustStore {
+	index, err := strconv.Atoi(value)
+	if err != nil || index < 0 || index >= len(s.trustStores) {
+		return nil
+	}
+	return s.trustStores[index]
+}
+
+// serveObject serves an S3 object body with an ETag, honouring If-None-Match.
+func serveObject(w http.ResponseWriter, r *http.Request, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if _, err := w.Write(body); err != nil {
+		log.Printf("failed to write fake object: %v", err)
+	}
+}
+
+// members returns the values of a query protocol list parameter.
+func members(r *http.Request, name string) []string {
+	var values []string
+	for i := 1; ; i++ {
+		v := r.Form.Get(name + ".member." + strconv.Itoa(i))
+		if v == "" {
+			return values
+		}
+		values = append(values, v)
+	}
+}
+
+// paginate returns the page of items selected by the Marker and PageSize
+// parameters, and the marker of the next page.
+func paginate[T any](r *http.Request, items []T) ([]T, string) {
+	start, _ := strconv.Atoi(r.Form.Get("Marker"))
+	size, err := strconv.Atoi(r.Form.Get("PageSize"))
+	if err != nil || size <= 0 {
+		size = defaultPageSize
+	}
+	start = min(max(start, 0), len(items))
+	end := min(start+size, len(items))
+	next := ""
+	if end < len(items) {
+		next = strconv.Itoa(end)
+	}
+	return items[start:end], next
+}
+
+func writeResult(w http.ResponseWriter, action string, result any) {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<%sResponse xmlns=%q>`, action, xmlns)
+	enc := xml.NewEncoder(&b)
+	if err := enc.EncodeElement(result, xml.StartElement{Name: xml.Name{Local: action + "Result"}}); err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalFailure", err.Error())
+		return
+	}
+	fmt.Fprintf(&b, `<ResponseMetadata><RequestId>fake</RequestId></ResponseMetadata></%sResponse>`, action)
+
+	w.Header().Set("Content-Type", "text/xml")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		log.Printf("failed to write fake response: %v", err)
+	}
+}
+
+func writeNotFound(w http.ResponseWriter) {
+	writeError(w, http.StatusBadRequest, "TrustStoreNotFound", "One or more trust stores not found")
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	var escaped strings.Builder
+	if err := xml.EscapeText(&escaped, []byte(message)); err != nil {
+		log.Printf("failed to escape fake error: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	if _, err := fmt.Fprintf(
+		w,
+		`<ErrorResponse xmlns=%q><Error><Type>Sender</Type><Code>%s</Code><Message>%s</Message></Error><RequestId>fake</RequestId></ErrorResponse>`,
+		xmlns,
+		code,
+		escaped.String(),
+	); err != nil {
+		log.Printf("failed to write fake error: %v", err)
+	}
+}
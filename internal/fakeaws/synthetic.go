@@ -0,0 +1,200 @@
+package fakeaws
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// syntheticExpiries are the certificate expiries, relative to the current time,
+// that synthetic certificates cycle through. They cover every expiry severity
+// so dashboards and alerts have something to show however long the demo runs.
+var syntheticExpiries = []time.Duration{
+	5 * 365 * day,
+	400 * day,
+	-10 * day,
+	2 * 365 * day,
+	20 * day,
+	180 * day,
+	3 * day,
+	60 * day,
+}
+
+// keyType is a public key algorithm used for synthetic certificates.
+type keyType struct {
+	name     string
+	generate func() (crypto.Signer, error)
+}
+
+var syntheticKeyTypes = []keyType{
+	{name: "RSA 2048", generate: func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 2048) }},
+	{name: "ECDSA P-256", generate: func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P256(), rand.Reader) }},
+	{name: "RSA 4096", generate: func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 4096) }},
+	{name: "ECDSA P-384", generate: func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P384(), rand.Reader) }},
+	{name: "Ed25519", generate: func() (crypto.Signer, error) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}},
+}
+
+// syntheticOwners are the Owner tags that synthetic trust stores cycle through.
+var syntheticOwners = []string{"platform", "payments", "identity"}
+
+// SyntheticOptions controls the trust stores created by AddSyntheticTrustStores.
+type SyntheticOptions struct {
+	// TrustStores is the number of trust stores to create.
+	TrustStores int
+	// CertificatesPerTrustStore is the number of CA certificates in each
+	// trust store.
+	CertificatesPerTrustStore int
+}
+
+// AddSyntheticTrustStores adds trust stores holding self-signed CA certificates
+// with a mix of key types and expiries ranging from already expired to several
+// years away. Every third trust store has a revocation list issued by its
+// first certificate.
+func (s *Server) AddSyntheticTrustStores(opts SyntheticOptions) error {
+	// Generating keys dominates start up time for large demos, so one key of
+	// each type is shared by all certificates.
+	keys := make([]crypto.Signer, len(syntheticKeyTypes))
+	for i, kt := range syntheticKeyTypes {
+		key, err := kt.generate()
+		if err != nil {
+			return fmt.Errorf("failed to generate %s key: %w", kt.name, err)
+		}
+		keys[i] = key
+	}
+
+	now := time.Now()
+	serial := int64(1)
+	for i := range opts.TrustStores {
+		name := fmt.Sprintf("demo-%03d", i+1)
+		ts := &TrustStore{
+			Name: name,
+			ARN:  TrustStoreARN(name),
+			Tags: map[string]string{
+				"Owner":      syntheticOwners[i%len(syntheticOwners)],
+				"CostCenter": fmt.Sprintf("cc-%d", 1000+i%7),
+			},
+		}
+		// Every trust store is used by a listener, one in five of those
+		// listeners has been switched to passthrough mode, and every other
+		// one advertises the trust store's CA names.
+		loadBalancer := fmt.Sprintf("demo-alb-%03d", i/2+1)
+		mode := "verify"
+		if i%5 == 4 {
+			mode = "passthrough"
+		}
+		ts.Listeners = append(ts.Listeners, Listener{
+			ARN:              ListenerARN(loadBalancer, 443+i%2),
+			LoadBalancerARN:  LoadBalancerARN(loadBalancer),
+			Mode:             mode,
+			AdvertiseCANames: i%2 == 0,
+			HealthyTargets:   2 + i%3,
+			UnhealthyTargets: i % 2,
+		})
+		for j := range opts.CertificatesPerTrustStore {
+			key := keys[(i+j)%len(keys)]
+			expiry := syntheticExpiries[(i*opts.CertificatesPerTrustStore+j)%len(syntheticExpiries)]
+
+			// The last certificate of every fourth trust store is a leaf
+			// certificate uploaded by mistake.
+			isCA := j < opts.CertificatesPerTrustStore-1 || i%4 != 3
+			commonName := fmt.Sprintf("%s CA %d", name, j+1)
+			if !isCA {
+				commonName = fmt.Sprintf("%s leaf %d", name, j+1)
+			}
+			cert, err := selfSigned(key, serial, commonName, now.Add(expiry), isCA)
+			if err != nil {
+				return err
+			}
+			serial++
+			ts.Bundle = append(ts.Bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+			ts.NumberOfCACertificates++
+
+			if j == 0 && i%3 == 0 {
+				revoked := 1 + i%5
+				crl, err := revocationList(cert, key, revoked, now)
+				if err != nil {
+					return err
+				}
+				ts.RevocationLists = append(ts.RevocationLists, RevocationList{Content: crl, RevokedEntries: revoked})
+			}
+		}
+		// Every seventh trust store also holds a corrupt certificate, which
+		// the exporter skips.
+		if i%7 == 6 {
+			ts.Bundle = append(ts.Bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("corrupt")})...)
+			ts.NumberOfCACertificates++
+		}
+		s.AddTrustStore(ts)
+	}
+	return nil
+}
+
+// selfSigned creates a self-signed certificate valid for the year up to
+// notAfter. CA certificates have a critical basicConstraints extension and
+// leaf certificates have none.
+func selfSigned(
+	key crypto.Signer,
+	serial int64,
+	commonName string,
+	notAfter time.Time,
+	isCA bool,
+) (*x509.Certificate, error) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject: pkix.Name{
+			Organization: []string{"Example Demo"},
+			CommonName:   commonName,
+		},
+		NotBefore:             notAfter.Add(-365 * day),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if !isCA {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		template.BasicConstraintsValid = false
+		template.IsCA = false
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate %q: %w", commonName, err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// revocationList creates a DER encoded CRL issued by the CA with the given
+// number of revoked entries.
+func revocationList(issuer *x509.Certificate, key crypto.Signer, entries int, now time.Time) ([]byte, error) {
+	template := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: now.Add(-time.Hour),
+		NextUpdate: now.Add(7 * day),
+	}
+	for i := range entries {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(int64(1000 + i)),
+			RevocationTime: now.Add(-time.Duration(i+1) * day),
+		})
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, template, issuer, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create revocation list for %q: %w", issuer.Subject.CommonName, err)
+	}
+	return crl, nil
+}
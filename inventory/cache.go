@@ -0,0 +1,89 @@
+package inventory
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/authz"
+)
+
+// responseCache keeps the latest encoded response of each variant of an
+// endpoint, such as each format or each token's view of the trust stores, so
+// a response is only encoded again once a new scrape result is published.
+type responseCache struct {
+	mutex   sync.Mutex
+	entries map[string]cachedResponse
+}
+
+type cachedResponse struct {
+	etag string
+	body []byte
+}
+
+// get returns the cached response of variant if it has the given ETag, and
+// otherwise encodes and caches it.
+func (c *responseCache) get(variant, etag string, encode func() ([]byte, error)) ([]byte, error) {
+	c.mutex.Lock()
+	entry, ok := c.entries[variant]
+	c.mutex.Unlock()
+	if ok && entry.etag == etag {
+		return entry.body, nil
+	}
+
+	body, err := encode()
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]cachedResponse)
+	}
+	c.entries[variant] = cachedResponse{etag: etag, body: body}
+	c.mutex.Unlock()
+	return body, nil
+}
+
+// variant returns the variant of a response for the request with the given
+// context: name, which distinguishes the representations an endpoint serves,
+// and the token the request was authorized with, which decides the trust
+// stores it includes.
+func variant(ctx context.Context, name string) string {
+	if p := authz.FromContext(ctx); p != nil {
+		return name + "\x00" + p.Name()
+	}
+	return name
+}
+
+// etag returns the ETag of a variant of the response for a scrape result. The
+// generation numbers the results of a collector and the snapshot time tells
+// apart the results of collectors rebuilt by a reload. The ETag is weak, as
+// signed responses are not byte for byte identical when signed again.
+func etag(generation uint64, at time.Time, variant string) string {
+	h := sha256.New()
+	h.Write(binary.BigEndian.AppendUint64(nil, generation))
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(at.UnixNano())))
+	h.Write([]byte(variant))
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:12]) + `"`
+}
+
+// notModified reports whether the request's If-None-Match header matches the
+// ETag, using weak comparison.
+func notModified(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
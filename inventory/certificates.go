@@ -0,0 +1,151 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/collector"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Certificate is a certificate in a trust store.
+type Certificate struct {
+	TrustStoreARN  string `json:"trust_store_arn"`
+	TrustStoreName string `json:"trust_store_name"`
+	collector.CertificateSnapshot
+}
+
+// Certificates is a page of the response of the certificates API.
+type Certificates struct {
+	Generation uint64    `json:"generation"`
+	Time       time.Time `json:"time"`
+	// Total is the number of certificates matching the filters, on every page.
+	Total        int           `json:"total"`
+	Page         int           `json:"page"`
+	PageSize     int           `json:"page_size"`
+	Certificates []Certificate `json:"certificates"`
+}
+
+// certificateFilter selects certificates by the query parameters of a
+// certificates API request.
+type certificateFilter struct {
+	trustStoreARN  string
+	issuer         string
+	subject        string
+	expiringWithin time.Duration
+	page           int
+	pageSize       int
+}
+
+// parseCertificateFilter parses the query parameters of a certificates API
+// request.
+func parseCertificateFilter(query url.Values) (certificateFilter, error) {
+	f := certificateFilter{
+		trustStoreARN: query.Get("trust_store_arn"),
+		issuer:        strings.ToLower(query.Get("issuer")),
+		subject:       strings.ToLower(query.Get("subject")),
+		page:          1,
+		pageSize:      defaultPageSize,
+	}
+	if v := query.Get("expiring_within"); v != "" {
+		threshold, err := collector.ParseExpiringThreshold(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid expiring_within parameter %q", v)
+		}
+		f.expiringWithin = threshold.Duration
+	}
+	if v := query.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return f, fmt.Errorf("invalid page parameter %q", v)
+		}
+		f.page = n
+	}
+	if v := query.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return f, fmt.Errorf("invalid page_size parameter %q, expected 1 to %d", v, maxPageSize)
+		}
+		f.pageSize = n
+	}
+	return f, nil
+}
+
+// matches reports whether a certificate in the trust store with the given ARN
+// passes the filter, evaluating expiry at the given time.
+func (f certificateFilter) matches(arn string, cert collector.CertificateSnapshot, at time.Time) bool {
+	return (f.trustStoreARN == "" || arn == f.trustStoreARN) &&
+		(f.issuer == "" || strings.Contains(strings.ToLower(cert.Issuer), f.issuer)) &&
+		(f.subject == "" || strings.Contains(strings.ToLower(cert.Subject), f.subject)) &&
+		(f.expiringWithin == 0 || cert.NotAfter.Sub(at) <= f.expiringWithin)
+}
+
+// CertificatesHandler serves the certificates in a Source as JSON, filtered
+// and a page at a time.
+type CertificatesHandler struct {
+	source Source
+}
+
+// NewCertificatesHandler returns a CertificatesHandler serving the
+// certificates in source.
+func NewCertificatesHandler(source Source) *CertificatesHandler {
+	return &CertificatesHandler{source: source}
+}
+
+// ServeHTTP serves a page of the certificates found by the latest scrape, in
+// the trust stores the request is authorized for, that match the filters in
+// the query parameters. Expiry is evaluated at the time of the scrape, so a
+// page only changes with the scrape result and a request whose If-None-Match
+// header matches its ETag gets a 304 Not Modified response.
+func (h *CertificatesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f, err := parseCertificateFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	snapshot, generation, _ := h.source.Result()
+	tag := etag(generation, snapshot.Time, variant(r.Context(), r.URL.RawQuery))
+	w.Header().Set("ETag", tag)
+	if notModified(r, tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	resp := Certificates{
+		Generation:   generation,
+		Time:         snapshot.Time,
+		Page:         f.page,
+		PageSize:     f.pageSize,
+		Certificates: []Certificate{},
+	}
+	first := (f.page - 1) * f.pageSize
+	for _, ts := range allowed(r.Context(), snapshot).TrustStores {
+		for _, cert := range ts.Certificates {
+			if !f.matches(ts.ARN, cert, snapshot.Time) {
+				continue
+			}
+			if resp.Total >= first && len(resp.Certificates) < f.pageSize {
+				resp.Certificates = append(resp.Certificates, Certificate{
+					TrustStoreARN:       ts.ARN,
+					TrustStoreName:      ts.Name,
+					CertificateSnapshot: cert,
+				})
+			}
+			resp.Total++
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("failed to write certificates: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+// Package inventory serves the trust stores and certificates found by the
+// exporter as JSON and CSV, for tools and audits that need them as data rather
+// than as metrics.
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/attestation"
+	"github.com/panubo/elb-trust-store-exporter/authz"
+	"github.com/panubo/elb-trust-store-exporter/collector"
+)
+
+// Source provides the trust stores found by the latest scrape, as returned by
+// collector.Collector.Result.
+type Source interface {
+	Result() (snapshot collector.Snapshot, generation uint64, success bool)
+}
+
+// csvHeader is the header row of a CSV export, which has a row per
+// certificate.
+var csvHeader = []string{
+	"trust_store_arn",
+	"trust_store_name",
+	"bundle_sha256",
+	"serial_number",
+	"fingerprint_sha256",
+	"subject",
+	"issuer",
+	"not_before",
+	"not_after",
+}
+
+// allowed returns the snapshot with only the trust stores the request with
+// the given context is authorized for. The snapshot is shared, so it is
+// copied rather than modified.
+func allowed(ctx context.Context, snapshot collector.Snapshot) collector.Snapshot {
+	if authz.FromContext(ctx) == nil {
+		return snapshot
+	}
+	filtered := collector.Snapshot{Time: snapshot.Time}
+	for _, ts := range snapshot.TrustStores {
+		if authz.Allowed(ctx, ts.ARN) {
+			filtered.TrustStores = append(filtered.TrustStores, ts)
+		}
+	}
+	for _, ts := range snapshot.FailedTrustStores {
+		if authz.Allowed(ctx, ts.ARN) {
+			filtered.FailedTrustStores = append(filtered.FailedTrustStores, ts)
+		}
+	}
+	return filtered
+}
+
+// EncodeJSON returns a snapshot as JSON.
+func EncodeJSON(snapshot collector.Snapshot) ([]byte, error) {
+	return json.Marshal(snapshot)
+}
+
+// EncodeCSV returns a snapshot as CSV, with a row per certificate.
+func EncodeCSV(snapshot collector.Snapshot) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	for _, ts := range snapshot.TrustStores {
+		for _, cert := range ts.Certificates {
+			if err := w.Write([]string{
+				ts.ARN,
+				ts.Name,
+				ts.BundleSHA256,
+				cert.SerialNumber,
+				cert.FingerprintSHA256,
+				cert.Subject,
+				cert.Issuer,
+				cert.NotBefore.UTC().Format(time.RFC3339),
+				cert.NotAfter.UTC().Format(time.RFC3339),
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// ExportHandler serves the trust stores in a Source as a JSON or CSV
+// snapshot, signed if it has a signer.
+type ExportHandler struct {
+	source Source
+	signer attestation.Signer
+	cache  responseCache
+}
+
+// NewExportHandler returns an ExportHandler exporting the trust stores in
+// source. If signer is not nil exports are wrapped in an attestation.Attestation
+// signed with it, so they are tamper-evident once saved.
+func NewExportHandler(source Source, signer attestation.Signer) *ExportHandler {
+	return &ExportHandler{source: source, signer: signer}
+}
+
+// ServeHTTP serves a snapshot of the latest scrape in the format given by the
+// format parameter, json (the default) or csv. Only the trust stores the
+// request is authorized for are exported. The export is cached until the next
+// scrape result, and a request whose If-None-Match header matches it gets a
+// 304 Not Modified response.
+func (h *ExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snapshot, generation, _ := h.source.Result()
+	if generation == 0 {
+		http.Error(w, "no scrape has completed yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	var (
+		encode      func(collector.Snapshot) ([]byte, error)
+		contentType string
+		extension   string
+	)
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		encode, contentType, extension = EncodeJSON, "application/json", "json"
+	case "csv":
+		encode, contentType, extension = EncodeCSV, "text/csv", "csv"
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q, expected json or csv", format), http.StatusBadRequest)
+		return
+	}
+	payloadType := contentType
+	if h.signer != nil {
+		contentType, extension = "application/json", extension+".signed.json"
+	}
+
+	v := variant(r.Context(), extension)
+	tag := etag(generation, snapshot.Time, v)
+	filename := "inventory-" + snapshot.Time.UTC().Format("20060102T150405Z") + "." + extension
+	w.Header().Set("ETag", tag)
+	if notModified(r, tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, err := h.cache.get(v, tag, func() ([]byte, error) {
+		data, err := encode(allowed(r.Context(), snapshot))
+		if err != nil || h.signer == nil {
+			return data, err
+		}
+		a, err := attestation.Sign(r.Context(), h.signer, payloadType, data)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(a)
+	})
+	if err != nil {
+		log.Printf("Error exporting inventory: %v", err)
+		http.Error(w, "failed to export inventory", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if _, err := w.Write(data); err != nil {
+		log.Printf("failed to write inventory export: %v", err)
+	}
+}
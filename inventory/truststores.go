@@ -0,0 +1,75 @@
+package inventory
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/collector"
+)
+
+// TrustStores is the response of the trust stores API.
+type TrustStores struct {
+	// Generation numbers the scrape results of the collector, and is zero
+	// before the first scrape has completed.
+	Generation uint64 `json:"generation"`
+	// Success is whether the scrape collected every trust store.
+	Success     bool                           `json:"success"`
+	Time        time.Time                      `json:"time"`
+	TrustStores []collector.TrustStoreSnapshot `json:"trust_stores"`
+	// FailedTrustStores are the trust stores the scrape failed to collect.
+	FailedTrustStores []collector.FailedTrustStore `json:"failed_trust_stores,omitempty"`
+}
+
+// TrustStoresHandler serves the trust stores in a Source, with their
+// certificates and revocation lists, as JSON.
+type TrustStoresHandler struct {
+	source Source
+	cache  responseCache
+}
+
+// NewTrustStoresHandler returns a TrustStoresHandler serving the trust stores
+// in source.
+func NewTrustStoresHandler(source Source) *TrustStoresHandler {
+	return &TrustStoresHandler{source: source}
+}
+
+// ServeHTTP serves the trust stores found by the latest scrape that the
+// request is authorized for. The response is cached until the next scrape
+// result, and a request whose If-None-Match header matches it gets a 304 Not
+// Modified response.
+func (h *TrustStoresHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snapshot, generation, success := h.source.Result()
+	v := variant(r.Context(), "json")
+	tag := etag(generation, snapshot.Time, v)
+	w.Header().Set("ETag", tag)
+	if notModified(r, tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, err := h.cache.get(v, tag, func() ([]byte, error) {
+		filtered := allowed(r.Context(), snapshot)
+		resp := TrustStores{
+			Generation:        generation,
+			Success:           success,
+			Time:              snapshot.Time,
+			TrustStores:       filtered.TrustStores,
+			FailedTrustStores: filtered.FailedTrustStores,
+		}
+		if resp.TrustStores == nil {
+			resp.TrustStores = []collector.TrustStoreSnapshot{}
+		}
+		return json.Marshal(resp)
+	})
+	if err != nil {
+		log.Printf("Error encoding trust stores: %v", err)
+		http.Error(w, "failed to encode trust stores", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		log.Printf("failed to write trust stores: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// dynamoDBLock is an item of a DynamoDB table with the string partition key
+// lock_id, holding the holder and the time the lock expires in milliseconds
+// since the epoch. Conditional writes ensure only one holder at a time, and
+// the expiry relies on the clocks of the replicas being synchronized.
+type dynamoDBLock struct {
+	client *dynamodb.Client
+	table  string
+	id     string
+}
+
+func (l *dynamoDBLock) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	_, err := l.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(l.table),
+		Item: map[string]types.AttributeValue{
+			"lock_id": &types.AttributeValueMemberS{Value: l.id},
+			"holder":  &types.AttributeValueMemberS{Value: holder},
+			"expires": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(ttl).UnixMilli(), 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(lock_id) OR holder = :holder OR expires < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":holder": &types.AttributeValueMemberS{Value: holder},
+			":now":    &types.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixMilli(), 10)},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (l *dynamoDBLock) Release(ctx context.Context, holder string) error {
+	_, err := l.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(l.table),
+		Key: map[string]types.AttributeValue{
+			"lock_id": &types.AttributeValueMemberS{Value: l.id},
+		},
+		ConditionExpression: aws.String("holder = :holder"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":holder": &types.AttributeValueMemberS{Value: holder},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return nil
+	}
+	return err
+}
+
+func (l *dynamoDBLock) String() string {
+	return "dynamodb://" + l.table + "/" + l.id
+}
@@ -0,0 +1,142 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/kube"
+)
+
+// microTimeFormat is the format of Kubernetes MicroTime fields.
+const microTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// lease is the subset of a coordination.k8s.io/v1 Lease that is used.
+type lease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+	} `json:"spec"`
+}
+
+// leaseLock is a Kubernetes Lease, accessed with the credentials of the pod's
+// service account. Like the Kubernetes client's leader election, it treats
+// the lease as expired once it has not changed for its duration by the local
+// clock, so it does not depend on the clocks of other replicas.
+type leaseLock struct {
+	client    *kube.Client
+	path      string
+	namespace string
+	name      string
+
+	// observed is the resource version of the lease last read, and
+	// observedAt when it was first read.
+	observed   string
+	observedAt time.Time
+}
+
+func newLeaseLock(namespace, name string) (*leaseLock, error) {
+	client, err := kube.InCluster()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client for leader election: %w", err)
+	}
+	if namespace == "" {
+		namespace = client.Namespace
+	}
+	return &leaseLock{
+		client:    client,
+		path:      "/apis/coordination.k8s.io/v1/namespaces/" + namespace + "/leases",
+		namespace: namespace,
+		name:      name,
+	}, nil
+}
+
+func (l *leaseLock) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	current, err := l.get(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if current == nil {
+		current = &lease{APIVersion: "coordination.k8s.io/v1", Kind: "Lease"}
+		current.Metadata.Name = l.name
+		current.Metadata.Namespace = l.namespace
+	} else {
+		if current.Metadata.ResourceVersion != l.observed {
+			l.observed, l.observedAt = current.Metadata.ResourceVersion, now
+		}
+		duration := time.Duration(current.Spec.LeaseDurationSeconds) * time.Second
+		if current.Spec.HolderIdentity != "" && current.Spec.HolderIdentity != holder && now.Before(l.observedAt.Add(duration)) {
+			return false, nil
+		}
+	}
+
+	if current.Spec.HolderIdentity != holder {
+		current.Spec.HolderIdentity = holder
+		current.Spec.AcquireTime = now.UTC().Format(microTimeFormat)
+		if current.Metadata.ResourceVersion != "" {
+			current.Spec.LeaseTransitions++
+		}
+	}
+	current.Spec.LeaseDurationSeconds = max(int(ttl.Round(time.Second)/time.Second), 1)
+	current.Spec.RenewTime = now.UTC().Format(microTimeFormat)
+
+	var status int
+	if current.Metadata.ResourceVersion == "" {
+		status, err = l.client.Do(ctx, http.MethodPost, l.path, current, current)
+	} else {
+		status, err = l.client.Do(ctx, http.MethodPut, l.path+"/"+l.name, current, current)
+	}
+	if status == http.StatusConflict {
+		// Another replica created or updated the lease first.
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	l.observed, l.observedAt = current.Metadata.ResourceVersion, now
+	return true, nil
+}
+
+func (l *leaseLock) Release(ctx context.Context, holder string) error {
+	current, err := l.get(ctx)
+	if err != nil || current == nil || current.Spec.HolderIdentity != holder {
+		return err
+	}
+	// An empty holder with a one second duration lets another replica take
+	// the lease straight away.
+	current.Spec.HolderIdentity = ""
+	current.Spec.LeaseDurationSeconds = 1
+	current.Spec.RenewTime = time.Now().UTC().Format(microTimeFormat)
+	_, err = l.client.Do(ctx, http.MethodPut, l.path+"/"+l.name, current, nil)
+	return err
+}
+
+func (l *leaseLock) String() string {
+	return "kubernetes://" + l.namespace + "/" + l.name
+}
+
+// get returns the lease, or nil if it does not exist.
+func (l *leaseLock) get(ctx context.Context) (*lease, error) {
+	current := &lease{}
+	status, err := l.client.Do(ctx, http.MethodGet, l.path+"/"+l.name, nil, current)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return current, nil
+}
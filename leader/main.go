@@ -0,0 +1,186 @@
+// Package leader elects one of several exporter replicas as the leader that
+// queries the AWS API, by holding a lock with a time to live that the leader
+// renews. Standby replicas take the lock over once the leader stops renewing
+// it.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/panubo/elb-trust-store-exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Lock is a lock held by one holder at a time for a time to live.
+type Lock interface {
+	// Acquire acquires the lock for holder for ttl, or renews it if holder
+	// already holds it, and reports whether holder holds it.
+	Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error)
+	// Release releases the lock if holder holds it.
+	Release(ctx context.Context, holder string) error
+	// String describes the lock.
+	String() string
+}
+
+// NewLock returns the lock for a location, one of
+// kubernetes://[namespace/]lease for a Kubernetes Lease, in the namespace of
+// the pod's service account by default, or dynamodb://table/lock for an item
+// of a DynamoDB table with the string partition key lock_id.
+func NewLock(location string, cfg aws.Config) (Lock, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid leader election lock %q: %w", location, err)
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch u.Scheme {
+	case "kubernetes":
+		switch {
+		case u.Host != "" && u.Path == "":
+			return newLeaseLock("", u.Host)
+		case u.Host != "" && len(parts) == 1 && parts[0] != "":
+			return newLeaseLock(u.Host, parts[0])
+		}
+		return nil, fmt.Errorf("invalid Kubernetes leader election lock %q", location)
+	case "dynamodb":
+		if u.Host == "" || len(parts) != 1 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid DynamoDB leader election lock %q", location)
+		}
+		return &dynamoDBLock{client: dynamodb.NewFromConfig(cfg), table: u.Host, id: parts[0]}, nil
+	default:
+		return nil, fmt.Errorf("unsupported leader election lock scheme %q", u.Scheme)
+	}
+}
+
+// Elector holds a Lock while it can, renewing it every third of its time to
+// live. It steps down if it cannot renew the lock within two thirds of the
+// time to live, before another replica can take it over.
+type Elector struct {
+	lock     Lock
+	identity string
+	ttl      time.Duration
+	onChange func(leader bool)
+
+	leader    atomic.Bool
+	renewed   time.Time
+	isLeader  prometheus.Gauge
+	elections prometheus.Counter
+}
+
+// NewElector returns an Elector of identity for lock. onChange is called
+// whenever the elector becomes the leader or steps down, except by Acquire.
+func NewElector(lock Lock, identity string, ttl time.Duration, onChange func(leader bool)) *Elector {
+	return &Elector{
+		lock:     lock,
+		identity: identity,
+		ttl:      ttl,
+		onChange: onChange,
+		isLeader: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: collector.Namespace,
+			Subsystem: "exporter",
+			Name:      "leader",
+			Help:      "Whether this replica is the leader that queries the AWS API.",
+		}),
+		elections: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: collector.Namespace,
+			Subsystem: "exporter",
+			Name:      "leader_elections_total",
+			Help:      "The number of times this replica became the leader.",
+		}),
+	}
+}
+
+// IsLeader reports whether the elector holds the lock.
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Acquire makes a first attempt to acquire the lock, so a replica knows
+// whether it is the leader before it first queries the AWS API.
+func (e *Elector) Acquire(ctx context.Context) {
+	e.try(ctx)
+}
+
+// Run renews or attempts to acquire the lock until ctx is done, and then
+// releases it if held.
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if changed := e.try(ctx); changed && e.onChange != nil {
+				e.onChange(e.IsLeader())
+			}
+		case <-ctx.Done():
+			if e.IsLeader() {
+				releaseCtx, cancel := context.WithTimeout(context.Background(), e.ttl/3)
+				if err := e.lock.Release(releaseCtx, e.identity); err != nil {
+					log.Printf("Error releasing leader election lock %s: %v", e.lock, err)
+				}
+				cancel()
+				e.set(false)
+			}
+			return
+		}
+	}
+}
+
+// try attempts to acquire or renew the lock and reports whether leadership
+// changed.
+func (e *Elector) try(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, e.ttl/3)
+	defer cancel()
+
+	now := time.Now()
+	held, err := e.lock.Acquire(ctx, e.identity, e.ttl)
+	if err != nil {
+		log.Printf("Error acquiring leader election lock %s: %v", e.lock, err)
+		// The lock may still be held until it expires, but stepping down
+		// before then ensures two replicas never both act as leader.
+		held = e.IsLeader() && now.Sub(e.renewed) < e.ttl*2/3
+	} else if held {
+		e.renewed = now
+	}
+	if held == e.IsLeader() {
+		return false
+	}
+	if held {
+		log.Printf("Became the leader as %s with lock %s", e.identity, e.lock)
+		e.elections.Inc()
+	} else {
+		log.Printf("Stepped down as the leader with lock %s", e.lock)
+	}
+	e.set(held)
+	return true
+}
+
+func (e *Elector) set(leader bool) {
+	e.leader.Store(leader)
+	if leader {
+		e.isLeader.Set(1)
+	} else {
+		e.isLeader.Set(0)
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (e *Elector) Describe(ch chan<- *prometheus.Desc) {
+	e.isLeader.Describe(ch)
+	e.elections.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (e *Elector) Collect(ch chan<- prometheus.Metric) {
+	e.isLeader.Collect(ch)
+	e.elections.Collect(ch)
+}
@@ -0,0 +1,125 @@
+// Package maintenance evaluates maintenance windows, planned periods such as
+// CA rotations during which change notifications and policy metrics for the
+// affected trust stores are silenced.
+package maintenance
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// maxDuration bounds the length of a recurring window.
+const maxDuration = 7 * 24 * time.Hour
+
+// Config configures a maintenance window. A window is either an explicit
+// range from Start to End, or recurs at every time matching the cron-like
+// Schedule for Duration. A window applies to the trust stores listed in
+// TrustStoreARNs, or to every trust store and the exporter's own events if
+// none are listed.
+type Config struct {
+	Name           string   `yaml:"name"`
+	Start          string   `yaml:"start"`
+	End            string   `yaml:"end"`
+	Schedule       string   `yaml:"schedule"`
+	Duration       string   `yaml:"duration"`
+	Timezone       string   `yaml:"timezone"`
+	TrustStoreARNs []string `yaml:"trust_store_arns"`
+}
+
+// Window is a parsed maintenance window.
+type Window struct {
+	name           string
+	start          time.Time
+	end            time.Time
+	schedule       *schedule
+	duration       time.Duration
+	location       *time.Location
+	trustStoreARNs []string
+}
+
+// New parses a maintenance window configuration.
+func New(cfg Config) (*Window, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("maintenance window has no name")
+	}
+	w := &Window{
+		name:           cfg.Name,
+		location:       time.UTC,
+		trustStoreARNs: cfg.TrustStoreARNs,
+	}
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("maintenance window %q has invalid timezone: %w", cfg.Name, err)
+		}
+		w.location = loc
+	}
+
+	switch {
+	case cfg.Schedule != "" && (cfg.Start != "" || cfg.End != ""):
+		return nil, fmt.Errorf("maintenance window %q must have either a schedule or a start and end, not both", cfg.Name)
+	case cfg.Schedule != "":
+		s, err := parseSchedule(cfg.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("maintenance window %q has invalid schedule: %w", cfg.Name, err)
+		}
+		d, err := time.ParseDuration(cfg.Duration)
+		if err != nil || d <= 0 || d > maxDuration {
+			return nil, fmt.Errorf("maintenance window %q must have a positive duration of at most %s", cfg.Name, maxDuration)
+		}
+		w.schedule, w.duration = s, d
+	case cfg.Start != "" && cfg.End != "":
+		if cfg.Duration != "" {
+			return nil, fmt.Errorf("maintenance window %q takes a duration only with a schedule", cfg.Name)
+		}
+		var err error
+		if w.start, err = time.Parse(time.RFC3339, cfg.Start); err != nil {
+			return nil, fmt.Errorf("maintenance window %q has invalid start: %w", cfg.Name, err)
+		}
+		if w.end, err = time.Parse(time.RFC3339, cfg.End); err != nil {
+			return nil, fmt.Errorf("maintenance window %q has invalid end: %w", cfg.Name, err)
+		}
+		if !w.end.After(w.start) {
+			return nil, fmt.Errorf("maintenance window %q ends before it starts", cfg.Name)
+		}
+	default:
+		return nil, fmt.Errorf("maintenance window %q must have a schedule or a start and end", cfg.Name)
+	}
+	return w, nil
+}
+
+// Name returns the name of the window.
+func (w *Window) Name() string {
+	return w.name
+}
+
+// Active reports whether the window is open at the given time.
+func (w *Window) Active(at time.Time) bool {
+	if w.schedule == nil {
+		return !at.Before(w.start) && at.Before(w.end)
+	}
+
+	// The window is open if it last started within the duration before at.
+	start, ok := w.schedule.prev(at.In(w.location), at.Add(-w.duration))
+	return ok && start.Add(w.duration).After(at)
+}
+
+// Covers reports whether the window applies to a trust store. An empty ARN
+// stands for events that do not concern a single trust store, which are only
+// covered by windows that apply to every trust store.
+func (w *Window) Covers(trustStoreARN string) bool {
+	return len(w.trustStoreARNs) == 0 || slices.Contains(w.trustStoreARNs, trustStoreARN)
+}
+
+// Silenced reports whether any of the windows covering the trust store is
+// active at the given time.
+func Silenced(windows []*Window, trustStoreARN string, at time.Time) bool {
+	for _, w := range windows {
+		if w.Covers(trustStoreARN) && w.Active(at) {
+			return true
+		}
+	}
+	return false
+}
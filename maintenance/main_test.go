@@ -0,0 +1,108 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowActive(t *testing.T) {
+	for _, tc := range []struct {
+		schedule string
+		duration string
+		timezone string
+		at       string
+		want     bool
+	}{
+		// Names of days and months.
+		{"0 2 * * sat", "1h", "", "2024-06-01T02:30:00Z", true},
+		{"0 2 * * sat", "1h", "", "2024-06-02T02:30:00Z", false},
+		{"0 0 1 jan *", "24h", "", "2025-01-01T12:00:00Z", true},
+		{"0 0 1 jan *", "24h", "", "2025-02-01T12:00:00Z", false},
+		// Ranges and steps.
+		{"*/15 9-17 * * mon-fri", "5m", "", "2024-06-03T09:47:00Z", true},
+		{"*/15 9-17 * * mon-fri", "5m", "", "2024-06-03T09:52:00Z", false},
+		{"*/15 9-17 * * mon-fri", "5m", "", "2024-06-03T18:02:00Z", false},
+		{"*/15 9-17 * * mon-fri", "5m", "", "2024-06-08T09:47:00Z", false},
+		{"0 1-5/2 * * *", "30m", "", "2024-06-03T03:10:00Z", true},
+		{"0 1-5/2 * * *", "30m", "", "2024-06-03T02:10:00Z", false},
+		// Sunday is 7 as well as 0.
+		{"0 3 * * 7", "1h", "", "2024-06-02T03:30:00Z", true},
+		{"0 3 * * 7", "1h", "", "2024-06-03T03:30:00Z", false},
+		// With both day fields restricted, either matches.
+		{"0 0 13 * fri", "1h", "", "2024-06-13T00:30:00Z", true},
+		{"0 0 13 * fri", "1h", "", "2024-06-14T00:30:00Z", true},
+		{"0 0 13 * fri", "1h", "", "2024-06-12T00:30:00Z", false},
+		// With a day field starting with "*", both must match.
+		{"0 2 */2 * sat", "1h", "", "2024-06-01T02:30:00Z", true},
+		{"0 2 */2 * sat", "1h", "", "2024-06-08T02:30:00Z", false},
+		{"0 2 */2 * sat", "1h", "", "2024-06-03T02:30:00Z", false},
+		// Windows spanning midnight.
+		{"0 23 * * *", "2h", "", "2024-06-02T00:30:00Z", true},
+		{"0 23 * * *", "2h", "", "2024-06-02T01:00:00Z", false},
+		{"0 23 * * *", "2h", "", "2024-06-01T22:59:00Z", false},
+		{"0 23 * * fri", "3h", "", "2024-06-01T01:30:00Z", true},
+		// The time zone of the schedule.
+		{"0 9 * * *", "1h", "Australia/Sydney", "2024-06-03T23:30:00Z", true},
+		{"0 9 * * *", "1h", "Australia/Sydney", "2024-06-03T09:30:00Z", false},
+		// 01:30 is skipped on the spring-forward day in London.
+		{"30 1 * * *", "1h", "Europe/London", "2024-03-30T01:45:00Z", true},
+		{"30 1 * * *", "1h", "Europe/London", "2024-03-31T02:15:00+01:00", false},
+		// A window lasts its duration across the transition.
+		{"0 0 * * *", "3h", "Europe/London", "2024-03-31T03:30:00+01:00", true},
+		{"0 0 * * *", "3h", "Europe/London", "2024-03-31T04:00:00+01:00", false},
+		// 01:50 occurs twice on the fall-back day in London.
+		{"50 1 * * *", "15m", "Europe/London", "2024-10-27T01:55:00+01:00", true},
+		{"50 1 * * *", "15m", "Europe/London", "2024-10-27T01:55:00+00:00", true},
+		{"50 1 * * *", "15m", "Europe/London", "2024-10-27T01:20:00+00:00", false},
+	} {
+		w, err := New(Config{Name: "test", Schedule: tc.schedule, Duration: tc.duration, Timezone: tc.timezone})
+		if err != nil {
+			t.Fatalf("New(%q): %v", tc.schedule, err)
+		}
+		at, err := time.Parse(time.RFC3339, tc.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := w.Active(at); got != tc.want {
+			t.Errorf("%q for %s in %q: Active(%s) = %v, want %v", tc.schedule, tc.duration, tc.timezone, tc.at, got, tc.want)
+		}
+	}
+}
+
+func TestWindowActiveRange(t *testing.T) {
+	w, err := New(Config{Name: "test", Start: "2024-06-01T00:00:00Z", End: "2024-06-02T00:00:00Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for at, want := range map[string]bool{
+		"2024-05-31T23:59:59Z": false,
+		"2024-06-01T00:00:00Z": true,
+		"2024-06-01T23:59:59Z": true,
+		"2024-06-02T00:00:00Z": false,
+	} {
+		parsed, _ := time.Parse(time.RFC3339, at)
+		if got := w.Active(parsed); got != want {
+			t.Errorf("Active(%s) = %v, want %v", at, got, want)
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, cfg := range []Config{
+		{Schedule: "0 2 * * *", Duration: "1h"},
+		{Name: "test", Schedule: "0 2 * *", Duration: "1h"},
+		{Name: "test", Schedule: "60 2 * * *", Duration: "1h"},
+		{Name: "test", Schedule: "0 2 * * sunday", Duration: "1h"},
+		{Name: "test", Schedule: "0 5-2 * * *", Duration: "1h"},
+		{Name: "test", Schedule: "*/0 2 * * *", Duration: "1h"},
+		{Name: "test", Schedule: "0 2 * * *", Duration: "192h"},
+		{Name: "test", Schedule: "0 2 * * *"},
+		{Name: "test", Schedule: "0 2 * * *", Duration: "1h", Timezone: "Nowhere/Special"},
+		{Name: "test", Start: "2024-06-02T00:00:00Z", End: "2024-06-01T00:00:00Z"},
+		{Name: "test", Start: "2024-06-01T00:00:00Z", End: "2024-06-02T00:00:00Z", Schedule: "0 2 * * *"},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) returned no error", cfg)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package maintenance
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule is a parsed cron expression of five fields: minute, hour, day of
+// month, month and day of week.
+type schedule struct {
+	minutes     []bool
+	hours       []bool
+	daysOfMonth []bool
+	months      []bool
+	daysOfWeek  []bool
+	// domStar and dowStar are set when the day fields start with "*". As
+	// with cron, a day matches if either day field does when both fields
+	// are restricted, and if both do otherwise.
+	domStar bool
+	dowStar bool
+}
+
+// parseSchedule parses a cron expression such as "0 2 * * sat". Each field
+// is "*" or a comma-separated list of values and ranges, each optionally with
+// a "/step". Months and days of the week may also be given by their
+// three-letter English names, and Sunday is 0 or 7.
+func parseSchedule(expr string) (*schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+
+	s := &schedule{
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+	var err error
+	if s.minutes, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if s.hours, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if s.daysOfMonth, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if s.months, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if s.daysOfWeek, err = parseField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	if s.daysOfWeek[7] {
+		s.daysOfWeek[0] = true
+	}
+	return s, nil
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// parseField returns the set of values from lo to hi matched by a field.
+func parseField(field string, lo, hi int, names map[string]int) ([]bool, error) {
+	set := make([]bool, hi+1)
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rng = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		first, last := lo, hi
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if first, err = parseValue(bounds[0], lo, hi, names); err != nil {
+				return nil, err
+			}
+			last = first
+			if len(bounds) == 2 {
+				if last, err = parseValue(bounds[1], lo, hi, names); err != nil {
+					return nil, err
+				}
+			} else if step > 1 {
+				last = hi
+			}
+			if last < first {
+				return nil, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+		for v := first; v <= last; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+func parseValue(s string, lo, hi int, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < lo || v > hi {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// prev returns the latest minute at or before t, in t's location, at which
+// the schedule fires, looking back to the day of earliest at most. It returns
+// false if the schedule does not fire in that time.
+func (s *schedule) prev(t, earliest time.Time) (time.Time, bool) {
+	loc := t.Location()
+	// Days are stepped at noon, which exists whatever the daylight saving
+	// transitions of the location.
+	noon := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 12, 0, 0, 0, loc)
+	}
+	lastHour, lastMinute := t.Hour(), t.Minute()
+	for day := noon(t); !day.Before(noon(earliest.In(loc))); day = day.AddDate(0, 0, -1) {
+		// The offsets from UTC at the start and end of the day differ on the
+		// day of a daylight saving transition, when a wall clock time may
+		// not occur or occur twice and the order of wall clock times is not
+		// that of the times, so the whole day is searched for the latest.
+		_, first := day.Add(-12 * time.Hour).Zone()
+		_, last := day.Add(12 * time.Hour).Zone()
+		transition := first != last
+		if transition {
+			lastHour, lastMinute = 23, 59
+		}
+		if s.matchesDay(day) {
+			var (
+				latest time.Time
+				found  bool
+			)
+			for hour := lastHour; hour >= 0; hour-- {
+				if !s.hours[hour] {
+					continue
+				}
+				minute := 59
+				if hour == lastHour {
+					minute = lastMinute
+				}
+				for ; minute >= 0; minute-- {
+					if !s.minutes[minute] {
+						continue
+					}
+					start, ok := latestOccurrence(day, hour, minute, []int{first, last}, t)
+					if !ok {
+						continue
+					}
+					if !transition {
+						return start, true
+					}
+					if !found || start.After(latest) {
+						latest, found = start, true
+					}
+				}
+			}
+			if found {
+				return latest, true
+			}
+		}
+		lastHour, lastMinute = 23, 59
+	}
+	return time.Time{}, false
+}
+
+// latestOccurrence returns the latest time at or before t at which the wall
+// clock of day's location shows hour and minute on day, given the offsets
+// from UTC in effect on day. It returns false if there is none, as when a
+// daylight saving transition skips the time.
+func latestOccurrence(day time.Time, hour, minute int, offsets []int, t time.Time) (time.Time, bool) {
+	wall := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, time.UTC)
+	var (
+		latest time.Time
+		found  bool
+	)
+	for _, offset := range offsets {
+		start := wall.Add(-time.Duration(offset) * time.Second).In(day.Location())
+		if start.Day() != day.Day() || start.Hour() != hour || start.Minute() != minute || start.After(t) {
+			continue
+		}
+		if !found || start.After(latest) {
+			latest, found = start, true
+		}
+	}
+	return latest, found
+}
+
+// matchesDay reports whether the schedule fires on the day of t, in t's
+// location.
+func (s *schedule) matchesDay(t time.Time) bool {
+	if !s.months[t.Month()] {
+		return false
+	}
+	dom, dow := s.daysOfMonth[t.Day()], s.daysOfWeek[t.Weekday()]
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
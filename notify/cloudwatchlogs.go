@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/panubo/elb-trust-store-exporter/events"
+)
+
+func init() {
+	Register("cloudwatch_logs", newCloudWatchLogsNotifier)
+}
+
+// cloudWatchLogsNotifier writes events as JSON log events to a CloudWatch Logs
+// log stream, creating the stream if it does not exist. The log group must
+// already exist.
+type cloudWatchLogsNotifier struct {
+	client        *cloudwatchlogs.Client
+	logGroup      string
+	logStream     string
+	streamCreated bool
+}
+
+func newCloudWatchLogsNotifier(settings map[string]string, awsConfig AWSConfigFunc) (Notifier, error) {
+	n := &cloudWatchLogsNotifier{
+		logGroup:  settings["log_group"],
+		logStream: settings["log_stream"],
+	}
+	if n.logGroup == "" {
+		return nil, errors.New("the cloudwatch_logs notifier requires a log_group")
+	}
+	if n.logStream == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get hostname for log_stream: %w", err)
+		}
+		n.logStream = hostname
+	}
+
+	var region string
+	for key, value := range settings {
+		switch key {
+		case "log_group", "log_stream":
+		case "region":
+			region = value
+		default:
+			return nil, fmt.Errorf("the cloudwatch_logs notifier has no setting %q", key)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	cfg, err := awsConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if region != "" {
+		cfg.Region = region
+	}
+	n.client = cloudwatchlogs.NewFromConfig(cfg)
+	return n, nil
+}
+
+func (n *cloudWatchLogsNotifier) Notify(ctx context.Context, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if !n.streamCreated {
+		_, err := n.client.CreateLogStream(ctx, &cloudwatchlogs.CreateLogStreamInput{
+			LogGroupName:  aws.String(n.logGroup),
+			LogStreamName: aws.String(n.logStream),
+		})
+		var exists *types.ResourceAlreadyExistsException
+		if err != nil && !errors.As(err, &exists) {
+			return fmt.Errorf("failed to create log stream: %w", err)
+		}
+		n.streamCreated = true
+	}
+
+	_, err = n.client.PutLogEvents(ctx, &cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(n.logGroup),
+		LogStreamName: aws.String(n.logStream),
+		LogEvents: []types.InputLogEvent{
+			{
+				Message:   aws.String(string(data)),
+				Timestamp: aws.Int64(e.Time.UnixMilli()),
+			},
+		},
+	})
+	return err
+}
@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/panubo/elb-trust-store-exporter/events"
+)
+
+// defaultRateLimitPeriod is the period rate_limit applies to when
+// rate_limit_period is not set.
+const defaultRateLimitPeriod = time.Minute
+
+// Reasons for the limiter to drop an event.
+const (
+	dropNone = iota
+	dropDuplicate
+	dropRateLimited
+)
+
+// limiter decides which events a notifier delivers. It drops repeats of an
+// event within the repeat interval and events beyond the rate limit. It is
+// only used by the notifier's delivery goroutine.
+type limiter struct {
+	rateLimit      int
+	period         time.Duration
+	repeatInterval time.Duration
+
+	// sent holds the delivery times within the last period, oldest first.
+	sent []time.Time
+	// lastSent holds the last delivery time of each event key within the
+	// repeat interval.
+	lastSent map[string]time.Time
+	// limited is set while events are dropped by the rate limit, so the drop
+	// is logged once rather than for every event.
+	limited bool
+}
+
+func newLimiter(nc NotifierConfig) (*limiter, error) {
+	l := &limiter{
+		rateLimit: nc.RateLimit,
+		period:    defaultRateLimitPeriod,
+		lastSent:  make(map[string]time.Time),
+	}
+	if nc.RateLimit < 0 {
+		return nil, errors.New("rate_limit must not be negative")
+	}
+	if nc.RateLimitPeriod != "" {
+		period, err := time.ParseDuration(nc.RateLimitPeriod)
+		if err != nil || period <= 0 {
+			return nil, fmt.Errorf("invalid rate_limit_period %q", nc.RateLimitPeriod)
+		}
+		l.period = period
+	}
+	if nc.RepeatInterval != "" {
+		interval, err := time.ParseDuration(nc.RepeatInterval)
+		if err != nil || interval < 0 {
+			return nil, fmt.Errorf("invalid repeat_interval %q", nc.RepeatInterval)
+		}
+		l.repeatInterval = interval
+	}
+	return l, nil
+}
+
+// eventDiscriminators are the event data fields that tell apart events of the
+// same type for the same trust store: the rule of rule events, the anomaly of
+// bundle anomalies, the certificate of removed certificates and the new bundle
+// of bundle changes.
+var eventDiscriminators = []string{"rule", "anomaly", "fingerprint_sha256", "bundle_sha256"}
+
+// eventKey identifies repeats of the same event: the same type and severity
+// for the same trust store and the same discriminating data, if any.
+func eventKey(e events.Event) string {
+	key := e.Type + "\x00" + e.Severity + "\x00" + e.TrustStoreARN
+	for _, field := range eventDiscriminators {
+		value, _ := e.Data[field].(string)
+		key += "\x00" + value
+	}
+	return key
+}
+
+// allow returns why the event should be dropped at now, or dropNone if it
+// should be delivered. Delivered events are recorded against the limits.
+func (l *limiter) allow(e events.Event, now time.Time) int {
+	key := eventKey(e)
+	if l.repeatInterval > 0 {
+		for k, t := range l.lastSent {
+			if now.Sub(t) >= l.repeatInterval {
+				delete(l.lastSent, k)
+			}
+		}
+		if _, ok := l.lastSent[key]; ok {
+			return dropDuplicate
+		}
+	}
+
+	if l.rateLimit > 0 {
+		i := 0
+		for i < len(l.sent) && now.Sub(l.sent[i]) >= l.period {
+			i++
+		}
+		l.sent = l.sent[i:]
+		if len(l.sent) >= l.rateLimit {
+			return dropRateLimited
+		}
+		l.sent = append(l.sent, now)
+	}
+
+	if l.repeatInterval > 0 {
+		l.lastSent[key] = now
+	}
+	return dropNone
+}
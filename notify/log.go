@@ -0,0 +1,33 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/panubo/elb-trust-store-exporter/events"
+)
+
+func init() {
+	Register("log", newLogNotifier)
+}
+
+// logNotifier writes events to the exporter's log. It takes no settings.
+type logNotifier struct{}
+
+func newLogNotifier(settings map[string]string, _ AWSConfigFunc) (Notifier, error) {
+	if len(settings) > 0 {
+		return nil, errors.New("the log notifier takes no settings")
+	}
+	return logNotifier{}, nil
+}
+
+func (logNotifier) Notify(_ context.Context, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	log.Printf("Event: %s", data)
+	return nil
+}
@@ -0,0 +1,237 @@
+// Package notify delivers exporter events to notification sinks. Sinks
+// implement Notifier and register a factory for their type, and a YAML
+// configuration routes events to them by type and severity.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/panubo/elb-trust-store-exporter/events"
+	"go.yaml.in/yaml/v2"
+)
+
+// notifyTimeout bounds the time a notifier has to deliver a single event.
+const notifyTimeout = 30 * time.Second
+
+// queueSize is the number of events buffered per notifier before further
+// events are dropped for it.
+const queueSize = 64
+
+// Notifier delivers events to a notification sink.
+type Notifier interface {
+	Notify(ctx context.Context, e events.Event) error
+}
+
+// AWSConfigFunc loads the AWS configuration of the exporter, for notifiers
+// that call AWS APIs to use the same credentials and endpoints as the
+// collector.
+type AWSConfigFunc func(ctx context.Context) (aws.Config, error)
+
+// Factory creates a notifier from the settings in its configuration.
+type Factory func(settings map[string]string, awsConfig AWSConfigFunc) (Notifier, error)
+
+var (
+	factoriesMutex sync.Mutex
+	factories      = map[string]Factory{}
+)
+
+// Register makes a notifier type available to the configuration. It is
+// intended to be called from the init function of the package implementing
+// the notifier.
+func Register(typ string, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+	if _, ok := factories[typ]; ok {
+		panic("notify: notifier type registered twice: " + typ)
+	}
+	factories[typ] = factory
+}
+
+// Types returns the registered notifier types.
+func Types() []string {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+	types := make([]string, 0, len(factories))
+	for typ := range factories {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Config is the notification configuration read from a YAML file.
+type Config struct {
+	Notifiers []NotifierConfig `yaml:"notifiers"`
+	Routes    []Route          `yaml:"routes"`
+}
+
+// NotifierConfig configures a named notifier. RateLimit caps the events
+// delivered per RateLimitPeriod, and an event is not delivered again within
+// RepeatInterval of the last delivery of the same event. Settings other than
+// these are passed to the notifier type's factory.
+type NotifierConfig struct {
+	Name            string            `yaml:"name"`
+	Type            string            `yaml:"type"`
+	RateLimit       int               `yaml:"rate_limit"`
+	RateLimitPeriod string            `yaml:"rate_limit_period"`
+	RepeatInterval  string            `yaml:"repeat_interval"`
+	Settings        map[string]string `yaml:",inline"`
+}
+
+// Route sends events to a notifier. An event matches a route if its type is
+// one of Events, or Events is empty, and its severity is at least
+// MinSeverity.
+type Route struct {
+	Notifier    string   `yaml:"notifier"`
+	Events      []string `yaml:"events"`
+	MinSeverity string   `yaml:"min_severity"`
+}
+
+func (r Route) matches(e events.Event) bool {
+	return (len(r.Events) == 0 || slices.Contains(r.Events, e.Type)) && e.AtLeast(r.MinSeverity)
+}
+
+// LoadConfig reads a notification configuration file, rejecting unknown
+// settings.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Router delivers events to the notifiers of every route they match. Each
+// notifier delivers its events in order from its own queue, so a slow sink
+// does not delay the others.
+type Router struct {
+	routes   []Route
+	queues   map[string]chan events.Event
+	limiters map[string]*limiter
+	wg       sync.WaitGroup
+}
+
+// NewRouter creates the configured notifiers and validates the routes.
+// awsConfig is only called by notifiers that need the AWS configuration.
+func NewRouter(cfg *Config, awsConfig AWSConfigFunc) (*Router, error) {
+	r := &Router{
+		routes:   cfg.Routes,
+		queues:   make(map[string]chan events.Event),
+		limiters: make(map[string]*limiter),
+	}
+
+	notifiers := make(map[string]Notifier, len(cfg.Notifiers))
+	for _, nc := range cfg.Notifiers {
+		if nc.Name == "" {
+			return nil, fmt.Errorf("notifier of type %q has no name", nc.Type)
+		}
+		if _, ok := notifiers[nc.Name]; ok {
+			return nil, fmt.Errorf("notifier %q is defined twice", nc.Name)
+		}
+		factoriesMutex.Lock()
+		factory, ok := factories[nc.Type]
+		factoriesMutex.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("notifier %q has unknown type %q, expected one of %v", nc.Name, nc.Type, Types())
+		}
+		l, err := newLimiter(nc)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %q: %w", nc.Name, err)
+		}
+		n, err := factory(nc.Settings, awsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create notifier %q: %w", nc.Name, err)
+		}
+		notifiers[nc.Name] = n
+		r.limiters[nc.Name] = l
+	}
+
+	for i, route := range r.routes {
+		if _, ok := notifiers[route.Notifier]; !ok {
+			return nil, fmt.Errorf("route %d uses undefined notifier %q", i+1, route.Notifier)
+		}
+		if route.MinSeverity == "" {
+			r.routes[i].MinSeverity = events.SeverityInfo
+		} else if !events.ValidSeverity(route.MinSeverity) {
+			return nil, fmt.Errorf("route %d has invalid min_severity %q", i+1, route.MinSeverity)
+		}
+	}
+
+	for name, n := range notifiers {
+		queue := make(chan events.Event, queueSize)
+		r.queues[name] = queue
+		r.wg.Add(1)
+		go r.deliver(name, n, r.limiters[name], queue)
+	}
+	return r, nil
+}
+
+// Run routes events from the broker until the broker is closed, then waits
+// for the queued events to be delivered.
+func (r *Router) Run(broker *events.Broker) {
+	ch, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+
+	for e := range ch {
+		r.route(e)
+	}
+	for _, queue := range r.queues {
+		close(queue)
+	}
+	r.wg.Wait()
+}
+
+// route queues the event for each notifier with a matching route, at most
+// once per notifier. Silenced events are not routed.
+func (r *Router) route(e events.Event) {
+	if e.Silenced {
+		return
+	}
+	sent := make(map[string]bool)
+	for _, route := range r.routes {
+		if sent[route.Notifier] || !route.matches(e) {
+			continue
+		}
+		sent[route.Notifier] = true
+		select {
+		case r.queues[route.Notifier] <- e:
+		default:
+			log.Printf("Notifier %s is not keeping up, dropping %s event", route.Notifier, e.Type)
+		}
+	}
+}
+
+func (r *Router) deliver(name string, n Notifier, l *limiter, queue <-chan events.Event) {
+	defer r.wg.Done()
+	for e := range queue {
+		switch l.allow(e, time.Now()) {
+		case dropDuplicate:
+			continue
+		case dropRateLimited:
+			if !l.limited {
+				log.Printf("Notifier %s reached its rate limit, dropping events", name)
+				l.limited = true
+			}
+			continue
+		}
+		l.limited = false
+
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		if err := n.Notify(ctx, e); err != nil {
+			log.Printf("Error sending %s event to notifier %s: %v", e.Type, name, err)
+		}
+		cancel()
+	}
+}
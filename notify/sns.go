@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/panubo/elb-trust-store-exporter/events"
+)
+
+func init() {
+	Register("sns", newSNSNotifier)
+}
+
+// snsNotifier publishes each event as a JSON message to an SNS topic, with
+// the event type and severity as message attributes for subscription filter
+// policies.
+type snsNotifier struct {
+	client   *sns.Client
+	topicARN string
+}
+
+func newSNSNotifier(settings map[string]string, awsConfig AWSConfigFunc) (Notifier, error) {
+	n := &snsNotifier{topicARN: settings["topic_arn"]}
+	if n.topicARN == "" {
+		return nil, errors.New("the sns notifier requires a topic_arn")
+	}
+	topic, err := arn.Parse(n.topicARN)
+	if err != nil || topic.Service != "sns" {
+		return nil, fmt.Errorf("the sns notifier topic_arn %q is not an SNS topic ARN", n.topicARN)
+	}
+
+	// The topic's region is used unless another is given, such as the region
+	// of an interface VPC endpoint.
+	region := topic.Region
+	for key, value := range settings {
+		switch key {
+		case "topic_arn":
+		case "region":
+			region = value
+		default:
+			return nil, fmt.Errorf("the sns notifier has no setting %q", key)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	cfg, err := awsConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	cfg.Region = region
+	n.client = sns.NewFromConfig(cfg)
+	return n, nil
+}
+
+func (n *snsNotifier) Notify(ctx context.Context, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = n.client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(n.topicARN),
+		Subject:  aws.String(fmt.Sprintf("ELB trust store exporter %s event (%s)", e.Type, e.Severity)),
+		Message:  aws.String(string(data)),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"type": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(e.Type),
+			},
+			"severity": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(e.Severity),
+			},
+		},
+	})
+	return err
+}
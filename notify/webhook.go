@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/panubo/elb-trust-store-exporter/events"
+)
+
+func init() {
+	Register("webhook", newWebhookNotifier)
+}
+
+// webhookNotifier POSTs each event as JSON to a URL. A bearer token read from
+// a file is sent in the Authorization header if configured, and the file is
+// read again for every event so the token can be rotated.
+type webhookNotifier struct {
+	client          *http.Client
+	url             string
+	bearerTokenFile string
+}
+
+func newWebhookNotifier(settings map[string]string, _ AWSConfigFunc) (Notifier, error) {
+	n := &webhookNotifier{client: &http.Client{}}
+	for key, value := range settings {
+		switch key {
+		case "url":
+			u, err := url.Parse(value)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("the webhook notifier url %q is not an http or https URL", value)
+			}
+			n.url = value
+		case "bearer_token_file":
+			n.bearerTokenFile = value
+		default:
+			return nil, fmt.Errorf("the webhook notifier has no setting %q", key)
+		}
+	}
+	if n.url == "" {
+		return nil, errors.New("the webhook notifier requires a url")
+	}
+	return n, nil
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "elb-trust-store-exporter")
+	if n.bearerTokenFile != "" {
+		token, err := os.ReadFile(n.bearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read bearer token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return nil
+}
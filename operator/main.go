@@ -0,0 +1,275 @@
+// Package operator reads the trust stores to monitor from TrustStoreMonitor
+// resources in a Kubernetes cluster, watching the API server so the exporter
+// can reconcile its collectors with them as they change.
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/panubo/elb-trust-store-exporter/collector"
+	"github.com/panubo/elb-trust-store-exporter/kube"
+)
+
+// The API group, version and resource of TrustStoreMonitor resources.
+const (
+	Group    = "elb-trust-store-exporter.panubo.com"
+	Version  = "v1alpha1"
+	Resource = "truststoremonitors"
+)
+
+// roleSessionName is the session name of the roles assumed for monitors.
+const roleSessionName = "elb-trust-store-exporter"
+
+// watchTimeout is how long the API server keeps a watch open before it has
+// to be renewed.
+const watchTimeout = 5 * time.Minute
+
+// retryInterval is how long to wait before listing the monitors again after
+// an error.
+const retryInterval = 10 * time.Second
+
+// TrustStoreMonitor declares the trust stores to monitor with one collector.
+type TrustStoreMonitor struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		UID             string `json:"uid"`
+		ResourceVersion string `json:"resourceVersion"`
+		Generation      int64  `json:"generation"`
+	} `json:"metadata"`
+	Spec Spec `json:"spec"`
+}
+
+// Spec is the specification of a TrustStoreMonitor. Settings that are
+// present override the corresponding command-line flags.
+type Spec struct {
+	// TrustStoreARNs are the trust stores to monitor. Without them every
+	// trust store in the region is discovered.
+	TrustStoreARNs []string `json:"trustStoreArns,omitempty"`
+	// Region is the region of the trust stores, by default the region of
+	// the first trust store ARN or else the exporter's region.
+	Region string `json:"region,omitempty"`
+	// RoleARN is a role to assume to access the trust stores, with
+	// ExternalID if set.
+	RoleARN          string `json:"roleArn,omitempty"`
+	ExternalID       string `json:"externalId,omitempty"`
+	QueryInterval    string `json:"queryInterval,omitempty"`
+	IncludeNameRegex string `json:"includeNameRegex,omitempty"`
+	ExcludeNameRegex string `json:"excludeNameRegex,omitempty"`
+	// TrustStoreTags and CertificateInfoLabels select the labels of
+	// elb_trust_store_info and elb_trust_store_certificate_info.
+	TrustStoreTags        []string `json:"trustStoreTags,omitempty"`
+	CertificateInfoLabels []string `json:"certificateInfoLabels,omitempty"`
+}
+
+// String returns the namespace and name of the monitor.
+func (m *TrustStoreMonitor) String() string {
+	return m.Metadata.Namespace + "/" + m.Metadata.Name
+}
+
+// Key identifies the monitor and the generation of its spec, so it changes
+// whenever the spec does, including when the monitor is deleted and created
+// again with the same name.
+func (m *TrustStoreMonitor) Key() string {
+	return fmt.Sprintf("%s@%s#%d", m, m.Metadata.UID, m.Metadata.Generation)
+}
+
+// Apply overrides the collector options with the settings present in the
+// monitor's spec.
+func (m *TrustStoreMonitor) Apply(opts *collector.Options) error {
+	s := m.Spec
+	if len(s.TrustStoreARNs) > 0 {
+		if err := collector.CheckTrustStoreARNs(s.TrustStoreARNs); err != nil {
+			return err
+		}
+		opts.TrustStoreARNs = s.TrustStoreARNs
+		if s.Region == "" {
+			parsed, _ := arn.Parse(s.TrustStoreARNs[0])
+			opts.Region = parsed.Region
+		}
+	}
+	if s.Region != "" {
+		opts.Region = s.Region
+	}
+	if s.QueryInterval != "" {
+		interval, err := time.ParseDuration(s.QueryInterval)
+		if err != nil {
+			return fmt.Errorf("failed to parse query interval: %w", err)
+		}
+		opts.QueryInterval = interval
+	}
+	if s.IncludeNameRegex != "" {
+		re, err := regexp.Compile(s.IncludeNameRegex)
+		if err != nil {
+			return fmt.Errorf("failed to parse include name regex: %w", err)
+		}
+		opts.IncludeNameRegex = re
+	}
+	if s.ExcludeNameRegex != "" {
+		re, err := regexp.Compile(s.ExcludeNameRegex)
+		if err != nil {
+			return fmt.Errorf("failed to parse exclude name regex: %w", err)
+		}
+		opts.ExcludeNameRegex = re
+	}
+	if len(s.TrustStoreTags) > 0 {
+		if err := collector.CheckTrustStoreTags(s.TrustStoreTags); err != nil {
+			return err
+		}
+		opts.TrustStoreTags = s.TrustStoreTags
+	}
+	if len(s.CertificateInfoLabels) > 0 {
+		if err := collector.CheckCertificateInfoLabels(s.CertificateInfoLabels); err != nil {
+			return err
+		}
+		opts.CertificateInfoLabels = s.CertificateInfoLabels
+	}
+	return nil
+}
+
+// AWSConfig returns a copy of base in region if set, with the credentials of
+// the monitor's role if it has one.
+func (m *TrustStoreMonitor) AWSConfig(base aws.Config, region string) aws.Config {
+	cfg := base.Copy()
+	if region != "" {
+		cfg.Region = region
+	}
+	if m.Spec.RoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(base), m.Spec.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = roleSessionName
+			if m.Spec.ExternalID != "" {
+				o.ExternalID = aws.String(m.Spec.ExternalID)
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return cfg
+}
+
+// monitorList is a list of TrustStoreMonitor resources.
+type monitorList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []TrustStoreMonitor `json:"items"`
+}
+
+// Watcher follows the TrustStoreMonitor resources of a namespace, or of every
+// namespace.
+type Watcher struct {
+	client *kube.Client
+	path   string
+}
+
+// NewWatcher returns a Watcher of the monitors in namespace, or in every
+// namespace if it is empty.
+func NewWatcher(client *kube.Client, namespace string) *Watcher {
+	path := "/apis/" + Group + "/" + Version + "/"
+	if namespace != "" {
+		path += "namespaces/" + namespace + "/"
+	}
+	return &Watcher{client: client, path: path + Resource}
+}
+
+// Run lists the monitors and then watches them until ctx is done, calling fn
+// with every monitor, in namespace and name order, after listing them and
+// whenever one is added, changed or deleted. The monitors are listed again
+// whenever the watch fails.
+func (w *Watcher) Run(ctx context.Context, fn func([]TrustStoreMonitor)) {
+	for ctx.Err() == nil {
+		err := w.run(ctx, fn)
+		if errors.Is(err, errExpired) {
+			continue
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error watching TrustStoreMonitor resources: %v", err)
+			select {
+			case <-time.After(retryInterval):
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// errExpired is returned when the resource version being watched from is too
+// old, so the monitors must be listed again.
+var errExpired = errors.New("watch expired")
+
+func (w *Watcher) run(ctx context.Context, fn func([]TrustStoreMonitor)) error {
+	var list monitorList
+	if _, err := w.client.Do(ctx, http.MethodGet, w.path, nil, &list); err != nil {
+		return err
+	}
+	monitors := make(map[string]TrustStoreMonitor, len(list.Items))
+	for _, m := range list.Items {
+		monitors[m.String()] = m
+	}
+	fn(sorted(monitors))
+
+	version := list.Metadata.ResourceVersion
+	for ctx.Err() == nil {
+		path := fmt.Sprintf("%s?timeoutSeconds=%d", w.path, int(watchTimeout.Seconds()))
+		err := w.client.Watch(ctx, path, version, func(e kube.WatchEvent) error {
+			if e.Type == "ERROR" {
+				var status struct {
+					Code    int    `json:"code"`
+					Message string `json:"message"`
+				}
+				if err := json.Unmarshal(e.Object, &status); err == nil && status.Code == http.StatusGone {
+					return errExpired
+				}
+				return fmt.Errorf("watch error: %s", e.Object)
+			}
+
+			var m TrustStoreMonitor
+			if err := json.Unmarshal(e.Object, &m); err != nil {
+				return err
+			}
+			version = m.Metadata.ResourceVersion
+
+			switch e.Type {
+			case "ADDED", "MODIFIED":
+				if previous, ok := monitors[m.String()]; ok && previous.Key() == m.Key() {
+					// Only the metadata or status changed.
+					return nil
+				}
+				monitors[m.String()] = m
+			case "DELETED":
+				delete(monitors, m.String())
+			default:
+				return nil
+			}
+			fn(sorted(monitors))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sorted returns the monitors in namespace and name order.
+func sorted(monitors map[string]TrustStoreMonitor) []TrustStoreMonitor {
+	s := make([]TrustStoreMonitor, 0, len(monitors))
+	for _, m := range monitors {
+		s = append(s, m)
+	}
+	slices.SortFunc(s, func(a, b TrustStoreMonitor) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	return s
+}
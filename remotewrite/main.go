@@ -0,0 +1,221 @@
+// Package remotewrite pushes the exporter's metrics to a Prometheus remote
+// write endpoint, so it can run where it cannot be scraped.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/config"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// pushTimeout bounds the time taken by a single push.
+const pushTimeout = 30 * time.Second
+
+var labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ParseLabels parses labels given as name=value.
+func ParseLabels(pairs []string) (map[string]string, error) {
+	labels := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || !labelNameRegex.MatchString(name) || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("%q is not a label as name=value", pair)
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+// Client pushes the metrics gathered from a Gatherer to a remote write
+// endpoint using the remote write 1.0 protocol.
+type Client struct {
+	url      string
+	client   *http.Client
+	gatherer prometheus.Gatherer
+	labels   map[string]string
+}
+
+// New returns a Client pushing the metrics gathered from g to url, adding
+// labels to every series. cfg configures authentication and TLS, as in the
+// remote_write section of a Prometheus configuration.
+func New(url string, cfg config.HTTPClientConfig, g prometheus.Gatherer, labels map[string]string) (*Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	client, err := config.NewClientFromConfig(cfg, "remote_write")
+	if err != nil {
+		return nil, err
+	}
+	return &Client{url: url, client: client, gatherer: g, labels: labels}, nil
+}
+
+// Run pushes the metrics every interval until ctx is done, then pushes them a
+// final time.
+func (c *Client) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			c.push(context.Background())
+			return
+		}
+		c.push(ctx)
+	}
+}
+
+func (c *Client) push(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+	if err := c.Push(ctx); err != nil {
+		log.Printf("Error pushing metrics with remote write: %v", err)
+	}
+}
+
+// Push gathers the metrics and sends them to the endpoint.
+func (c *Client) Push(ctx context.Context) error {
+	families, err := c.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %w", err)
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(families, c.labels, time.Now()))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "elb-trust-store-exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote write endpoint returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// sample is a single sample of a series.
+type sample struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// samples flattens the metric families into samples, expanding histograms and
+// summaries into their series as in the text format. Samples without a
+// timestamp are given now.
+func samples(families []*dto.MetricFamily, labels map[string]string, now time.Time) []sample {
+	var out []sample
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			timestamp := now.UnixMilli()
+			if m.TimestampMs != nil {
+				timestamp = m.GetTimestampMs()
+			}
+			add := func(name string, value float64, extra ...string) {
+				ls := make(map[string]string, len(labels)+len(m.GetLabel())+2)
+				for k, v := range labels {
+					ls[k] = v
+				}
+				for _, lp := range m.GetLabel() {
+					ls[lp.GetName()] = lp.GetValue()
+				}
+				for i := 0; i+1 < len(extra); i += 2 {
+					ls[extra[i]] = extra[i+1]
+				}
+				ls["__name__"] = name
+				out = append(out, sample{labels: ls, value: value, timestamp: timestamp})
+			}
+
+			name := mf.GetName()
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, q.GetValue(), "quantile", formatFloat(q.GetQuantile()))
+				}
+				add(name+"_sum", s.GetSampleSum())
+				add(name+"_count", float64(s.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					add(name+"_bucket", float64(b.GetCumulativeCount()), "le", formatFloat(b.GetUpperBound()))
+				}
+				add(name+"_bucket", float64(h.GetSampleCount()), "le", "+Inf")
+				add(name+"_sum", h.GetSampleSum())
+				add(name+"_count", float64(h.GetSampleCount()))
+			}
+		}
+	}
+	return out
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// encodeWriteRequest encodes the metric families as a remote write 1.0
+// WriteRequest protocol buffer, with a time series per sample.
+func encodeWriteRequest(families []*dto.MetricFamily, labels map[string]string, now time.Time) []byte {
+	var req []byte
+	for _, s := range samples(families, labels, now) {
+		names := make([]string, 0, len(s.labels))
+		for name := range s.labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var ts []byte
+		for _, name := range names {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, s.labels[name])
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+		var smp []byte
+		smp = protowire.AppendTag(smp, 1, protowire.Fixed64Type)
+		smp = protowire.AppendFixed64(smp, math.Float64bits(s.value))
+		smp = protowire.AppendTag(smp, 2, protowire.VarintType)
+		smp = protowire.AppendVarint(smp, uint64(s.timestamp))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, smp)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
@@ -0,0 +1,69 @@
+// Package shard assigns trust stores to exporter replicas by consistent
+// hashing, so adding or removing a replica only moves the trust stores it
+// gains or loses rather than reshuffling the whole fleet.
+package shard
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"slices"
+	"strconv"
+)
+
+// DefaultVirtualNodes is the number of points each member has on the ring
+// when none is given. More points spread keys more evenly between members.
+const DefaultVirtualNodes = 128
+
+type point struct {
+	hash   uint64
+	member int
+}
+
+// Ring is a consistent hash ring of members numbered from zero.
+type Ring struct {
+	points []point
+}
+
+// NewRing returns a ring of members 0 to members-1, each with virtualNodes
+// points. Each member's points depend only on its own number, so a ring with
+// one more member moves only the keys the new member takes.
+func NewRing(members, virtualNodes int) *Ring {
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	r := &Ring{points: make([]point, 0, members*virtualNodes)}
+	for m := range members {
+		for v := range virtualNodes {
+			r.points = append(r.points, point{
+				hash:   hash("shard-" + strconv.Itoa(m) + "-" + strconv.Itoa(v)),
+				member: m,
+			})
+		}
+	}
+	slices.SortFunc(r.points, func(a, b point) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.member, b.member))
+	})
+	return r
+}
+
+// Owner returns the member a key is assigned to: the member of the first
+// point at or after the key's hash, wrapping around the ring.
+func (r *Ring) Owner(key string) int {
+	if len(r.points) == 0 {
+		return 0
+	}
+	h := hash(key)
+	i, _ := slices.BinarySearchFunc(r.points, h, func(p point, h uint64) int {
+		return cmp.Compare(p.hash, h)
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].member
+}
+
+func hash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}